@@ -0,0 +1,75 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2019
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"golang.org/x/xerrors"
+)
+
+// AuditRecord is an audit trail entry sent by an AuditSink, its table and
+// action are exposed as message attributes.
+type AuditRecord interface {
+	AuditTable() string
+	AuditAction() string
+}
+
+// AuditSink sends audit records as JSON messages to a queue. It doesn't depend
+// on the db package, adapt it to a db.AuditSink with:
+//
+//	sink := sqs.NewAuditSink(client, queueURL)
+//	db.AuditSinkFunc(func(ctx context.Context, record *db.AuditRecord) error {
+//		return sink.Record(ctx, record)
+//	})
+type AuditSink struct {
+	svc      sqsiface.SQSAPI
+	queueURL string
+}
+
+// NewAuditSink creates an audit sink sending each record as a JSON message to the given queue.
+func NewAuditSink(sqsClient sqsiface.SQSAPI, queueURL string) *AuditSink {
+	return &AuditSink{
+		svc:      sqsClient,
+		queueURL: queueURL,
+	}
+}
+
+// Record sends the audit record to the queue
+func (s *AuditSink) Record(ctx context.Context, record AuditRecord) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return xerrors.Errorf("sqs: unable to encode audit record: %w", err)
+	}
+
+	_, err = s.svc.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(s.queueURL),
+		MessageBody: aws.String(string(body)),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"table": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(record.AuditTable()),
+			},
+			"action": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(record.AuditAction()),
+			},
+		},
+	})
+	if err != nil {
+		return xerrors.Errorf("sqs: unable to send audit record: %w", err)
+	}
+
+	return nil
+}
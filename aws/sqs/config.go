@@ -11,12 +11,26 @@ package sqs
 
 import "time"
 
+// DefaultRetryBackoff is the initial delay before retrying a failed message when
+// NonFatal is set without a RetryBackoff, so that poison messages don't loop.
+const DefaultRetryBackoff = 10 * time.Second
+
 // Configuration to consume an AWS SQS queue.
 type Configuration struct {
 	QueueURL            string        `toml:"queueURL" default:"" comment:"URL of target SQS queue"`
 	MaxNumberOfMessages int64         `toml:"maxNumberOfMessages" default:"10" comment:"Max number of messages to retrieve from SQS queue"`
 	VisibilityTimeout   time.Duration `toml:"visibilityTimeout" default:"2m30s" comment:"Visibility timeout of messages retrieved from SQS queue"`
-	HeartbeatInterval   time.Duration `toml:"heartbeatInterval" default:"1m" comment:"Interval at which visibility timeouts are renewed"`
+	HeartbeatInterval   time.Duration `toml:"heartbeatInterval" default:"1m" comment:"Interval at which visibility timeouts are renewed, 0 uses half of the visibility timeout"`
 	WaitTime            time.Duration `toml:"waitTime" default:"20s" comment:"Wait time for long polling"`
 	Forever             bool          `toml:"forever" default:"true" comment:"Continue polling when the queue is empty"`
+	Concurrency         int           `toml:"concurrency" default:"1" comment:"Number of messages processed concurrently, more than 1 enables the worker pool"`
+	DrainTimeout        time.Duration `toml:"drainTimeout" default:"30s" comment:"Time given to in-flight messages to complete on shutdown"`
+	DeadLetterQueueURL  string        `toml:"deadLetterQueueURL" default:"" comment:"URL of the SQS queue receiving messages which exceeded max receive count"`
+	MaxReceiveCount     int           `toml:"maxReceiveCount" default:"0" comment:"Receive count after which a failed message is moved to the dead-letter queue, 0 disables"`
+	RetryBackoff        time.Duration `toml:"retryBackoff" default:"0s" comment:"Initial delay before retrying a failed message, doubled on each receive, 0 uses retriable error delays (and 10s for other failures when nonFatal)"`
+	MaxRetryBackoff     time.Duration `toml:"maxRetryBackoff" default:"15m" comment:"Upper bound of the retry backoff"`
+	NonFatal            bool          `toml:"nonFatal" default:"false" comment:"Keep consuming when a message fails"`
+	Unwrap              bool          `toml:"unwrap" default:"false" comment:"Unwrap SNS notifications and EventBridge events"`
+	VerifySNSSignatures bool          `toml:"verifySNSSignatures" default:"false" comment:"Only accept SNS notifications with a valid signature"`
+	AllowedTopicArns    []string      `toml:"allowedTopicArns" default:"" comment:"ARNs of the SNS topics accepted when verifying signatures, empty accepts any topic"`
 }
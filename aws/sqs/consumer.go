@@ -11,21 +11,31 @@ package sqs
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"go.opencensus.io/trace"
 	"go.uber.org/zap"
 	"golang.org/x/xerrors"
 
 	"github.com/scraly/go.pkg/log"
 )
 
-// MessageHandler is responsible to consume a single message.
+// MessageHandler is responsible to consume a single message body.
 type MessageHandler func(ctx context.Context, message string) error
 
+// Handle adapts the MessageHandler to the Handler signature.
+func (h MessageHandler) Handle(ctx context.Context, message *Message) error {
+	return h(ctx, message.Body)
+}
+
+// Handler is responsible to consume a single message along with its metadata.
+type Handler func(ctx context.Context, message *Message) error
+
 // QueueConsumer allows to consume an AWS SQS queue.
 type QueueConsumer struct {
 	svc                 sqsiface.SQSAPI
@@ -35,6 +45,17 @@ type QueueConsumer struct {
 	heartbeatInterval   time.Duration
 	waitTime            time.Duration
 	forever             bool
+	concurrency         int
+	drainTimeout        time.Duration
+	fifo                bool
+	deadLetterQueue     string
+	maxReceiveCount     int
+	retryBackoff        time.Duration
+	maxRetryBackoff     time.Duration
+	nonFatal            bool
+	payloads            PayloadStore
+	unwrap              bool
+	snsVerifier         *SNSVerifier
 }
 
 // NewQueueConsumer creates a QueueConsumer from the given configuration.
@@ -45,14 +66,29 @@ func NewQueueConsumer(conf *Configuration, awsSession client.ConfigProvider) *Qu
 // NewQueueConsumerWithClient creates a QueueConsumer from the given configuration and using a
 // preconfigured SQS client.
 func NewQueueConsumerWithClient(conf *Configuration, sqsClient sqsiface.SQSAPI) *QueueConsumer {
+	var snsVerifier *SNSVerifier
+	if conf.VerifySNSSignatures {
+		snsVerifier = NewSNSVerifier(nil).WithTopics(conf.AllowedTopicArns...)
+	}
+
 	return &QueueConsumer{
 		svc:                 sqsClient,
 		queue:               conf.QueueURL,
 		maxNumberOfMessages: conf.MaxNumberOfMessages,
 		visibilityTimeout:   conf.VisibilityTimeout,
-		heartbeatInterval:   conf.HeartbeatInterval,
+		heartbeatInterval:   heartbeat(conf.VisibilityTimeout, conf.HeartbeatInterval),
 		waitTime:            conf.WaitTime,
 		forever:             conf.Forever,
+		concurrency:         conf.Concurrency,
+		drainTimeout:        conf.DrainTimeout,
+		fifo:                strings.HasSuffix(conf.QueueURL, ".fifo"),
+		deadLetterQueue:     conf.DeadLetterQueueURL,
+		maxReceiveCount:     conf.MaxReceiveCount,
+		retryBackoff:        conf.RetryBackoff,
+		maxRetryBackoff:     conf.MaxRetryBackoff,
+		nonFatal:            conf.NonFatal,
+		unwrap:              conf.Unwrap || conf.VerifySNSSignatures,
+		snsVerifier:         snsVerifier,
 	}
 }
 
@@ -70,42 +106,39 @@ func extractDelay(err error) *time.Duration {
 	return &noDelay
 }
 
-// ConsumeMessages using the given handler.
+// ConsumeMessages using the given handler, which only receives message bodies.
+//
+// See Consume.
+func (m *QueueConsumer) ConsumeMessages(ctx context.Context, handler MessageHandler) (int, error) {
+	return m.Consume(ctx, handler.Handle)
+}
+
+// Consume messages using the given handler.
 //
 // Each message is kept invisible to other consumers until its handler returns.
 // Returns the count of consumed messages along with the encountered error, if any.
-func (m *QueueConsumer) ConsumeMessages(ctx context.Context, handler MessageHandler) (int, error) {
+//
+// Messages are handled one after the other and the messages of a receive are
+// deleted or made visible again at once, once all of them have been handled.
+// With a concurrency greater than 1, messages are processed by a worker pool:
+// see consumeConcurrently. FIFO queues, identified by their ".fifo" suffix, are
+// processed in order per message group: see consumeFIFO.
+func (m *QueueConsumer) Consume(ctx context.Context, handler Handler) (int, error) {
+	if m.fifo {
+		return m.consumeFIFO(ctx, handler)
+	}
+	if m.concurrency > 1 {
+		return m.consumeConcurrently(ctx, handler)
+	}
+
 	consumed := 0
 
 	for {
-		log.For(ctx).Debug("Receive messages",
-			zap.String("queue", m.queue),
-			zap.Int64("maxNumberOfMessages", m.maxNumberOfMessages),
-			zap.Duration("visibilityTimeout", m.visibilityTimeout),
-			zap.Duration("waitTime", m.waitTime),
-		)
-
-		result, err := m.svc.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
-			AttributeNames: []*string{
-				aws.String(sqs.MessageSystemAttributeNameSentTimestamp),
-			},
-			MessageAttributeNames: []*string{
-				aws.String(sqs.QueueAttributeNameAll),
-			},
-			QueueUrl:            aws.String(m.queue),
-			MaxNumberOfMessages: aws.Int64(m.maxNumberOfMessages), // The SQS-enforced maximum is 10
-			VisibilityTimeout:   aws.Int64(int64(m.visibilityTimeout / time.Second)),
-			WaitTimeSeconds:     aws.Int64(int64(m.waitTime / time.Second)), // The SQS-enforced maximum is 20s
-		})
+		result, err := m.receiveMessages(ctx)
 		if err != nil {
-			log.For(ctx).Error("Failed to receive messages", zap.Error(err))
 			return consumed, err
 		}
 
-		log.For(ctx).Debug("Received messages",
-			zap.Int("messages", len(result.Messages)),
-		)
-
 		if len(result.Messages) == 0 {
 			if m.forever {
 				continue
@@ -115,45 +148,38 @@ func (m *QueueConsumer) ConsumeMessages(ctx context.Context, handler MessageHand
 		}
 
 		// Lock all messages
-		locks := make([]*MessageLock, len(result.Messages))
-		for index, message := range result.Messages {
-			locks[index] = NewMessageLock(ctx, m.svc, m.queue, m.visibilityTimeout, m.heartbeatInterval, message)
-		}
+		manager := NewLockManager(ctx, m.svc, m.queue, m.visibilityTimeout, m.heartbeatInterval, result.Messages)
+		locks := manager.Locks()
 
-		// Process each message and stop at the first failure
-		var firstErr error
-		for _, lock := range locks {
-			if firstErr != nil {
-				_ = lock.Release(&noDelay)
+		// Process each message and stop at the first failure, unless non-fatal
+		var (
+			processed   []*processedMessage
+			retryDelays = make([]*time.Duration, len(locks))
+			stopped     bool
+		)
+		for index, lock := range locks {
+			if stopped {
+				retryDelays[index] = &noDelay
 				continue
 			}
 
-			err := handler(ctx, aws.StringValue(lock.Message().Body))
-			retryDelay := extractDelay(err)
-
-			switch {
-			case retryDelay == nil:
-				// No error: having retryDelay to nil marks the message as consumed, it will be deleted.
-			case *retryDelay != 0:
-				log.For(ctx).Warn("Schedule message processing to be retried later",
-					zap.String("messageID", aws.StringValue(lock.Message().MessageId)),
-					zap.Duration("retryDelay", *retryDelay),
-				)
-			default:
-				log.For(ctx).Error("Failed to process message",
-					zap.String("messageID", aws.StringValue(lock.Message().MessageId)),
-					zap.Error(err),
-				)
-				firstErr = err
-			}
+			p := m.handleMessage(ctx, handler, lock)
+			processed = append(processed, p)
+			retryDelays[index] = p.retryDelay
+			stopped = p.failure != nil && !m.nonFatal
+		}
+
+		// Release the whole batch at once
+		errs := manager.releaseAll(locks, retryDelays)
 
-			err = lock.Release(retryDelay)
-			if firstErr == nil {
-				if err != nil {
-					firstErr = err
-				} else if retryDelay == nil {
-					consumed++
-				}
+		var firstErr error
+		for index, p := range processed {
+			result, err := m.completeMessage(p, errs[index])
+			if result == outcomeConsumed {
+				consumed++
+			}
+			if err != nil && !m.nonFatal && firstErr == nil {
+				firstErr = err
 			}
 		}
 
@@ -164,3 +190,189 @@ func (m *QueueConsumer) ConsumeMessages(ctx context.Context, handler MessageHand
 
 	return consumed, nil
 }
+
+func (m *QueueConsumer) receiveMessages(ctx context.Context) (*sqs.ReceiveMessageOutput, error) {
+	log.For(ctx).Debug("Receive messages",
+		zap.String("queue", m.queue),
+		zap.Int64("maxNumberOfMessages", m.maxNumberOfMessages),
+		zap.Duration("visibilityTimeout", m.visibilityTimeout),
+		zap.Duration("waitTime", m.waitTime),
+	)
+
+	attributeNames := []*string{
+		aws.String(sqs.MessageSystemAttributeNameSentTimestamp),
+		aws.String(sqs.MessageSystemAttributeNameApproximateReceiveCount),
+	}
+	if m.fifo {
+		attributeNames = append(attributeNames,
+			aws.String(sqs.MessageSystemAttributeNameMessageGroupId),
+			aws.String(sqs.MessageSystemAttributeNameSequenceNumber),
+		)
+	}
+
+	result, err := m.svc.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		AttributeNames: attributeNames,
+		MessageAttributeNames: []*string{
+			aws.String(sqs.QueueAttributeNameAll),
+		},
+		QueueUrl:            aws.String(m.queue),
+		MaxNumberOfMessages: aws.Int64(m.maxNumberOfMessages), // The SQS-enforced maximum is 10
+		VisibilityTimeout:   aws.Int64(int64(m.visibilityTimeout / time.Second)),
+		WaitTimeSeconds:     aws.Int64(int64(m.waitTime / time.Second)), // The SQS-enforced maximum is 20s
+	})
+	if err != nil {
+		log.For(ctx).Error("Failed to receive messages", zap.Error(err))
+		return nil, err
+	}
+
+	log.For(ctx).Debug("Received messages",
+		zap.Int("messages", len(result.Messages)),
+	)
+	recordReceived(m.queue, len(result.Messages))
+
+	return result, nil
+}
+
+// outcome of the processing of a message.
+type outcome int
+
+const (
+	// outcomeRetried means the message will be received again.
+	outcomeRetried outcome = iota
+	// outcomeConsumed means the message has been handled and deleted.
+	outcomeConsumed
+	// outcomeDeadLettered means the message has been moved to the dead-letter queue.
+	outcomeDeadLettered
+)
+
+// processMessage handles a single message and releases its lock according to
+// the handler outcome and the retry policy. Returns the outcome along with the
+// failure which was not scheduled to be retried, if any.
+func (m *QueueConsumer) processMessage(ctx context.Context, handler Handler, lock *MessageLock) (outcome, error) {
+	p := m.handleMessage(ctx, handler, lock)
+	return m.completeMessage(p, lock.Release(p.retryDelay))
+}
+
+// processedMessage is a handled message waiting for its lock to be released.
+type processedMessage struct {
+	ctx        context.Context
+	span       *trace.Span
+	start      time.Time
+	lock       *MessageLock
+	message    *Message
+	err        error
+	outcome    outcome
+	failure    error
+	retryDelay *time.Duration
+}
+
+// handleMessage calls the handler and settles the message, its lock must then
+// be released with the retry delay and the message completed.
+//
+// SNS and EventBridge wrappers are removed before calling the handler, when
+// unwrapping is enabled. The message is processed in a span continuing the
+// trace of its producer, see TraceParentAttribute.
+func (m *QueueConsumer) handleMessage(ctx context.Context, handler Handler, lock *MessageLock) *processedMessage {
+	p := &processedMessage{
+		start:   time.Now(),
+		lock:    lock,
+		message: NewMessage(lock.Message()),
+	}
+
+	// Unwrap first, SNS notifications carry the producer trace context in their attributes
+	p.err = m.unwrapMessage(ctx, p.message)
+
+	p.ctx, p.span = m.startSpan(ctx, p.message)
+
+	if p.err == nil {
+		p.err = m.loadPayload(p.ctx, p.message)
+	}
+	if p.err == nil {
+		p.err = handler(p.ctx, p.message)
+	}
+
+	p.outcome, p.retryDelay, p.failure = m.settleMessage(p.ctx, p.message, p.err)
+	return p
+}
+
+// completeMessage finishes the processing of the message once its lock has
+// been released.
+func (m *QueueConsumer) completeMessage(p *processedMessage, releaseErr error) (outcome, error) {
+	defer p.span.End()
+
+	switch {
+	case releaseErr != nil:
+		if p.outcome == outcomeConsumed {
+			p.outcome = outcomeRetried
+		}
+		p.failure = releaseErr
+	case p.outcome == outcomeConsumed:
+		m.deletePayload(p.ctx, p.message)
+	}
+
+	m.recordOutcome(p.message, p.outcome, p.failure, time.Since(p.start))
+	switch {
+	case p.failure != nil:
+		p.span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: p.failure.Error()})
+	case p.err != nil:
+		p.span.SetStatus(trace.Status{Code: trace.StatusCodeAborted, Message: p.err.Error()})
+	}
+
+	return p.outcome, p.failure
+}
+
+// settleMessage decides how the lock of the message is released according to
+// the handler error and the retry policy: a nil retry delay deletes the message.
+//
+// A failed message which reached the max receive count is moved to the
+// dead-letter queue. Otherwise, it is made visible again after the configured
+// exponential backoff or, when no backoff is configured, after the delay of its
+// RetriableError.
+//
+// A payload stored outside of SQS is deleted along with its consumed message,
+// a dead-lettered message keeps referencing it.
+func (m *QueueConsumer) settleMessage(ctx context.Context, message *Message, err error) (outcome, *time.Duration, error) {
+	if err == nil {
+		// No error: having retryDelay to nil marks the message as consumed, it will be deleted.
+		return outcomeConsumed, nil, nil
+	}
+
+	// Poison message
+	if m.shouldDeadLetter(message) {
+		dlqErr := m.moveToDeadLetter(ctx, message, err)
+		if dlqErr == nil {
+			return outcomeDeadLettered, nil, nil
+		}
+		log.For(ctx).Error("Failed to move message to dead-letter queue",
+			zap.String("messageID", message.ID),
+			zap.Error(dlqErr),
+		)
+	}
+
+	retryDelay := extractDelay(err)
+	retriable := *retryDelay != 0
+	switch {
+	case m.retryBackoff > 0:
+		retryDelay = m.backoff(m.retryBackoff, message.ReceiveCount)
+	case m.nonFatal && !retriable:
+		// Don't redeliver failing messages immediately, forever
+		retryDelay = m.backoff(DefaultRetryBackoff, message.ReceiveCount)
+	}
+
+	var failure error
+	if retriable {
+		log.For(ctx).Warn("Schedule message processing to be retried later",
+			zap.String("messageID", message.ID),
+			zap.Duration("retryDelay", *retryDelay),
+		)
+	} else {
+		log.For(ctx).Error("Failed to process message",
+			zap.String("messageID", message.ID),
+			zap.Int("receiveCount", message.ReceiveCount),
+			zap.Error(err),
+		)
+		failure = err
+	}
+
+	return outcomeRetried, retryDelay, failure
+}
@@ -200,6 +200,12 @@ func TestConsumer(t *testing.T) {
 						ReceiptHandle:     aws.StringValue(messages[2].ReceiptHandle),
 						VisibilityTimeout: visibilityTimeout,
 					},
+					{
+						// Second heartbeat for message 0
+						Delay:             200 * time.Millisecond,
+						ReceiptHandle:     aws.StringValue(messages[0].ReceiptHandle),
+						VisibilityTimeout: visibilityTimeout,
+					},
 					{
 						// Second heartbeat for message 1
 						Delay:             200 * time.Millisecond,
@@ -213,10 +219,16 @@ func TestConsumer(t *testing.T) {
 						VisibilityTimeout: visibilityTimeout,
 					},
 					{
-						// Schedule a retry for message 1
-						Delay:             250 * time.Millisecond,
+						// Third heartbeat for message 0
+						Delay:             300 * time.Millisecond,
+						ReceiptHandle:     aws.StringValue(messages[0].ReceiptHandle),
+						VisibilityTimeout: visibilityTimeout,
+					},
+					{
+						// Third heartbeat for message 1
+						Delay:             300 * time.Millisecond,
 						ReceiptHandle:     aws.StringValue(messages[1].ReceiptHandle),
-						VisibilityTimeout: 2520 * time.Second,
+						VisibilityTimeout: visibilityTimeout,
 					},
 					{
 						// Third heartbeat for message 2
@@ -224,6 +236,12 @@ func TestConsumer(t *testing.T) {
 						ReceiptHandle:     aws.StringValue(messages[2].ReceiptHandle),
 						VisibilityTimeout: visibilityTimeout,
 					},
+					{
+						// Schedule a retry for message 1 along with the batch
+						Delay:             350 * time.Millisecond,
+						ReceiptHandle:     aws.StringValue(messages[1].ReceiptHandle),
+						VisibilityTimeout: 2520 * time.Second,
+					},
 					{
 						// First heartbeat for message 3
 						Delay:             450 * time.Millisecond,
@@ -251,8 +269,8 @@ func TestConsumer(t *testing.T) {
 				},
 				DeleteMessage: []consumerDeleteMessageCall{
 					{
-						// Delete message 0 after success
-						Delay:         150 * time.Millisecond,
+						// Delete message 0 along with the batch
+						Delay:         350 * time.Millisecond,
 						ReceiptHandle: aws.StringValue(messages[0].ReceiptHandle),
 					},
 					{
@@ -336,6 +354,12 @@ func TestConsumer(t *testing.T) {
 						ReceiptHandle:     aws.StringValue(messages[2].ReceiptHandle),
 						VisibilityTimeout: visibilityTimeout,
 					},
+					{
+						// Second heartbeat for message 1
+						Delay:             350 * time.Millisecond,
+						ReceiptHandle:     aws.StringValue(messages[1].ReceiptHandle),
+						VisibilityTimeout: visibilityTimeout,
+					},
 					{
 						// Second heartbeat for message 2
 						Delay:             350 * time.Millisecond,
@@ -350,8 +374,8 @@ func TestConsumer(t *testing.T) {
 						ReceiptHandle: aws.StringValue(messages[0].ReceiptHandle),
 					},
 					{
-						// Delete message 1 after success
-						Delay:         300 * time.Millisecond,
+						// Delete message 1 along with the batch
+						Delay:         400 * time.Millisecond,
 						ReceiptHandle: aws.StringValue(messages[1].ReceiptHandle),
 					},
 					{
@@ -491,48 +515,54 @@ func TestConsumer(t *testing.T) {
 							}
 						}()
 
-					case sqsmock.ChangeMessageVisibilityRequest:
+					case sqsmock.ChangeMessageVisibilityBatchRequest:
 						delay := time.Now().Sub(start)
-
-						// Match expected call
-						var expected *consumerChangeMessageVisibilityCall
-						for index := range testCase.ExpectedCalls.ChangeMessageVisibility {
-							call := &testCase.ExpectedCalls.ChangeMessageVisibility[index]
-							if !call.Done && call.ReceiptHandle == aws.StringValue(req.ReceiptHandle) && similarDuration(call.Delay, delay, 20*time.Millisecond) {
-								call.Done = true
-								expected = call
-								break
+						output := &sqs.ChangeMessageVisibilityBatchOutput{}
+
+						for _, entry := range req.Entries {
+							// Match expected call
+							var expected *consumerChangeMessageVisibilityCall
+							for index := range testCase.ExpectedCalls.ChangeMessageVisibility {
+								call := &testCase.ExpectedCalls.ChangeMessageVisibility[index]
+								if !call.Done && call.ReceiptHandle == aws.StringValue(entry.ReceiptHandle) && similarDuration(call.Delay, delay, 20*time.Millisecond) {
+									call.Done = true
+									expected = call
+									break
+								}
 							}
-						}
-						g.Expect(expected).ToNot(BeNil(), "unexpected call to ChangeMessageVisibility after %s", delay)
+							g.Expect(expected).ToNot(BeNil(), "unexpected call to ChangeMessageVisibility after %s", delay)
 
-						// Check request
+							// Check request
+							g.Expect(time.Duration(aws.Int64Value(entry.VisibilityTimeout)) * time.Second).To(Equal(expected.VisibilityTimeout))
+							output.Successful = append(output.Successful, &sqs.ChangeMessageVisibilityBatchResultEntry{Id: entry.Id})
+						}
 						g.Expect(aws.StringValue(req.QueueUrl)).To(Equal(queueURL))
-						g.Expect(time.Duration(aws.Int64Value(req.VisibilityTimeout)) * time.Second).To(Equal(expected.VisibilityTimeout))
 
 						// Send reponse
-						req.Reply(&sqs.ChangeMessageVisibilityOutput{}, nil)
+						req.Reply(output, nil)
 
-					case sqsmock.DeleteMessageRequest:
+					case sqsmock.DeleteMessageBatchRequest:
 						delay := time.Now().Sub(start)
-
-						// Match expected call
-						var expected *consumerDeleteMessageCall
-						for index := range testCase.ExpectedCalls.DeleteMessage {
-							call := &testCase.ExpectedCalls.DeleteMessage[index]
-							if !call.Done && call.ReceiptHandle == aws.StringValue(req.ReceiptHandle) && similarDuration(call.Delay, delay, 20*time.Millisecond) {
-								call.Done = true
-								expected = call
-								break
+						output := &sqs.DeleteMessageBatchOutput{}
+
+						for _, entry := range req.Entries {
+							// Match expected call
+							var expected *consumerDeleteMessageCall
+							for index := range testCase.ExpectedCalls.DeleteMessage {
+								call := &testCase.ExpectedCalls.DeleteMessage[index]
+								if !call.Done && call.ReceiptHandle == aws.StringValue(entry.ReceiptHandle) && similarDuration(call.Delay, delay, 20*time.Millisecond) {
+									call.Done = true
+									expected = call
+									break
+								}
 							}
+							g.Expect(expected).ToNot(BeNil(), "unexpected call to DeleteMessage after %s", delay)
+							output.Successful = append(output.Successful, &sqs.DeleteMessageBatchResultEntry{Id: entry.Id})
 						}
-						g.Expect(expected).ToNot(BeNil(), "unexpected call to DeleteMessage after %s", delay)
-
-						// Check request
 						g.Expect(aws.StringValue(req.QueueUrl)).To(Equal(queueURL))
 
 						// Send reponse
-						req.Reply(&sqs.DeleteMessageOutput{}, nil)
+						req.Reply(output, nil)
 
 					default:
 						t.Fatalf("unexpected mock call of type %T after %s", req, time.Now().Sub(start))
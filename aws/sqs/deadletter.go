@@ -0,0 +1,121 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"github.com/scraly/go.pkg/log"
+)
+
+// Message attributes added to messages moved to the dead-letter queue.
+const (
+	FailureReasonAttribute       = "FailureReason"
+	FailureReceiveCountAttribute = "FailureReceiveCount"
+	SourceQueueAttribute         = "SourceQueue"
+	SourceMessageIDAttribute     = "SourceMessageId"
+)
+
+// maxVisibilityTimeout is the SQS-enforced maximum visibility timeout.
+const maxVisibilityTimeout = 12 * time.Hour
+
+// shouldDeadLetter returns true if the failed message reached the max receive count.
+func (m *QueueConsumer) shouldDeadLetter(message *Message) bool {
+	return m.deadLetterQueue != "" && m.maxReceiveCount > 0 && message.ReceiveCount >= m.maxReceiveCount
+}
+
+// moveToDeadLetter sends a copy of the message to the dead-letter queue along
+// with the failure reason.
+func (m *QueueConsumer) moveToDeadLetter(ctx context.Context, message *Message, cause error) error {
+	// Failure attributes first, original attributes fill the remaining slots
+	attributes := map[string]*sqs.MessageAttributeValue{
+		FailureReasonAttribute:       stringAttribute(cause.Error()),
+		FailureReceiveCountAttribute: {DataType: aws.String("Number"), StringValue: aws.String(strconv.Itoa(message.ReceiveCount))},
+		SourceQueueAttribute:         stringAttribute(m.queue),
+		SourceMessageIDAttribute:     stringAttribute(message.ID),
+	}
+	// Forward the message as received: wrappers and payload pointers are kept
+	body, original := message.Body, message.Attributes
+	if raw := message.Raw(); raw != nil {
+		body, original = aws.StringValue(raw.Body), raw.MessageAttributes
+	}
+	if value, ok := original[ExtendedPayloadSizeAttribute]; ok {
+		attributes[ExtendedPayloadSizeAttribute] = value
+	}
+	for name, value := range original {
+		if len(attributes) >= maxMessageAttributes {
+			break
+		}
+		if _, ok := attributes[name]; !ok {
+			attributes[name] = value
+		}
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(m.deadLetterQueue),
+		MessageBody:       aws.String(body),
+		MessageAttributes: attributes,
+	}
+	if strings.HasSuffix(m.deadLetterQueue, ".fifo") {
+		groupID := message.GroupID
+		if groupID == "" {
+			groupID = message.ID
+		}
+		input.MessageGroupId = aws.String(groupID)
+		input.MessageDeduplicationId = aws.String(message.ID)
+	}
+
+	if _, err := m.svc.SendMessageWithContext(ctx, input); err != nil {
+		return xerrors.Errorf("sqs: unable to send message to dead-letter queue: %w", err)
+	}
+
+	log.For(ctx).Warn("Message moved to dead-letter queue",
+		zap.String("messageID", message.ID),
+		zap.Int("receiveCount", message.ReceiveCount),
+		zap.String("deadLetterQueue", m.deadLetterQueue),
+		zap.Error(cause),
+	)
+
+	return nil
+}
+
+// backoff returns the exponential retry delay for the given receive count,
+// starting from the given initial delay.
+func (m *QueueConsumer) backoff(initial time.Duration, receiveCount int) *time.Duration {
+	limit := m.maxRetryBackoff
+	if limit <= 0 || limit > maxVisibilityTimeout {
+		limit = maxVisibilityTimeout
+	}
+
+	delay := initial
+	for i := 1; i < receiveCount && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+
+	return &delay
+}
+
+func stringAttribute(value string) *sqs.MessageAttributeValue {
+	return &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
+	}
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	pkg "github.com/scraly/go.pkg/aws/sqs"
+	sqsmock "github.com/scraly/go.pkg/aws/sqs/sqsmock"
+
+	. "github.com/onsi/gomega"
+)
+
+func receivedMessage(body string, receiveCount string) *sqs.Message {
+	return &sqs.Message{
+		MessageId:     aws.String("id-" + body),
+		ReceiptHandle: aws.String(body),
+		Body:          aws.String(body),
+		Attributes: map[string]*string{
+			sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String(receiveCount),
+		},
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"origin": {DataType: aws.String("String"), StringValue: aws.String("test")},
+		},
+	}
+}
+
+func TestConsumerDeadLetter(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	requests := make(chan interface{})
+	mock := &poolMock{batches: [][]*sqs.Message{{
+		receivedMessage("first", "1"),
+		receivedMessage("third", "3"),
+		receivedMessage("poison", "5"),
+		receivedMessage("ok", "1"),
+	}}}
+	go mock.serve(ctx, requests)
+
+	consumer := pkg.NewQueueConsumerWithClient(&pkg.Configuration{
+		QueueURL:            "foo",
+		MaxNumberOfMessages: 10,
+		VisibilityTimeout:   time.Minute,
+		HeartbeatInterval:   time.Minute,
+		DeadLetterQueueURL:  "foo-dlq",
+		MaxReceiveCount:     5,
+		RetryBackoff:        10 * time.Second,
+		MaxRetryBackoff:     time.Hour,
+		NonFatal:            true,
+	}, sqsmock.New(ctx, requests))
+
+	consumed, err := consumer.Consume(ctx, func(ctx context.Context, message *pkg.Message) error {
+		if message.Body == "ok" {
+			return nil
+		}
+		return errors.New("boom")
+	})
+
+	// Failures are not fatal
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(consumed).To(Equal(1))
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	// Exponential backoff based on the receive count
+	g.Expect(mock.visibility).To(HaveKeyWithValue("first", int64(10)))
+	g.Expect(mock.visibility).To(HaveKeyWithValue("third", int64(40)))
+
+	// Poison message moved to the dead-letter queue
+	g.Expect(mock.deleted).To(ConsistOf("poison", "ok"))
+	g.Expect(mock.sent).To(HaveLen(1))
+
+	sent := mock.sent[0]
+	g.Expect(aws.StringValue(sent.QueueUrl)).To(Equal("foo-dlq"))
+	g.Expect(aws.StringValue(sent.MessageBody)).To(Equal("poison"))
+	g.Expect(aws.StringValue(sent.MessageAttributes[pkg.FailureReasonAttribute].StringValue)).To(Equal("boom"))
+	g.Expect(aws.StringValue(sent.MessageAttributes[pkg.FailureReceiveCountAttribute].StringValue)).To(Equal("5"))
+	g.Expect(aws.StringValue(sent.MessageAttributes[pkg.SourceQueueAttribute].StringValue)).To(Equal("foo"))
+	g.Expect(aws.StringValue(sent.MessageAttributes[pkg.SourceMessageIDAttribute].StringValue)).To(Equal("id-poison"))
+	g.Expect(aws.StringValue(sent.MessageAttributes["origin"].StringValue)).To(Equal("test"))
+}
+
+func TestConsumerNonFatalDefaultBackoff(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	requests := make(chan interface{})
+	mock := &poolMock{batches: [][]*sqs.Message{{
+		receivedMessage("first", "1"),
+		receivedMessage("third", "3"),
+		receivedMessage("retriable", "1"),
+	}}}
+	go mock.serve(ctx, requests)
+
+	consumer := pkg.NewQueueConsumerWithClient(&pkg.Configuration{
+		QueueURL:            "foo",
+		MaxNumberOfMessages: 10,
+		VisibilityTimeout:   time.Minute,
+		HeartbeatInterval:   time.Minute,
+		MaxRetryBackoff:     time.Hour,
+		NonFatal:            true,
+	}, sqsmock.New(ctx, requests))
+
+	_, err := consumer.Consume(ctx, func(ctx context.Context, message *pkg.Message) error {
+		if message.Body == "retriable" {
+			return pkg.NewRetriableError(5 * time.Second)
+		}
+		return errors.New("boom")
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	// Failed messages are not redelivered immediately
+	g.Expect(mock.visibleZero).To(BeEmpty())
+	g.Expect(mock.visibility).To(HaveKeyWithValue("first", int64(10)))
+	g.Expect(mock.visibility).To(HaveKeyWithValue("third", int64(40)))
+
+	// Retriable errors keep their own delay
+	g.Expect(mock.visibility).To(HaveKeyWithValue("retriable", int64(5)))
+}
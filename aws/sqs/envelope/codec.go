@@ -0,0 +1,94 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package envelope
+
+import (
+	"encoding/json"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/xerrors"
+)
+
+// Content types of the provided codecs.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// Codec encodes event payloads.
+type Codec interface {
+	ContentType() string
+	Marshal(event interface{}) ([]byte, error)
+	Unmarshal(data []byte, event interface{}) error
+}
+
+// JSON encodes payloads as JSON, which are embedded as is in the envelope.
+var JSON Codec = jsonCodec{}
+
+// Protobuf encodes payloads as protocol buffers, which are embedded as base64
+// strings in the envelope. Events must implement proto.Message.
+var Protobuf Codec = protobufCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (jsonCodec) Marshal(event interface{}) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+func (jsonCodec) Unmarshal(data []byte, event interface{}) error {
+	return json.Unmarshal(data, event)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+func (protobufCodec) Marshal(event interface{}) ([]byte, error) {
+	message, ok := event.(proto.Message)
+	if !ok {
+		return nil, xerrors.Errorf("envelope: %T is not a protobuf message", event)
+	}
+	return proto.Marshal(message)
+}
+
+func (protobufCodec) Unmarshal(data []byte, event interface{}) error {
+	message, ok := event.(proto.Message)
+	if !ok {
+		return xerrors.Errorf("envelope: %T is not a protobuf message", event)
+	}
+	return proto.Unmarshal(data, message)
+}
+
+// embedPayload returns the envelope payload of the encoded event: JSON is
+// embedded as is, other content types as base64 strings.
+func embedPayload(contentType string, data []byte) (json.RawMessage, error) {
+	if contentType == ContentTypeJSON {
+		return data, nil
+	}
+	return json.Marshal(data)
+}
+
+// extractPayload reverses embedPayload.
+func extractPayload(contentType string, payload json.RawMessage) ([]byte, error) {
+	if contentType == ContentTypeJSON {
+		return payload, nil
+	}
+	var data []byte
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package envelope
+
+import (
+	"context"
+
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"github.com/scraly/go.pkg/aws/sqs"
+	"github.com/scraly/go.pkg/log"
+)
+
+// ErrUnhandledEvent is returned when no handler is registered for an event type.
+var ErrUnhandledEvent = xerrors.New("envelope: unhandled event type")
+
+// EventHandler handles a decoded event, given as a pointer to its registered Go type.
+type EventHandler func(ctx context.Context, envelope *Envelope, event interface{}) error
+
+// Dispatcher routes the events of consumed messages to per-type handlers.
+//
+// Messages which cannot be decoded fail with a non-retriable error, so that
+// they are handled according to the failure policy of the sqs.QueueConsumer.
+type Dispatcher struct {
+	registry *Registry
+	handlers map[string]EventHandler
+}
+
+// NewDispatcher creates a Dispatcher decoding events with the given registry.
+func NewDispatcher(registry *Registry) *Dispatcher {
+	return &Dispatcher{
+		registry: registry,
+		handlers: map[string]EventHandler{},
+	}
+}
+
+// On registers the handler of all versions of the given event type.
+//
+// Handlers must be registered before consuming messages.
+func (d *Dispatcher) On(eventType string, handler EventHandler) *Dispatcher {
+	d.handlers[eventType] = handler
+	return d
+}
+
+// Handle the given message, it satisfies sqs.Handler.
+func (d *Dispatcher) Handle(ctx context.Context, message *sqs.Message) error {
+	return d.HandleMessage(ctx, message.Body)
+}
+
+// HandleMessage handles the given message body, it satisfies sqs.MessageHandler.
+func (d *Dispatcher) HandleMessage(ctx context.Context, body string) error {
+	envelope, event, err := d.registry.Decode(body)
+	if err != nil {
+		log.For(ctx).Error("Failed to decode event", zap.Error(err))
+		return err
+	}
+
+	handler, ok := d.handlers[envelope.Type]
+	if !ok {
+		return xerrors.Errorf("envelope: %q: %w", envelope.Type, ErrUnhandledEvent)
+	}
+
+	// Continue the producer trace, unless the consumer already started one
+	var span *trace.Span
+	sc, remote := sqs.ParseTraceParent(envelope.TraceParent)
+	if remote && trace.FromContext(ctx) == nil {
+		ctx, span = trace.StartSpanWithRemoteParent(ctx, "envelope.Dispatch", sc)
+	} else {
+		ctx, span = trace.StartSpan(ctx, "envelope.Dispatch")
+		if remote {
+			span.AddLink(trace.Link{TraceID: sc.TraceID, SpanID: sc.SpanID, Type: trace.LinkTypeParent})
+		}
+	}
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("event.id", envelope.ID),
+		trace.StringAttribute("event.type", envelope.Type),
+		trace.Int64Attribute("event.version", int64(envelope.Version)),
+	)
+
+	if err := handler(ctx, envelope, event); err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+		return err
+	}
+	return nil
+}
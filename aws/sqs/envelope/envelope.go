@@ -0,0 +1,76 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+// Package envelope provides typed event envelopes for SQS messages.
+//
+// Events are Go values registered in a Registry under an event type and a
+// version. The registry wraps them in an Envelope, encoded with the codec of
+// their registration and optionally validated against a JSON Schema, and the
+// Dispatcher routes the decoded events of consumed messages to per-type
+// handlers.
+package envelope
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+var (
+	// ErrInvalidEnvelope is returned when a message body is not a valid envelope.
+	ErrInvalidEnvelope = xerrors.New("envelope: invalid envelope")
+	// ErrUnknownEventType is returned when an event type is not registered.
+	ErrUnknownEventType = xerrors.New("envelope: unknown event type")
+	// ErrInvalidPayload is returned when a payload does not match its schema.
+	ErrInvalidPayload = xerrors.New("envelope: invalid payload")
+)
+
+// Envelope wraps an encoded event along with its metadata.
+type Envelope struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Version     int             `json:"version"`
+	OccurredAt  time.Time       `json:"occurredAt"`
+	TraceParent string          `json:"traceparent,omitempty"`
+	ContentType string          `json:"contentType"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+// Parse the envelope of the given message body.
+func Parse(body string) (*Envelope, error) {
+	var envelope Envelope
+	if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+		return nil, xerrors.Errorf("envelope: %v: %w", err, ErrInvalidEnvelope)
+	}
+	if envelope.Type == "" || len(envelope.Payload) == 0 {
+		return nil, xerrors.Errorf("envelope: missing type or payload: %w", ErrInvalidEnvelope)
+	}
+	return &envelope, nil
+}
+
+// Body returns the message body of the envelope.
+func (e *Envelope) Body() (string, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return "", xerrors.Errorf("envelope: unable to encode envelope: %w", err)
+	}
+	return string(body), nil
+}
+
+// newID returns a random event identifier.
+func newID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", xerrors.Errorf("envelope: unable to generate event ID: %w", err)
+	}
+	return hex.EncodeToString(id[:]), nil
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package envelope_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awssqs "github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"go.opencensus.io/trace"
+	"golang.org/x/xerrors"
+
+	"github.com/scraly/go.pkg/aws/sqs"
+	"github.com/scraly/go.pkg/aws/sqs/envelope"
+
+	. "github.com/onsi/gomega"
+)
+
+type orderCreated struct {
+	OrderID string `json:"orderId"`
+	Amount  int    `json:"amount"`
+}
+
+const orderSchema = `{
+	"type": "object",
+	"required": ["orderId", "amount"],
+	"properties": {
+		"orderId": {"type": "string", "minLength": 1},
+		"amount": {"type": "integer", "minimum": 0}
+	}
+}`
+
+func newRegistry() *envelope.Registry {
+	registry := envelope.NewRegistry()
+	registry.MustRegister(
+		envelope.Registration{
+			Type:    "order.created",
+			Version: 1,
+			Event:   orderCreated{},
+			Schema:  envelope.MustJSONSchema(orderSchema),
+		},
+		envelope.Registration{
+			Type:    "greeting",
+			Version: 2,
+			Event:   &wrappers.StringValue{},
+			Codec:   envelope.Protobuf,
+		},
+	)
+	return registry
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		g := NewWithT(t)
+		registry := newRegistry()
+
+		ctx, span := trace.StartSpan(context.Background(), "test", trace.WithSampler(trace.AlwaysSample()))
+		defer span.End()
+
+		body, err := registry.Encode(ctx, &orderCreated{OrderID: "42", Amount: 10})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(body).To(ContainSubstring(`"payload":{"orderId":"42","amount":10}`))
+
+		env, event, err := registry.Decode(body)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(env.Type).To(Equal("order.created"))
+		g.Expect(env.Version).To(Equal(1))
+		g.Expect(env.ID).To(HaveLen(32))
+		g.Expect(env.OccurredAt).To(BeTemporally("~", time.Now(), time.Second))
+		g.Expect(env.ContentType).To(Equal(envelope.ContentTypeJSON))
+		g.Expect(env.TraceParent).To(Equal(sqs.FormatTraceParent(span.SpanContext())))
+		g.Expect(event).To(Equal(&orderCreated{OrderID: "42", Amount: 10}))
+	})
+
+	t.Run("Protobuf", func(t *testing.T) {
+		g := NewWithT(t)
+		registry := newRegistry()
+
+		body, err := registry.Encode(context.Background(), &wrappers.StringValue{Value: "hello"})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		env, event, err := registry.Decode(body)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(env.ContentType).To(Equal(envelope.ContentTypeProtobuf))
+		g.Expect(env.TraceParent).To(BeEmpty())
+		g.Expect(event.(*wrappers.StringValue).Value).To(Equal("hello"))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		g := NewWithT(t)
+		registry := newRegistry()
+
+		// Schema is checked on both sides
+		_, err := registry.Encode(context.Background(), orderCreated{Amount: -1})
+		g.Expect(xerrors.Is(err, envelope.ErrInvalidPayload)).To(BeTrue())
+
+		_, _, err = registry.Decode(`{"type":"order.created","version":1,"payload":{"orderId":"42"}}`)
+		g.Expect(xerrors.Is(err, envelope.ErrInvalidPayload)).To(BeTrue())
+
+		_, err = registry.Encode(context.Background(), struct{}{})
+		g.Expect(xerrors.Is(err, envelope.ErrUnknownEventType)).To(BeTrue())
+
+		_, _, err = registry.Decode(`{"type":"order.created","version":3,"payload":{}}`)
+		g.Expect(xerrors.Is(err, envelope.ErrUnknownEventType)).To(BeTrue())
+
+		_, _, err = registry.Decode(`not json`)
+		g.Expect(xerrors.Is(err, envelope.ErrInvalidEnvelope)).To(BeTrue())
+
+		_, _, err = registry.Decode(`{"type":"greeting","version":2,"contentType":"application/json","payload":{}}`)
+		g.Expect(xerrors.Is(err, envelope.ErrInvalidEnvelope)).To(BeTrue())
+
+		// Payloads which are not valid JSON can't be encoded
+		_, err = (&envelope.Envelope{Type: "order.created", Payload: []byte(`{`)}).Body()
+		g.Expect(err).To(HaveOccurred())
+
+		// Conflicting registrations
+		g.Expect(registry.Register(envelope.Registration{Type: "order.created", Version: 1, Event: struct{ A int }{}})).ToNot(Succeed())
+		g.Expect(registry.Register(envelope.Registration{Type: "order.updated", Event: orderCreated{}})).ToNot(Succeed())
+		g.Expect(registry.Register(envelope.Registration{Type: "other", Event: struct{ B int }{}, Codec: envelope.Protobuf, Schema: envelope.MustJSONSchema(`{}`)})).ToNot(Succeed())
+	})
+}
+
+func TestDispatcher(t *testing.T) {
+	g := NewWithT(t)
+	registry := newRegistry()
+
+	var orders []*orderCreated
+	var greetings []string
+	dispatcher := envelope.NewDispatcher(registry).
+		On("order.created", func(ctx context.Context, env *envelope.Envelope, event interface{}) error {
+			g.Expect(trace.FromContext(ctx)).ToNot(BeNil())
+			orders = append(orders, event.(*orderCreated))
+			return nil
+		}).
+		On("greeting", func(ctx context.Context, env *envelope.Envelope, event interface{}) error {
+			greetings = append(greetings, event.(*wrappers.StringValue).Value)
+			return nil
+		})
+
+	var handler sqs.MessageHandler = dispatcher.HandleMessage
+
+	order, err := registry.Encode(context.Background(), orderCreated{OrderID: "42", Amount: 10})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(handler(context.Background(), order)).To(Succeed())
+
+	greeting, err := registry.Encode(context.Background(), &wrappers.StringValue{Value: "hello"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(dispatcher.Handle(context.Background(), sqs.NewMessage(&awssqs.Message{Body: aws.String(greeting)}))).To(Succeed())
+
+	g.Expect(orders).To(Equal([]*orderCreated{{OrderID: "42", Amount: 10}}))
+	g.Expect(greetings).To(Equal([]string{"hello"}))
+
+	// Unhandled and invalid events
+	unhandled := envelope.NewDispatcher(registry)
+	err = unhandled.HandleMessage(context.Background(), order)
+	g.Expect(xerrors.Is(err, envelope.ErrUnhandledEvent)).To(BeTrue())
+
+	err = dispatcher.HandleMessage(context.Background(), strings.Replace(order, `"amount":10`, `"amount":"ten"`, 1))
+	g.Expect(xerrors.Is(err, envelope.ErrInvalidPayload)).To(BeTrue())
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package envelope
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.opencensus.io/trace"
+	"golang.org/x/xerrors"
+
+	"github.com/scraly/go.pkg/aws/sqs"
+)
+
+// Registration maps an event type to a Go type.
+type Registration struct {
+	// Type and Version identify the event in envelopes.
+	Type    string
+	Version int
+	// Event is a value of the Go type of the event, such as OrderCreated{}.
+	Event interface{}
+	// Codec of the payload, defaults to JSON.
+	Codec Codec
+	// Schema validates the encoded payload, it requires the JSON codec.
+	Schema Validator
+}
+
+type eventKey struct {
+	name    string
+	version int
+}
+
+// Registry maps event types to Go types.
+type Registry struct {
+	mu     sync.RWMutex
+	byKey  map[eventKey]*Registration
+	byType map[reflect.Type]*Registration
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		byKey:  map[eventKey]*Registration{},
+		byType: map[reflect.Type]*Registration{},
+	}
+}
+
+// Register an event type.
+//
+// Each type and version pair, as well as each Go type, can only be registered once.
+func (r *Registry) Register(registration Registration) error {
+	if registration.Type == "" || registration.Event == nil {
+		return xerrors.New("envelope: registration requires a type and an event")
+	}
+	if registration.Codec == nil {
+		registration.Codec = JSON
+	}
+	if registration.Schema != nil && registration.Codec.ContentType() != ContentTypeJSON {
+		return xerrors.Errorf("envelope: schema of %q requires the JSON codec", registration.Type)
+	}
+
+	key := eventKey{registration.Type, registration.Version}
+	goType := indirect(reflect.TypeOf(registration.Event))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.byKey[key]; ok {
+		return xerrors.Errorf("envelope: %q version %d is already registered", key.name, key.version)
+	}
+	if existing, ok := r.byType[goType]; ok {
+		return xerrors.Errorf("envelope: %s is already registered as %q", goType, existing.Type)
+	}
+
+	r.byKey[key] = &registration
+	r.byType[goType] = &registration
+	return nil
+}
+
+// MustRegister is like Register but panics on error.
+func (r *Registry) MustRegister(registrations ...Registration) {
+	for _, registration := range registrations {
+		if err := r.Register(registration); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Wrap the event in an envelope, the trace context is taken from the span of
+// the given context.
+func (r *Registry) Wrap(ctx context.Context, event interface{}) (*Envelope, error) {
+	r.mu.RLock()
+	registration, ok := r.byType[indirect(reflect.TypeOf(event))]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, xerrors.Errorf("envelope: %T: %w", event, ErrUnknownEventType)
+	}
+
+	data, err := registration.Codec.Marshal(event)
+	if err != nil {
+		return nil, xerrors.Errorf("envelope: unable to encode %q: %w", registration.Type, err)
+	}
+	if registration.Schema != nil {
+		if err := registration.Schema.Validate(data); err != nil {
+			return nil, err
+		}
+	}
+	payload, err := embedPayload(registration.Codec.ContentType(), data)
+	if err != nil {
+		return nil, xerrors.Errorf("envelope: unable to embed %q: %w", registration.Type, err)
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := &Envelope{
+		ID:          id,
+		Type:        registration.Type,
+		Version:     registration.Version,
+		OccurredAt:  time.Now().UTC(),
+		ContentType: registration.Codec.ContentType(),
+		Payload:     payload,
+	}
+	if span := trace.FromContext(ctx); span != nil {
+		envelope.TraceParent = sqs.FormatTraceParent(span.SpanContext())
+	}
+
+	return envelope, nil
+}
+
+// Unwrap the event of the envelope, as a pointer to its registered Go type.
+func (r *Registry) Unwrap(envelope *Envelope) (interface{}, error) {
+	r.mu.RLock()
+	registration, ok := r.byKey[eventKey{envelope.Type, envelope.Version}]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, xerrors.Errorf("envelope: %q version %d: %w", envelope.Type, envelope.Version, ErrUnknownEventType)
+	}
+
+	contentType := envelope.ContentType
+	if contentType == "" {
+		contentType = ContentTypeJSON
+	}
+	if contentType != registration.Codec.ContentType() {
+		return nil, xerrors.Errorf("envelope: unexpected content type %q: %w", contentType, ErrInvalidEnvelope)
+	}
+
+	data, err := extractPayload(contentType, envelope.Payload)
+	if err != nil {
+		return nil, xerrors.Errorf("envelope: %v: %w", err, ErrInvalidEnvelope)
+	}
+	if registration.Schema != nil {
+		if err := registration.Schema.Validate(data); err != nil {
+			return nil, err
+		}
+	}
+
+	event := reflect.New(indirect(reflect.TypeOf(registration.Event))).Interface()
+	if err := registration.Codec.Unmarshal(data, event); err != nil {
+		return nil, xerrors.Errorf("envelope: unable to decode %q: %v: %w", envelope.Type, err, ErrInvalidPayload)
+	}
+
+	return event, nil
+}
+
+// Encode the event as a message body.
+func (r *Registry) Encode(ctx context.Context, event interface{}) (string, error) {
+	envelope, err := r.Wrap(ctx, event)
+	if err != nil {
+		return "", err
+	}
+	return envelope.Body()
+}
+
+// Decode the envelope and the event of the given message body.
+func (r *Registry) Decode(body string) (*Envelope, interface{}, error) {
+	envelope, err := Parse(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	event, err := r.Unwrap(envelope)
+	if err != nil {
+		return envelope, nil, err
+	}
+	return envelope, event, nil
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
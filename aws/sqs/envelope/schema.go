@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package envelope
+
+import (
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+	"golang.org/x/xerrors"
+)
+
+// Validator checks encoded JSON payloads.
+type Validator interface {
+	Validate(payload []byte) error
+}
+
+type jsonSchema struct {
+	schema *gojsonschema.Schema
+}
+
+// NewJSONSchema returns a Validator for the given JSON Schema document.
+func NewJSONSchema(schema string) (Validator, error) {
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema))
+	if err != nil {
+		return nil, xerrors.Errorf("envelope: unable to compile schema: %w", err)
+	}
+	return &jsonSchema{schema: compiled}, nil
+}
+
+// MustJSONSchema is like NewJSONSchema but panics if the schema is invalid.
+func MustJSONSchema(schema string) Validator {
+	validator, err := NewJSONSchema(schema)
+	if err != nil {
+		panic(err)
+	}
+	return validator
+}
+
+// Validate the payload against the schema.
+func (s *jsonSchema) Validate(payload []byte) error {
+	result, err := s.schema.Validate(gojsonschema.NewBytesLoader(payload))
+	if err != nil {
+		return xerrors.Errorf("envelope: %v: %w", err, ErrInvalidPayload)
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	reasons := make([]string, len(result.Errors()))
+	for index, desc := range result.Errors() {
+		reasons[index] = desc.String()
+	}
+	return xerrors.Errorf("envelope: %s: %w", strings.Join(reasons, "; "), ErrInvalidPayload)
+}
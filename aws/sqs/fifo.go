@@ -0,0 +1,163 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.uber.org/zap"
+
+	"github.com/scraly/go.pkg/log"
+)
+
+// consumeFIFO processes the messages of each received batch in order per
+// message group, different groups being processed in parallel.
+//
+// When a message fails, the remaining messages of its group are released
+// immediately so that they are received again after it, the other groups are
+// not affected. The first failure is returned once the whole batch is done.
+func (m *QueueConsumer) consumeFIFO(ctx context.Context, handler Handler) (int, error) {
+	consumed := 0
+
+	for {
+		result, err := m.receiveMessages(ctx)
+		if err != nil {
+			return consumed, err
+		}
+
+		if len(result.Messages) == 0 {
+			if m.forever {
+				continue
+			} else {
+				break
+			}
+		}
+
+		// Lock all messages
+		locks := NewLockManager(ctx, m.svc, m.queue, m.visibilityTimeout, m.heartbeatInterval, result.Messages).Locks()
+
+		// Process groups in parallel, bounded by the configured concurrency
+		var (
+			mu       sync.Mutex
+			wg       sync.WaitGroup
+			firstErr error
+			slots    chan struct{}
+		)
+		if m.concurrency > 1 {
+			slots = make(chan struct{}, m.concurrency)
+		}
+
+		for _, group := range groupMessages(locks) {
+			wg.Add(1)
+			go func(group []*MessageLock) {
+				defer wg.Done()
+
+				if slots != nil {
+					slots <- struct{}{}
+					defer func() { <-slots }()
+				}
+
+				count, err := m.processGroup(ctx, handler, group)
+
+				mu.Lock()
+				consumed += count
+				if firstErr == nil && !m.nonFatal {
+					firstErr = err
+				}
+				mu.Unlock()
+			}(group)
+		}
+		wg.Wait()
+
+		if firstErr != nil {
+			return consumed, firstErr
+		}
+	}
+
+	return consumed, nil
+}
+
+// processGroup handles the messages of a group in order and stops at the first
+// message which will be received again.
+func (m *QueueConsumer) processGroup(ctx context.Context, handler Handler, group []*MessageLock) (int, error) {
+	consumed := 0
+
+	for index, lock := range group {
+		result, err := m.processMessage(ctx, handler, lock)
+		switch result {
+		case outcomeConsumed:
+			consumed++
+			continue
+		case outcomeDeadLettered:
+			continue
+		}
+
+		// Keep the group order: release the next messages
+		if remaining := group[index+1:]; len(remaining) > 0 {
+			log.For(ctx).Warn("Stop processing message group",
+				zap.String("messageGroupID", messageAttribute(lock.Message(), sqs.MessageSystemAttributeNameMessageGroupId)),
+				zap.Int("released", len(remaining)),
+			)
+			for _, pending := range remaining {
+				_ = pending.Release(&noDelay)
+			}
+		}
+		return consumed, err
+	}
+
+	return consumed, nil
+}
+
+// groupMessages splits locked messages by message group, ordered by sequence number.
+func groupMessages(locks []*MessageLock) [][]*MessageLock {
+	var (
+		groups  [][]*MessageLock
+		indexes = map[string]int{}
+	)
+
+	for _, lock := range locks {
+		groupID := messageAttribute(lock.Message(), sqs.MessageSystemAttributeNameMessageGroupId)
+
+		index, ok := indexes[groupID]
+		if !ok {
+			index = len(groups)
+			indexes[groupID] = index
+			groups = append(groups, nil)
+		}
+		groups[index] = append(groups[index], lock)
+	}
+
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool {
+			return lessSequenceNumber(
+				messageAttribute(group[i].Message(), sqs.MessageSystemAttributeNameSequenceNumber),
+				messageAttribute(group[j].Message(), sqs.MessageSystemAttributeNameSequenceNumber),
+			)
+		})
+	}
+
+	return groups
+}
+
+// lessSequenceNumber compares sequence numbers, which are large decimal numbers.
+func lessSequenceNumber(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+func messageAttribute(message *sqs.Message, name string) string {
+	return aws.StringValue(message.Attributes[name])
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	pkg "github.com/scraly/go.pkg/aws/sqs"
+	sqsmock "github.com/scraly/go.pkg/aws/sqs/sqsmock"
+
+	. "github.com/onsi/gomega"
+)
+
+func fifoMessage(body, groupID, sequenceNumber string) *sqs.Message {
+	return &sqs.Message{
+		MessageId:     aws.String("id-" + body),
+		ReceiptHandle: aws.String(body),
+		Body:          aws.String(body),
+		Attributes: map[string]*string{
+			sqs.MessageSystemAttributeNameMessageGroupId: aws.String(groupID),
+			sqs.MessageSystemAttributeNameSequenceNumber: aws.String(sequenceNumber),
+		},
+	}
+}
+
+func TestConsumerFIFO(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	requests := make(chan interface{})
+	mock := &poolMock{batches: [][]*sqs.Message{{
+		fifoMessage("a2", "a", "18851234567890000002"),
+		fifoMessage("b1", "b", "18851234567890000003"),
+		fifoMessage("a1", "a", "18851234567890000001"),
+		fifoMessage("a3", "a", "18851234567890000005"),
+		fifoMessage("b2", "b", "18851234567890000004"),
+	}}}
+	go mock.serve(ctx, requests)
+
+	consumer := pkg.NewQueueConsumerWithClient(&pkg.Configuration{
+		QueueURL:            "foo.fifo",
+		MaxNumberOfMessages: 10,
+		VisibilityTimeout:   time.Minute,
+		HeartbeatInterval:   time.Minute,
+	}, sqsmock.New(ctx, requests))
+
+	type call struct {
+		body       string
+		start, end time.Time
+	}
+	var (
+		mu    sync.Mutex
+		calls []call
+	)
+
+	consumed, err := consumer.ConsumeMessages(ctx, func(ctx context.Context, message string) error {
+		start := time.Now()
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		calls = append(calls, call{message, start, time.Now()})
+		mu.Unlock()
+
+		if message == "a2" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	g.Expect(err).To(MatchError("boom"))
+	g.Expect(consumed).To(Equal(3))
+
+	// Groups are processed in order, in parallel, and a3 is never handled
+	handled := map[string]call{}
+	for _, c := range calls {
+		handled[c.body] = c
+	}
+	g.Expect(handled).To(HaveLen(4))
+	g.Expect(handled).ToNot(HaveKey("a3"))
+	g.Expect(handled["a1"].end.After(handled["a2"].start)).To(BeFalse())
+	g.Expect(handled["b1"].end.After(handled["b2"].start)).To(BeFalse())
+	g.Expect(handled["b1"].start.Before(handled["a1"].end)).To(BeTrue())
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	g.Expect(mock.deleted).To(ConsistOf("a1", "b1", "b2"))
+	g.Expect(mock.visibleZero).To(ConsistOf("a2", "a3"))
+	g.Expect(aws.StringValueSlice(mock.inputs[0].AttributeNames)).To(ContainElement(sqs.MessageSystemAttributeNameMessageGroupId))
+	g.Expect(aws.StringValueSlice(mock.inputs[0].AttributeNames)).To(ContainElement(sqs.MessageSystemAttributeNameSequenceNumber))
+}
@@ -5,7 +5,10 @@ go 1.13
 require (
 	github.com/scraly/go.pkg/log v0.0.13
 	github.com/aws/aws-sdk-go v1.29.28
+	github.com/golang/protobuf v1.3.2
 	github.com/onsi/gomega v1.9.0
+	github.com/xeipuuv/gojsonschema v1.2.0
+	go.opencensus.io v0.22.2
 	go.uber.org/zap v1.14.1
 	golang.org/x/xerrors v0.0.0-20190717185122-a985d3407aa7
 )
@@ -21,6 +21,22 @@ import (
 	"github.com/scraly/go.pkg/log"
 )
 
+// defaultHeartbeatInterval is used when neither the heartbeat interval nor the
+// visibility timeout are set.
+const defaultHeartbeatInterval = time.Minute
+
+// heartbeat returns the given heartbeat interval, or half of the visibility
+// timeout when it is not set.
+func heartbeat(visibilityTimeout, heartbeatInterval time.Duration) time.Duration {
+	if heartbeatInterval > 0 {
+		return heartbeatInterval
+	}
+	if half := visibilityTimeout / 2; half > 0 {
+		return half
+	}
+	return defaultHeartbeatInterval
+}
+
 type releaseRequest struct {
 	retryDelay *time.Duration
 }
@@ -28,7 +44,8 @@ type releaseRequest struct {
 // MessageLock holds a message which is kept invisible to other consumers until Release is called.
 //
 // The invibility is garanteed be a background routine which peridically resets the visibility
-// timeout of the locked message.
+// timeout of the locked message. Locks obtained from a LockManager share the routine of the
+// manager instead.
 type MessageLock struct {
 	ctx               context.Context
 	svc               sqsiface.SQSAPI
@@ -38,16 +55,19 @@ type MessageLock struct {
 	message           *sqs.Message
 	release           chan releaseRequest
 	err               chan error
+	manager           *LockManager
 }
 
 // NewMessageLock creates a lock for the given SQS message.
+//
+// A heartbeat interval which is not positive defaults to half of the visibility timeout.
 func NewMessageLock(ctx context.Context, svc sqsiface.SQSAPI, queue string, visibilityTimeout, heartbeatInterval time.Duration, message *sqs.Message) *MessageLock {
 	lock := &MessageLock{
 		ctx:               ctx,
 		svc:               svc,
 		queue:             queue,
 		visibilityTimeout: visibilityTimeout,
-		heartbeatInterval: heartbeatInterval,
+		heartbeatInterval: heartbeat(visibilityTimeout, heartbeatInterval),
 		message:           message,
 		release:           make(chan releaseRequest, 1),
 		err:               make(chan error, 1),
@@ -68,6 +88,10 @@ func (l *MessageLock) Message() *sqs.Message {
 //
 // Release must be called only once.
 func (l *MessageLock) Release(retryDelay *time.Duration) error {
+	if l.manager != nil {
+		return l.manager.release(l, retryDelay)
+	}
+
 	l.release <- releaseRequest{
 		retryDelay: retryDelay,
 	}
@@ -76,23 +100,40 @@ func (l *MessageLock) Release(retryDelay *time.Duration) error {
 }
 
 func (l *MessageLock) loop() {
+	ticker := time.NewTicker(l.heartbeatInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case release := <-l.release:
 			if release.retryDelay == nil {
-				l.err <- l.deleteMessage()
+				err := l.deleteMessage()
+				if err != nil {
+					recordLockFailures(l.queue, operationDelete, 1)
+				}
+				l.err <- err
 			} else {
-				l.err <- l.changeMessageVisibility(*release.retryDelay)
+				err := l.changeMessageVisibility(*release.retryDelay)
+				if err != nil {
+					recordLockFailures(l.queue, operationRelease, 1)
+				}
+				l.err <- err
 			}
 			return
 
 		case <-l.ctx.Done():
-			_ = l.changeMessageVisibility(0)
+			if err := l.changeMessageVisibility(0); err != nil {
+				recordLockFailures(l.queue, operationRelease, 1)
+			}
 			l.err <- l.ctx.Err()
 			return
 
-		case <-time.After(l.heartbeatInterval):
-			_ = l.changeMessageVisibility(l.visibilityTimeout)
+		case <-ticker.C:
+			if err := l.changeMessageVisibility(l.visibilityTimeout); err != nil {
+				recordLockFailures(l.queue, operationRenew, 1)
+			} else {
+				recordLockRenewals(l.queue, 1)
+			}
 		}
 	}
 }
@@ -0,0 +1,376 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"github.com/scraly/go.pkg/log"
+)
+
+// errLockReleased is returned when a lock is released twice.
+var errLockReleased = xerrors.New("sqs: message lock is already released")
+
+type lockRelease struct {
+	lock       *MessageLock
+	retryDelay *time.Duration
+	err        chan error
+}
+
+type visibilityChange struct {
+	lock              *MessageLock
+	visibilityTimeout time.Duration
+}
+
+// LockManager holds a set of messages, typically the result of a single receive,
+// which are kept invisible to other consumers until their lock is released.
+//
+// A single background routine renews the visibility timeouts of all the held
+// messages with ChangeMessageVisibilityBatch calls. Releases settled together,
+// see releaseAll, or concurrently are coalesced into DeleteMessageBatch and
+// ChangeMessageVisibilityBatch calls.
+type LockManager struct {
+	ctx               context.Context
+	svc               sqsiface.SQSAPI
+	queue             string
+	visibilityTimeout time.Duration
+	heartbeatInterval time.Duration
+	locks             []*MessageLock
+	releases          chan []*lockRelease
+	done              chan struct{}
+}
+
+// NewLockManager locks the given SQS messages.
+//
+// When the context is cancelled, the messages which are still held are made
+// visible again. A heartbeat interval which is not positive defaults to half of
+// the visibility timeout.
+func NewLockManager(ctx context.Context, svc sqsiface.SQSAPI, queue string, visibilityTimeout, heartbeatInterval time.Duration, messages []*sqs.Message) *LockManager {
+	heartbeatInterval = heartbeat(visibilityTimeout, heartbeatInterval)
+
+	lm := &LockManager{
+		ctx:               ctx,
+		svc:               svc,
+		queue:             queue,
+		visibilityTimeout: visibilityTimeout,
+		heartbeatInterval: heartbeatInterval,
+		locks:             make([]*MessageLock, len(messages)),
+		releases:          make(chan []*lockRelease),
+		done:              make(chan struct{}),
+	}
+	for index, message := range messages {
+		lm.locks[index] = &MessageLock{
+			ctx:               ctx,
+			svc:               svc,
+			queue:             queue,
+			visibilityTimeout: visibilityTimeout,
+			heartbeatInterval: heartbeatInterval,
+			message:           message,
+			manager:           lm,
+		}
+	}
+	go lm.loop()
+	return lm
+}
+
+// Locks returns the locks of the held messages, in the order of the messages.
+func (lm *LockManager) Locks() []*MessageLock {
+	return lm.locks
+}
+
+func (lm *LockManager) release(lock *MessageLock, retryDelay *time.Duration) error {
+	return lm.releaseAll([]*MessageLock{lock}, []*time.Duration{retryDelay})[0]
+}
+
+// releaseAll releases the given locks of the manager at once, each one with its
+// retry delay, and returns the error of each release.
+func (lm *LockManager) releaseAll(locks []*MessageLock, retryDelays []*time.Duration) []error {
+	reqs := make([]*lockRelease, len(locks))
+	for index, lock := range locks {
+		reqs[index] = &lockRelease{
+			lock:       lock,
+			retryDelay: retryDelays[index],
+			err:        make(chan error, 1),
+		}
+	}
+
+	errs := make([]error, len(reqs))
+	select {
+	case lm.releases <- reqs:
+		for index, req := range reqs {
+			errs[index] = <-req.err
+		}
+	case <-lm.done:
+		err := lm.ctx.Err()
+		if err == nil {
+			err = errLockReleased
+		}
+		for index := range errs {
+			errs[index] = err
+		}
+	}
+	return errs
+}
+
+func (lm *LockManager) loop() {
+	defer close(lm.done)
+
+	held := append([]*MessageLock(nil), lm.locks...)
+	if len(held) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(lm.heartbeatInterval)
+	defer ticker.Stop()
+
+	for len(held) > 0 {
+		select {
+		case reqs := <-lm.releases:
+			// Coalesce the releases which are already pending
+			batch := reqs
+		pending:
+			for {
+				select {
+				case reqs := <-lm.releases:
+					batch = append(batch, reqs...)
+				default:
+					break pending
+				}
+			}
+			held = lm.releaseLocks(held, batch)
+
+		case <-lm.ctx.Done():
+			changes := make([]visibilityChange, len(held))
+			for index, lock := range held {
+				changes[index] = visibilityChange{lock: lock}
+			}
+			_ = lm.changeMessageVisibility(changes, operationRelease)
+			return
+
+		case <-ticker.C:
+			changes := make([]visibilityChange, len(held))
+			for index, lock := range held {
+				changes[index] = visibilityChange{lock: lock, visibilityTimeout: lm.visibilityTimeout}
+			}
+			errs := lm.changeMessageVisibility(changes, operationRenew)
+
+			renewed := 0
+			for _, err := range errs {
+				if err == nil {
+					renewed++
+				}
+			}
+			recordLockRenewals(lm.queue, renewed)
+		}
+	}
+}
+
+// releaseLocks deletes or changes the visibility of the released messages and
+// returns the messages which are still held.
+func (lm *LockManager) releaseLocks(held []*MessageLock, batch []*lockRelease) []*MessageLock {
+	var (
+		deletions     []*lockRelease
+		changes       []*lockRelease
+		deletionLocks []*MessageLock
+		changeEntries []visibilityChange
+	)
+
+	for _, req := range batch {
+		index := -1
+		for i, lock := range held {
+			if lock == req.lock {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			req.err <- errLockReleased
+			continue
+		}
+		held = append(held[:index], held[index+1:]...)
+
+		// No retry delay marks the message as consumed
+		if req.retryDelay == nil {
+			deletions = append(deletions, req)
+			deletionLocks = append(deletionLocks, req.lock)
+		} else {
+			changes = append(changes, req)
+			changeEntries = append(changeEntries, visibilityChange{lock: req.lock, visibilityTimeout: *req.retryDelay})
+		}
+	}
+
+	if len(deletions) > 0 {
+		errs := lm.deleteMessages(deletionLocks)
+		for index, req := range deletions {
+			req.err <- errs[index]
+		}
+	}
+	if len(changes) > 0 {
+		errs := lm.changeMessageVisibility(changeEntries, operationRelease)
+		for index, req := range changes {
+			req.err <- errs[index]
+		}
+	}
+
+	return held
+}
+
+// deleteMessages deletes the messages of the given locks by batches, returning
+// the error of each message.
+func (lm *LockManager) deleteMessages(locks []*MessageLock) []error {
+	errs := make([]error, len(locks))
+
+	for start := 0; start < len(locks); start += MaxBatchSize {
+		end := start + MaxBatchSize
+		if end > len(locks) {
+			end = len(locks)
+		}
+
+		entries := make([]*sqs.DeleteMessageBatchRequestEntry, 0, end-start)
+		for index := start; index < end; index++ {
+			entries = append(entries, &sqs.DeleteMessageBatchRequestEntry{
+				Id:            aws.String(strconv.Itoa(index)),
+				ReceiptHandle: locks[index].message.ReceiptHandle,
+			})
+		}
+
+		output, err := lm.svc.DeleteMessageBatch(&sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(lm.queue),
+			Entries:  entries,
+		})
+		if err != nil {
+			settleBatch(errs[start:end], start, nil, nil, xerrors.Errorf("sqs: unable to delete message batch: %w", err))
+			continue
+		}
+
+		succeeded := make([]*string, len(output.Successful))
+		for index, success := range output.Successful {
+			succeeded[index] = success.Id
+		}
+		settleBatch(errs[start:end], start, succeeded, output.Failed, nil)
+	}
+
+	failed := 0
+	for index, lock := range locks {
+		if errs[index] != nil {
+			failed++
+			log.For(lm.ctx).Error("Failed to delete message",
+				zap.String("messageID", aws.StringValue(lock.message.MessageId)),
+				zap.Error(errs[index]),
+			)
+			continue
+		}
+		log.For(lm.ctx).Info("Message deleted",
+			zap.String("messageID", aws.StringValue(lock.message.MessageId)),
+		)
+	}
+	recordLockFailures(lm.queue, operationDelete, failed)
+
+	return errs
+}
+
+// changeMessageVisibility changes the visibility timeouts of the given messages
+// by batches, returning the error of each message.
+func (lm *LockManager) changeMessageVisibility(changes []visibilityChange, operation string) []error {
+	errs := make([]error, len(changes))
+
+	for start := 0; start < len(changes); start += MaxBatchSize {
+		end := start + MaxBatchSize
+		if end > len(changes) {
+			end = len(changes)
+		}
+
+		entries := make([]*sqs.ChangeMessageVisibilityBatchRequestEntry, 0, end-start)
+		for index := start; index < end; index++ {
+			entries = append(entries, &sqs.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                aws.String(strconv.Itoa(index)),
+				ReceiptHandle:     changes[index].lock.message.ReceiptHandle,
+				VisibilityTimeout: aws.Int64(int64(changes[index].visibilityTimeout / time.Second)),
+			})
+		}
+
+		output, err := lm.svc.ChangeMessageVisibilityBatch(&sqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String(lm.queue),
+			Entries:  entries,
+		})
+		if err != nil {
+			settleBatch(errs[start:end], start, nil, nil, xerrors.Errorf("sqs: unable to change message visibility batch: %w", err))
+			continue
+		}
+
+		succeeded := make([]*string, len(output.Successful))
+		for index, success := range output.Successful {
+			succeeded[index] = success.Id
+		}
+		settleBatch(errs[start:end], start, succeeded, output.Failed, nil)
+	}
+
+	failed := 0
+	for index, change := range changes {
+		if errs[index] != nil {
+			failed++
+			log.For(lm.ctx).Warn("Failed to update visibility timeout",
+				zap.String("messageID", aws.StringValue(change.lock.message.MessageId)),
+				zap.Duration("visibilityTimeout", change.visibilityTimeout),
+				zap.Error(errs[index]),
+			)
+			continue
+		}
+		log.For(lm.ctx).Debug("Visibility timeout updated",
+			zap.String("messageID", aws.StringValue(change.lock.message.MessageId)),
+			zap.Duration("visibilityTimeout", change.visibilityTimeout),
+		)
+	}
+	recordLockFailures(lm.queue, operation, failed)
+
+	return errs
+}
+
+// settleBatch fills the errors of the entries of a batch starting at the given
+// offset, from either the call error or the batch result.
+func settleBatch(errs []error, offset int, succeeded []*string, failed []*sqs.BatchResultErrorEntry, callErr error) {
+	if callErr != nil {
+		for index := range errs {
+			errs[index] = callErr
+		}
+		return
+	}
+
+	// Entries missing from the result are considered failed
+	for index := range errs {
+		errs[index] = xerrors.New("sqs: entry missing from batch response")
+	}
+	entry := func(id *string) int {
+		index, err := strconv.Atoi(aws.StringValue(id))
+		if err != nil || index < offset || index >= offset+len(errs) {
+			return -1
+		}
+		return index - offset
+	}
+
+	for _, id := range succeeded {
+		if index := entry(id); index >= 0 {
+			errs[index] = nil
+		}
+	}
+	for _, failure := range failed {
+		if index := entry(failure.Id); index >= 0 {
+			errs[index] = xerrors.Errorf("sqs: %s: %s", aws.StringValue(failure.Code), aws.StringValue(failure.Message))
+		}
+	}
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opencensus.io/stats/view"
+
+	pkg "github.com/scraly/go.pkg/aws/sqs"
+	sqsmock "github.com/scraly/go.pkg/aws/sqs/sqsmock"
+
+	. "github.com/onsi/gomega"
+)
+
+// lockManagerMock records batch requests, failing the entries whose receipt
+// handle is registered in failures.
+type lockManagerMock struct {
+	mu        sync.Mutex
+	renewals  [][]string
+	releases  [][]string
+	deletions [][]string
+	failures  map[string]bool
+}
+
+func (l *lockManagerMock) serve(ctx context.Context, requests <-chan interface{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-requests:
+			l.mu.Lock()
+			switch req := req.(type) {
+			case sqsmock.ChangeMessageVisibilityBatchRequest:
+				output := &sqs.ChangeMessageVisibilityBatchOutput{}
+				handles := make([]string, 0, len(req.Entries))
+				for _, entry := range req.Entries {
+					handle := aws.StringValue(entry.ReceiptHandle)
+					handles = append(handles, handle)
+					if l.failures[handle] {
+						output.Failed = append(output.Failed, &sqs.BatchResultErrorEntry{Id: entry.Id, Code: aws.String("ReceiptHandleIsInvalid")})
+						continue
+					}
+					output.Successful = append(output.Successful, &sqs.ChangeMessageVisibilityBatchResultEntry{Id: entry.Id})
+				}
+				if aws.Int64Value(req.Entries[0].VisibilityTimeout) == 42 {
+					l.renewals = append(l.renewals, handles)
+				} else {
+					l.releases = append(l.releases, handles)
+				}
+				req.Reply(output, nil)
+
+			case sqsmock.DeleteMessageBatchRequest:
+				output := &sqs.DeleteMessageBatchOutput{}
+				handles := make([]string, 0, len(req.Entries))
+				for _, entry := range req.Entries {
+					handle := aws.StringValue(entry.ReceiptHandle)
+					handles = append(handles, handle)
+					if l.failures[handle] {
+						output.Failed = append(output.Failed, &sqs.BatchResultErrorEntry{Id: entry.Id, Code: aws.String("ReceiptHandleIsInvalid")})
+						continue
+					}
+					output.Successful = append(output.Successful, &sqs.DeleteMessageBatchResultEntry{Id: entry.Id})
+				}
+				l.deletions = append(l.deletions, handles)
+				req.Reply(output, nil)
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+func TestLockManager(t *testing.T) {
+	newManager := func(ctx, lockCtx context.Context, mock *lockManagerMock, count int) *pkg.LockManager {
+		requests := make(chan interface{})
+		go mock.serve(ctx, requests)
+
+		return pkg.NewLockManager(lockCtx, sqsmock.New(ctx, requests), "foo", 42*time.Second, 100*time.Millisecond, poolMessages(count))
+	}
+
+	t.Run("Coalescing", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(view.Register(pkg.LockRenewalsView)).To(Succeed())
+		defer view.Unregister(pkg.LockRenewalsView)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		mock := &lockManagerMock{}
+		locks := newManager(ctx, ctx, mock, 4).Locks()
+		g.Expect(locks).To(HaveLen(4))
+		g.Expect(aws.StringValue(locks[2].Message().ReceiptHandle)).To(Equal("baz2"))
+
+		// All messages renewed at once
+		time.Sleep(130 * time.Millisecond)
+
+		// Concurrent releases
+		var wg sync.WaitGroup
+		for _, lock := range locks[:3] {
+			wg.Add(1)
+			go func(lock *pkg.MessageLock) {
+				defer wg.Done()
+				g.Expect(lock.Release(nil)).To(Succeed())
+			}(lock)
+		}
+		wg.Wait()
+
+		retryDelay := 10 * time.Second
+		g.Expect(locks[3].Release(&retryDelay)).To(Succeed())
+		g.Expect(locks[3].Release(&retryDelay)).ToNot(Succeed())
+
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		g.Expect(mock.renewals).To(Equal([][]string{{"baz0", "baz1", "baz2", "baz3"}}))
+		g.Expect(mock.releases).To(Equal([][]string{{"baz3"}}))
+
+		var deleted []string
+		for _, batch := range mock.deletions {
+			deleted = append(deleted, batch...)
+		}
+		g.Expect(deleted).To(ConsistOf("baz0", "baz1", "baz2"))
+		g.Expect(len(mock.deletions)).To(BeNumerically("<=", 3))
+
+		rows, err := view.RetrieveData(pkg.LockRenewalsView.Name)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(rows).To(HaveLen(1))
+		g.Expect(rows[0].Data.(*view.SumData).Value).To(BeNumerically("==", 4))
+	})
+
+	t.Run("PartialFailures", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		mock := &lockManagerMock{failures: map[string]bool{"baz1": true}}
+		locks := newManager(ctx, ctx, mock, 2).Locks()
+
+		g.Expect(locks[0].Release(nil)).To(Succeed())
+		g.Expect(locks[1].Release(nil)).ToNot(Succeed())
+	})
+
+	t.Run("DefaultHeartbeat", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		requests := make(chan interface{})
+		mock := &poolMock{}
+		go mock.serve(ctx, requests)
+		svc := sqsmock.New(ctx, requests)
+
+		// A missing heartbeat interval must not stop the locks from working
+		locks := pkg.NewLockManager(ctx, svc, "foo", 42*time.Second, 0, poolMessages(2)).Locks()
+		g.Expect(locks[0].Release(nil)).To(Succeed())
+		g.Expect(locks[1].Release(nil)).To(Succeed())
+
+		lock := pkg.NewMessageLock(ctx, svc, "foo", 0, -time.Second, poolMessages(3)[2])
+		g.Expect(lock.Release(nil)).To(Succeed())
+
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		g.Expect(mock.deleted).To(ConsistOf("baz0", "baz1", "baz2"))
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		mock := &lockManagerMock{}
+		lockCtx, cancelLocks := context.WithCancel(ctx)
+		locks := newManager(ctx, lockCtx, mock, 3).Locks()
+
+		g.Expect(locks[0].Release(nil)).To(Succeed())
+		cancelLocks()
+
+		// Remaining messages are made visible again
+		g.Eventually(func() [][]string {
+			mock.mu.Lock()
+			defer mock.mu.Unlock()
+			return append([][]string(nil), mock.releases...)
+		}).Should(Equal([][]string{{"baz1", "baz2"}}))
+		g.Expect(locks[1].Release(nil)).To(MatchError(context.Canceled))
+	})
+}
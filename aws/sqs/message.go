@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Message is a received SQS message along with its metadata.
+type Message struct {
+	ID             string
+	Body           string
+	ReceiptHandle  string
+	Attributes     map[string]*sqs.MessageAttributeValue
+	ReceiveCount   int
+	SentTimestamp  time.Time
+	GroupID        string
+	SequenceNumber string
+	// Source is the service which produced the body, see SourceSQS.
+	Source string
+	// Notification is the unwrapped SNS notification, if any.
+	Notification *SNSNotification
+	// Event is the unwrapped EventBridge event, if any.
+	Event *EventBridgeEvent
+
+	raw     *sqs.Message
+	payload *PayloadPointer
+}
+
+// NewMessage creates a Message from the given SQS message.
+func NewMessage(message *sqs.Message) *Message {
+	msg := &Message{
+		ID:             aws.StringValue(message.MessageId),
+		Body:           aws.StringValue(message.Body),
+		ReceiptHandle:  aws.StringValue(message.ReceiptHandle),
+		Attributes:     message.MessageAttributes,
+		GroupID:        messageAttribute(message, sqs.MessageSystemAttributeNameMessageGroupId),
+		SequenceNumber: messageAttribute(message, sqs.MessageSystemAttributeNameSequenceNumber),
+		Source:         SourceSQS,
+		raw:            message,
+	}
+
+	if count, err := strconv.Atoi(messageAttribute(message, sqs.MessageSystemAttributeNameApproximateReceiveCount)); err == nil {
+		msg.ReceiveCount = count
+	}
+
+	// Sent timestamp is given in milliseconds since epoch
+	if ms, err := strconv.ParseInt(messageAttribute(message, sqs.MessageSystemAttributeNameSentTimestamp), 10, 64); err == nil {
+		msg.SentTimestamp = time.Unix(0, ms*int64(time.Millisecond))
+	}
+
+	return msg
+}
+
+// Raw returns the underlying SQS message.
+func (m *Message) Raw() *sqs.Message {
+	return m.raw
+}
+
+// SystemAttribute returns the value of the given system attribute, such as
+// sqs.MessageSystemAttributeNameSenderId.
+func (m *Message) SystemAttribute(name string) (string, bool) {
+	if m.raw == nil {
+		return "", false
+	}
+	value, ok := m.raw.Attributes[name]
+	return aws.StringValue(value), ok
+}
+
+// StringAttribute returns the value of a String message attribute.
+func (m *Message) StringAttribute(name string) (string, bool) {
+	attr, ok := m.attribute(name, "String")
+	if !ok {
+		return "", false
+	}
+	return aws.StringValue(attr.StringValue), true
+}
+
+// IntAttribute returns the value of a Number message attribute holding an integer.
+func (m *Message) IntAttribute(name string) (int64, bool) {
+	attr, ok := m.attribute(name, "Number")
+	if !ok {
+		return 0, false
+	}
+	value, err := strconv.ParseInt(aws.StringValue(attr.StringValue), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// FloatAttribute returns the value of a Number message attribute.
+func (m *Message) FloatAttribute(name string) (float64, bool) {
+	attr, ok := m.attribute(name, "Number")
+	if !ok {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(aws.StringValue(attr.StringValue), 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// BinaryAttribute returns the value of a Binary message attribute.
+func (m *Message) BinaryAttribute(name string) ([]byte, bool) {
+	attr, ok := m.attribute(name, "Binary")
+	if !ok {
+		return nil, false
+	}
+	return attr.BinaryValue, true
+}
+
+// attribute returns the message attribute if its data type matches the given
+// one, custom types such as "Number.int" are accepted.
+func (m *Message) attribute(name, dataType string) (*sqs.MessageAttributeValue, bool) {
+	attr, ok := m.Attributes[name]
+	if !ok || attr == nil {
+		return nil, false
+	}
+
+	actual := aws.StringValue(attr.DataType)
+	if actual != dataType && !strings.HasPrefix(actual, dataType+".") {
+		return nil, false
+	}
+	return attr, true
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	pkg "github.com/scraly/go.pkg/aws/sqs"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestMessage(t *testing.T) {
+	g := NewWithT(t)
+
+	raw := &sqs.Message{
+		MessageId:     aws.String("bar"),
+		ReceiptHandle: aws.String("baz"),
+		Body:          aws.String("qux"),
+		Attributes: map[string]*string{
+			sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String("3"),
+			sqs.MessageSystemAttributeNameSentTimestamp:           aws.String("1585699200123"),
+			sqs.MessageSystemAttributeNameMessageGroupId:          aws.String("group"),
+			sqs.MessageSystemAttributeNameSenderId:                aws.String("sender"),
+		},
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"name":  {DataType: aws.String("String"), StringValue: aws.String("alice")},
+			"count": {DataType: aws.String("Number.int"), StringValue: aws.String("42")},
+			"ratio": {DataType: aws.String("Number"), StringValue: aws.String("0.5")},
+			"blob":  {DataType: aws.String("Binary"), BinaryValue: []byte{1, 2}},
+		},
+	}
+
+	message := pkg.NewMessage(raw)
+
+	g.Expect(message.ID).To(Equal("bar"))
+	g.Expect(message.Body).To(Equal("qux"))
+	g.Expect(message.ReceiptHandle).To(Equal("baz"))
+	g.Expect(message.ReceiveCount).To(Equal(3))
+	g.Expect(message.SentTimestamp.Equal(time.Date(2020, 4, 1, 0, 0, 0, 123000000, time.UTC))).To(BeTrue())
+	g.Expect(message.GroupID).To(Equal("group"))
+	g.Expect(message.Raw()).To(BeIdenticalTo(raw))
+
+	sender, ok := message.SystemAttribute(sqs.MessageSystemAttributeNameSenderId)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(sender).To(Equal("sender"))
+
+	name, ok := message.StringAttribute("name")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(name).To(Equal("alice"))
+
+	count, ok := message.IntAttribute("count")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(count).To(Equal(int64(42)))
+
+	ratio, ok := message.FloatAttribute("ratio")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(ratio).To(Equal(0.5))
+
+	_, ok = message.IntAttribute("ratio")
+	g.Expect(ok).To(BeFalse())
+
+	blob, ok := message.BinaryAttribute("blob")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(blob).To(Equal([]byte{1, 2}))
+
+	_, ok = message.StringAttribute("count")
+	g.Expect(ok).To(BeFalse())
+	_, ok = message.StringAttribute("missing")
+	g.Expect(ok).To(BeFalse())
+
+	// The string handler is adapted to the message handler signature
+	var body string
+	handler := pkg.MessageHandler(func(ctx context.Context, message string) error {
+		body = message
+		return nil
+	})
+	g.Expect(handler.Handle(context.Background(), message)).To(Succeed())
+	g.Expect(body).To(Equal("qux"))
+}
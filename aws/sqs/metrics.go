@@ -0,0 +1,194 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// KeyQueue tags measures with the URL of the SQS queue.
+	KeyQueue, _ = tag.NewKey("sqs.queue")
+	// KeyOperation tags lock failures with the failed operation.
+	KeyOperation, _ = tag.NewKey("sqs.operation")
+)
+
+// Lock operations, used as KeyOperation values.
+const (
+	operationRenew   = "renew"
+	operationDelete  = "delete"
+	operationRelease = "release"
+)
+
+var (
+	// MeasureReceived counts the received messages.
+	MeasureReceived = stats.Int64("sqs/messages/received", "Number of received messages", stats.UnitDimensionless)
+	// MeasureProcessed counts the messages which were handled and deleted.
+	MeasureProcessed = stats.Int64("sqs/messages/processed", "Number of processed messages", stats.UnitDimensionless)
+	// MeasureFailed counts the messages which failed without being scheduled for retry.
+	MeasureFailed = stats.Int64("sqs/messages/failed", "Number of failed messages", stats.UnitDimensionless)
+	// MeasureRetried counts the messages which were scheduled for retry.
+	MeasureRetried = stats.Int64("sqs/messages/retried", "Number of retried messages", stats.UnitDimensionless)
+	// MeasureLatency is the processing time of messages.
+	MeasureLatency = stats.Float64("sqs/messages/latency", "Processing time of messages", stats.UnitMilliseconds)
+	// MeasureLag is the time spent by messages in the queue before being processed.
+	MeasureLag = stats.Float64("sqs/messages/lag", "Time between the sending and the processing of messages", stats.UnitMilliseconds)
+
+	// MeasureLockRenewals counts the visibility timeout renewals of locked messages.
+	MeasureLockRenewals = stats.Int64("sqs/lock/renewals", "Number of visibility timeout renewals", stats.UnitDimensionless)
+	// MeasureLockFailures counts the failed operations on locked messages.
+	MeasureLockFailures = stats.Int64("sqs/lock/failures", "Number of failed lock operations", stats.UnitDimensionless)
+)
+
+var (
+	// ReceivedView is the count of received messages by queue.
+	ReceivedView = &view.View{
+		Name:        "sqs/messages/received",
+		Description: "Number of received messages",
+		Measure:     MeasureReceived,
+		TagKeys:     []tag.Key{KeyQueue},
+		Aggregation: view.Sum(),
+	}
+	// ProcessedView is the count of processed messages by queue.
+	ProcessedView = &view.View{
+		Name:        "sqs/messages/processed",
+		Description: "Number of processed messages",
+		Measure:     MeasureProcessed,
+		TagKeys:     []tag.Key{KeyQueue},
+		Aggregation: view.Sum(),
+	}
+	// FailedView is the count of failed messages by queue.
+	FailedView = &view.View{
+		Name:        "sqs/messages/failed",
+		Description: "Number of failed messages",
+		Measure:     MeasureFailed,
+		TagKeys:     []tag.Key{KeyQueue},
+		Aggregation: view.Sum(),
+	}
+	// RetriedView is the count of retried messages by queue.
+	RetriedView = &view.View{
+		Name:        "sqs/messages/retried",
+		Description: "Number of retried messages",
+		Measure:     MeasureRetried,
+		TagKeys:     []tag.Key{KeyQueue},
+		Aggregation: view.Sum(),
+	}
+	// LatencyView is the distribution of processing times by queue.
+	LatencyView = &view.View{
+		Name:        "sqs/messages/latency",
+		Description: "Processing time of messages",
+		Measure:     MeasureLatency,
+		TagKeys:     []tag.Key{KeyQueue},
+		Aggregation: view.Distribution(1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000, 300000),
+	}
+	// LagView is the distribution of queue lags by queue.
+	LagView = &view.View{
+		Name:        "sqs/messages/lag",
+		Description: "Time between the sending and the processing of messages",
+		Measure:     MeasureLag,
+		TagKeys:     []tag.Key{KeyQueue},
+		Aggregation: view.Distribution(100, 500, 1000, 5000, 10000, 30000, 60000, 300000, 900000, 3600000, 21600000, 86400000),
+	}
+	// LockRenewalsView is the count of visibility timeout renewals by queue.
+	LockRenewalsView = &view.View{
+		Name:        "sqs/lock/renewals",
+		Description: "Number of visibility timeout renewals",
+		Measure:     MeasureLockRenewals,
+		TagKeys:     []tag.Key{KeyQueue},
+		Aggregation: view.Sum(),
+	}
+	// LockFailuresView is the count of failed lock operations by queue and operation.
+	LockFailuresView = &view.View{
+		Name:        "sqs/lock/failures",
+		Description: "Number of failed lock operations",
+		Measure:     MeasureLockFailures,
+		TagKeys:     []tag.Key{KeyQueue, KeyOperation},
+		Aggregation: view.Sum(),
+	}
+)
+
+// DefaultViews are the views of the package, to register with view.Register or
+// to export through the Views of platform.Application.
+var DefaultViews = []*view.View{
+	ReceivedView,
+	ProcessedView,
+	FailedView,
+	RetriedView,
+	LatencyView,
+	LagView,
+	LockRenewalsView,
+	LockFailuresView,
+}
+
+// recordReceived records received messages.
+func recordReceived(queue string, count int) {
+	if count == 0 {
+		return
+	}
+	_ = stats.RecordWithTags(context.Background(),
+		[]tag.Mutator{tag.Upsert(KeyQueue, queue)},
+		MeasureReceived.M(int64(count)),
+	)
+}
+
+// recordOutcome records the outcome, the processing time and the queue lag of
+// a processed message.
+func (m *QueueConsumer) recordOutcome(message *Message, result outcome, failure error, latency time.Duration) {
+	var counter *stats.Int64Measure
+	switch {
+	case result == outcomeConsumed:
+		counter = MeasureProcessed
+	case result == outcomeDeadLettered || failure != nil:
+		counter = MeasureFailed
+	default:
+		counter = MeasureRetried
+	}
+
+	measurements := []stats.Measurement{
+		counter.M(1),
+		MeasureLatency.M(float64(latency) / float64(time.Millisecond)),
+	}
+	if !message.SentTimestamp.IsZero() {
+		lag := time.Since(message.SentTimestamp) - latency
+		measurements = append(measurements, MeasureLag.M(float64(lag)/float64(time.Millisecond)))
+	}
+
+	_ = stats.RecordWithTags(context.Background(),
+		[]tag.Mutator{tag.Upsert(KeyQueue, m.queue)},
+		measurements...,
+	)
+}
+
+// recordLockRenewals records successful renewals.
+func recordLockRenewals(queue string, count int) {
+	if count == 0 {
+		return
+	}
+	_ = stats.RecordWithTags(context.Background(),
+		[]tag.Mutator{tag.Upsert(KeyQueue, queue)},
+		MeasureLockRenewals.M(int64(count)),
+	)
+}
+
+// recordLockFailures records failed lock operations.
+func recordLockFailures(queue, operation string, count int) {
+	if count == 0 {
+		return
+	}
+	_ = stats.RecordWithTags(context.Background(),
+		[]tag.Mutator{tag.Upsert(KeyQueue, queue), tag.Upsert(KeyOperation, operation)},
+		MeasureLockFailures.M(int64(count)),
+	)
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+
+	pkg "github.com/scraly/go.pkg/aws/sqs"
+	sqsmock "github.com/scraly/go.pkg/aws/sqs/sqsmock"
+
+	. "github.com/onsi/gomega"
+)
+
+// spanRecorder records exported spans.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(span *trace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+// viewValue returns the aggregated value of the view for the given queue.
+func viewValue(g *WithT, v *view.View, queue string) view.AggregationData {
+	rows, err := view.RetrieveData(v.Name)
+	g.Expect(err).ToNot(HaveOccurred())
+	for _, row := range rows {
+		for _, t := range row.Tags {
+			if t.Key == pkg.KeyQueue && t.Value == queue {
+				return row.Data
+			}
+		}
+	}
+	return nil
+}
+
+func TestConsumerInstrumentation(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(view.Register(pkg.DefaultViews...)).To(Succeed())
+	defer view.Unregister(pkg.DefaultViews...)
+
+	recorder := &spanRecorder{}
+	trace.RegisterExporter(recorder)
+	defer trace.UnregisterExporter(recorder)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Producer trace context
+	_, producer := trace.StartSpan(ctx, "producer", trace.WithSampler(trace.AlwaysSample()))
+	producer.End()
+
+	sent := strconv.FormatInt(time.Now().Add(-time.Minute).UnixNano()/int64(time.Millisecond), 10)
+	messages := []*sqs.Message{
+		receivedMessage("ok", "1"),
+		receivedMessage("retried", "1"),
+		receivedMessage("failed", "1"),
+	}
+	for _, message := range messages {
+		message.Attributes[sqs.MessageSystemAttributeNameSentTimestamp] = aws.String(sent)
+	}
+	messages[0].MessageAttributes[pkg.TraceParentAttribute] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(pkg.FormatTraceParent(producer.SpanContext())),
+	}
+
+	requests := make(chan interface{})
+	mock := &poolMock{batches: [][]*sqs.Message{messages}}
+	go mock.serve(ctx, requests)
+
+	queue := "instrumented"
+	consumer := pkg.NewQueueConsumerWithClient(&pkg.Configuration{
+		QueueURL:            queue,
+		MaxNumberOfMessages: 10,
+		VisibilityTimeout:   time.Minute,
+		HeartbeatInterval:   time.Minute,
+		NonFatal:            true,
+	}, sqsmock.New(ctx, requests))
+
+	var processingSpans []trace.SpanContext
+	consumed, err := consumer.Consume(ctx, func(ctx context.Context, message *pkg.Message) error {
+		processingSpans = append(processingSpans, trace.FromContext(ctx).SpanContext())
+		switch message.Body {
+		case "retried":
+			return pkg.NewRetriableError(time.Second)
+		case "failed":
+			return errors.New("boom")
+		}
+		return nil
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(consumed).To(Equal(1))
+
+	// Processing span continues the producer trace
+	g.Expect(processingSpans).To(HaveLen(3))
+	g.Expect(processingSpans[0].TraceID).To(Equal(producer.SpanContext().TraceID))
+	g.Expect(processingSpans[1].TraceID).ToNot(Equal(producer.SpanContext().TraceID))
+
+	recorder.mu.Lock()
+	var parent trace.SpanID
+	for _, span := range recorder.spans {
+		if span.Name == "sqs.Process" && span.SpanContext == processingSpans[0] {
+			parent = span.ParentSpanID
+			g.Expect(span.HasRemoteParent).To(BeTrue())
+			g.Expect(span.Attributes).To(HaveKeyWithValue("sqs.queue", queue))
+		}
+	}
+	recorder.mu.Unlock()
+	g.Expect(parent).To(Equal(producer.SpanContext().SpanID))
+
+	// Metrics
+	g.Expect(viewValue(g, pkg.ReceivedView, queue).(*view.SumData).Value).To(BeNumerically("==", 3))
+	g.Expect(viewValue(g, pkg.ProcessedView, queue).(*view.SumData).Value).To(BeNumerically("==", 1))
+	g.Expect(viewValue(g, pkg.RetriedView, queue).(*view.SumData).Value).To(BeNumerically("==", 1))
+	g.Expect(viewValue(g, pkg.FailedView, queue).(*view.SumData).Value).To(BeNumerically("==", 1))
+	g.Expect(viewValue(g, pkg.LatencyView, queue).(*view.DistributionData).Count).To(BeNumerically("==", 3))
+
+	lag := viewValue(g, pkg.LagView, queue).(*view.DistributionData)
+	g.Expect(lag.Count).To(BeNumerically("==", 3))
+	g.Expect(lag.Min).To(BeNumerically(">=", float64(time.Minute/time.Millisecond)))
+}
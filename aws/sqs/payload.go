@@ -0,0 +1,341 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"github.com/scraly/go.pkg/log"
+)
+
+// ExtendedPayloadSizeAttribute is the message attribute marking a message whose
+// payload is stored outside of SQS, it holds the payload size. The name matches
+// the one used by the AWS extended client libraries.
+const ExtendedPayloadSizeAttribute = "ExtendedPayloadSize"
+
+// PayloadPointer references a payload stored outside of SQS, it is sent as
+// message body in place of the payload.
+type PayloadPointer struct {
+	Bucket string `json:"s3BucketName"`
+	Key    string `json:"s3Key"`
+}
+
+// PayloadStore stores message payloads which exceed the claim-check threshold.
+type PayloadStore interface {
+	Put(ctx context.Context, payload []byte) (*PayloadPointer, error)
+	Get(ctx context.Context, pointer *PayloadPointer) ([]byte, error)
+	Delete(ctx context.Context, pointer *PayloadPointer) error
+}
+
+// encodePointer returns the message body referencing the payload.
+func encodePointer(pointer *PayloadPointer) (string, error) {
+	body, err := json.Marshal(pointer)
+	if err != nil {
+		return "", xerrors.Errorf("sqs: unable to encode payload pointer: %w", err)
+	}
+	return string(body), nil
+}
+
+// decodePointer returns the payload pointer of the message body.
+func decodePointer(body string) (*PayloadPointer, error) {
+	var pointer PayloadPointer
+	if err := json.Unmarshal([]byte(body), &pointer); err != nil {
+		return nil, xerrors.Errorf("sqs: unable to decode payload pointer: %w", err)
+	}
+	if pointer.Key == "" {
+		return nil, xerrors.New("sqs: payload pointer has no key")
+	}
+	return &pointer, nil
+}
+
+// newPayloadKey returns a random object key.
+func newPayloadKey(prefix string) (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", xerrors.Errorf("sqs: unable to generate payload key: %w", err)
+	}
+	return prefix + hex.EncodeToString(id[:]), nil
+}
+
+// -----------------------------------------------------------------------------
+
+// S3PayloadStore stores payloads in an AWS S3 bucket.
+type S3PayloadStore struct {
+	svc    s3iface.S3API
+	bucket string
+	prefix string
+}
+
+// NewS3PayloadStore creates a S3PayloadStore for the given bucket, object keys
+// are prefixed with the given prefix.
+func NewS3PayloadStore(awsSession client.ConfigProvider, bucket, prefix string) *S3PayloadStore {
+	return NewS3PayloadStoreWithClient(s3.New(awsSession), bucket, prefix)
+}
+
+// NewS3PayloadStoreWithClient creates a S3PayloadStore using a preconfigured S3 client.
+func NewS3PayloadStoreWithClient(s3Client s3iface.S3API, bucket, prefix string) *S3PayloadStore {
+	return &S3PayloadStore{
+		svc:    s3Client,
+		bucket: bucket,
+		prefix: prefix,
+	}
+}
+
+// Put stores the payload in a new object.
+func (s *S3PayloadStore) Put(ctx context.Context, payload []byte) (*PayloadPointer, error) {
+	key, err := newPayloadKey(s.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(payload),
+	}); err != nil {
+		return nil, xerrors.Errorf("sqs: unable to store payload: %w", err)
+	}
+
+	return &PayloadPointer{Bucket: s.bucket, Key: key}, nil
+}
+
+// Get returns the payload of the given object.
+func (s *S3PayloadStore) Get(ctx context.Context, pointer *PayloadPointer) ([]byte, error) {
+	key, err := s.key(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := s.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("sqs: unable to retrieve payload: %w", err)
+	}
+	defer output.Body.Close()
+
+	payload, err := ioutil.ReadAll(output.Body)
+	if err != nil {
+		return nil, xerrors.Errorf("sqs: unable to read payload: %w", err)
+	}
+
+	return payload, nil
+}
+
+// Delete removes the given object.
+func (s *S3PayloadStore) Delete(ctx context.Context, pointer *PayloadPointer) error {
+	key, err := s.key(pointer)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return xerrors.Errorf("sqs: unable to delete payload: %w", err)
+	}
+	return nil
+}
+
+// key returns the object key of the pointer, refusing pointers to another
+// bucket or outside of the store prefix.
+func (s *S3PayloadStore) key(pointer *PayloadPointer) (string, error) {
+	if pointer.Bucket != "" && pointer.Bucket != s.bucket {
+		return "", xerrors.Errorf("sqs: payload pointer references foreign bucket %q", pointer.Bucket)
+	}
+	if pointer.Key == "" || !strings.HasPrefix(pointer.Key, s.prefix) {
+		return "", xerrors.Errorf("sqs: invalid payload key %q", pointer.Key)
+	}
+	return pointer.Key, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// FilePayloadStore stores payloads as files of a local directory, it stands in
+// for S3 in tests and local environments.
+type FilePayloadStore struct {
+	dir string
+}
+
+// NewFilePayloadStore creates a FilePayloadStore writing to the given directory.
+func NewFilePayloadStore(dir string) *FilePayloadStore {
+	return &FilePayloadStore{
+		dir: dir,
+	}
+}
+
+// Put stores the payload in a new file.
+func (s *FilePayloadStore) Put(_ context.Context, payload []byte) (*PayloadPointer, error) {
+	key, err := newPayloadKey("")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(s.dir, key), payload, 0600); err != nil {
+		return nil, xerrors.Errorf("sqs: unable to store payload: %w", err)
+	}
+
+	return &PayloadPointer{Bucket: s.dir, Key: key}, nil
+}
+
+// Get returns the payload of the given file.
+func (s *FilePayloadStore) Get(_ context.Context, pointer *PayloadPointer) ([]byte, error) {
+	path, err := s.path(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("sqs: unable to retrieve payload: %w", err)
+	}
+	return payload, nil
+}
+
+// Delete removes the given file.
+func (s *FilePayloadStore) Delete(_ context.Context, pointer *PayloadPointer) error {
+	path, err := s.path(pointer)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("sqs: unable to delete payload: %w", err)
+	}
+	return nil
+}
+
+// path returns the file path of the pointer, refusing keys escaping the directory.
+func (s *FilePayloadStore) path(pointer *PayloadPointer) (string, error) {
+	if pointer.Key == "" || strings.ContainsAny(pointer.Key, `/\`) || pointer.Key == "." || pointer.Key == ".." {
+		return "", xerrors.Errorf("sqs: invalid payload key %q", pointer.Key)
+	}
+	return filepath.Join(s.dir, pointer.Key), nil
+}
+
+// -----------------------------------------------------------------------------
+
+// WithPayloadStore enables the claim-check pattern: message payloads exceeding
+// the claim-check threshold are stored in the given store and the message only
+// carries a pointer to them. Must be called before publishing.
+func (p *QueuePublisher) WithPayloadStore(store PayloadStore) *QueuePublisher {
+	p.payloads = store
+	return p
+}
+
+// storePayload moves the body of the request to the payload store and replaces
+// it with a pointer.
+func (p *QueuePublisher) storePayload(ctx context.Context, req *publishRequest) error {
+	attributes := req.entry.MessageAttributes
+	if len(attributes) >= maxMessageAttributes {
+		// Trace context is best effort, the payload attribute is not
+		delete(attributes, TraceParentAttribute)
+	}
+	if len(attributes) >= maxMessageAttributes {
+		return xerrors.Errorf("sqs: no message attribute left for %s", ExtendedPayloadSizeAttribute)
+	}
+
+	payload := aws.StringValue(req.entry.MessageBody)
+	pointer, err := p.payloads.Put(ctx, []byte(payload))
+	if err != nil {
+		return err
+	}
+
+	body, err := encodePointer(pointer)
+	if err != nil {
+		p.discardPayload(ctx, &publishRequest{payload: pointer})
+		return err
+	}
+
+	req.entry.MessageBody = aws.String(body)
+	attributes[ExtendedPayloadSizeAttribute] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("Number"),
+		StringValue: aws.String(strconv.Itoa(len(payload))),
+	}
+	req.size = entrySize(req.entry)
+	req.payload = pointer
+
+	return nil
+}
+
+// discardPayload deletes the stored payload of a request which won't be sent.
+func (p *QueuePublisher) discardPayload(ctx context.Context, req *publishRequest) {
+	if req.payload == nil {
+		return
+	}
+	if err := p.payloads.Delete(detach(ctx), req.payload); err != nil {
+		log.For(ctx).Warn("Failed to delete unsent payload", zap.String("key", req.payload.Key), zap.Error(err))
+	}
+}
+
+// WithPayloadStore enables the claim-check pattern: messages carrying the
+// ExtendedPayloadSize attribute have their payload transparently retrieved
+// from the given store, which is deleted once the message is consumed.
+func (m *QueueConsumer) WithPayloadStore(store PayloadStore) *QueueConsumer {
+	m.payloads = store
+	return m
+}
+
+// loadPayload replaces the pointer body of the message with the stored payload.
+func (m *QueueConsumer) loadPayload(ctx context.Context, message *Message) error {
+	if m.payloads == nil {
+		return nil
+	}
+	if _, ok := message.Attributes[ExtendedPayloadSizeAttribute]; !ok {
+		return nil
+	}
+
+	pointer, err := decodePointer(message.Body)
+	if err != nil {
+		return err
+	}
+	payload, err := m.payloads.Get(ctx, pointer)
+	if err != nil {
+		return err
+	}
+
+	message.Body = string(payload)
+	message.payload = pointer
+	return nil
+}
+
+// deletePayload removes the stored payload of a consumed message.
+func (m *QueueConsumer) deletePayload(ctx context.Context, message *Message) {
+	if message.payload == nil {
+		return
+	}
+	// The message is already deleted, a leftover object is only logged
+	if err := m.payloads.Delete(ctx, message.payload); err != nil {
+		log.For(ctx).Warn("Failed to delete message payload",
+			zap.String("messageID", message.ID),
+			zap.String("key", message.payload.Key),
+			zap.Error(err),
+		)
+	}
+}
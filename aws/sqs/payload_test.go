@@ -0,0 +1,228 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	pkg "github.com/scraly/go.pkg/aws/sqs"
+	sqsmock "github.com/scraly/go.pkg/aws/sqs/sqsmock"
+
+	. "github.com/onsi/gomega"
+)
+
+// s3Mock records the objects accessed through the S3 API.
+type s3Mock struct {
+	s3iface.S3API
+	accessed []string
+}
+
+func (m *s3Mock) GetObjectWithContext(_ aws.Context, input *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+	m.accessed = append(m.accessed, aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key))
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader("payload"))}, nil
+}
+
+func (m *s3Mock) DeleteObjectWithContext(_ aws.Context, input *s3.DeleteObjectInput, _ ...request.Option) (*s3.DeleteObjectOutput, error) {
+	m.accessed = append(m.accessed, aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestS3PayloadStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("OwnBucket", func(t *testing.T) {
+		g := NewWithT(t)
+
+		mock := &s3Mock{}
+		store := pkg.NewS3PayloadStoreWithClient(mock, "payloads", "sqs/")
+
+		payload, err := store.Get(ctx, &pkg.PayloadPointer{Bucket: "payloads", Key: "sqs/foo"})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(payload)).To(Equal("payload"))
+		g.Expect(store.Delete(ctx, &pkg.PayloadPointer{Key: "sqs/foo"})).To(Succeed())
+		g.Expect(mock.accessed).To(Equal([]string{"payloads/sqs/foo", "payloads/sqs/foo"}))
+	})
+
+	t.Run("ForeignBucket", func(t *testing.T) {
+		g := NewWithT(t)
+
+		mock := &s3Mock{}
+		store := pkg.NewS3PayloadStoreWithClient(mock, "payloads", "sqs/")
+
+		pointer := &pkg.PayloadPointer{Bucket: "secrets", Key: "sqs/foo"}
+		_, err := store.Get(ctx, pointer)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(store.Delete(ctx, pointer)).ToNot(Succeed())
+		g.Expect(mock.accessed).To(BeEmpty())
+	})
+
+	t.Run("KeyOutsidePrefix", func(t *testing.T) {
+		g := NewWithT(t)
+
+		mock := &s3Mock{}
+		store := pkg.NewS3PayloadStoreWithClient(mock, "payloads", "sqs/")
+
+		pointer := &pkg.PayloadPointer{Bucket: "payloads", Key: "backups/foo"}
+		_, err := store.Get(ctx, pointer)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(store.Delete(ctx, pointer)).ToNot(Succeed())
+		g.Expect(mock.accessed).To(BeEmpty())
+	})
+}
+
+func TestClaimCheck(t *testing.T) {
+	g := NewWithT(t)
+
+	dir, err := ioutil.TempDir("", "payloads")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	store := pkg.NewFilePayloadStore(dir)
+	large := strings.Repeat("x", 2048)
+
+	// Publish a small and a large message
+	publish := func() []*sqs.SendMessageBatchRequestEntry {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		requests := make(chan interface{})
+		mock := &publisherMock{}
+		go mock.serve(ctx, requests)
+
+		publisher := pkg.NewQueuePublisherWithClient(&pkg.PublisherConfiguration{
+			QueueURL:            "foo",
+			BatchSize:           2,
+			LingerTime:          time.Second,
+			ClaimCheckThreshold: 1024,
+		}, sqsmock.New(ctx, requests)).WithPayloadStore(store)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, err := publisher.Publish(ctx, &pkg.OutgoingMessage{Body: "small"})
+			g.Expect(err).ToNot(HaveOccurred())
+		}()
+		_, err := publisher.Publish(ctx, &pkg.OutgoingMessage{Body: large})
+		g.Expect(err).ToNot(HaveOccurred())
+		<-done
+		g.Expect(publisher.Close()).To(Succeed())
+
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		g.Expect(mock.batches).To(HaveLen(1))
+		return mock.batches[0]
+	}
+
+	entries := publish()
+	g.Expect(entries).To(HaveLen(2))
+
+	var small, pointer *sqs.SendMessageBatchRequestEntry
+	for _, entry := range entries {
+		if aws.StringValue(entry.MessageBody) == "small" {
+			small = entry
+		} else {
+			pointer = entry
+		}
+	}
+	g.Expect(small).ToNot(BeNil())
+	g.Expect(small.MessageAttributes).ToNot(HaveKey(pkg.ExtendedPayloadSizeAttribute))
+
+	// Large payload replaced by a pointer
+	g.Expect(pointer).ToNot(BeNil())
+	g.Expect(aws.StringValue(pointer.MessageAttributes[pkg.ExtendedPayloadSizeAttribute].StringValue)).To(Equal("2048"))
+
+	var ref pkg.PayloadPointer
+	g.Expect(json.Unmarshal([]byte(aws.StringValue(pointer.MessageBody)), &ref)).To(Succeed())
+	g.Expect(ref.Bucket).To(Equal(dir))
+	stored, err := store.Get(context.Background(), &ref)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(stored)).To(Equal(large))
+
+	received := func(id string, receiveCount string) *sqs.Message {
+		return &sqs.Message{
+			MessageId:     aws.String(id),
+			ReceiptHandle: aws.String(id),
+			Body:          pointer.MessageBody,
+			Attributes: map[string]*string{
+				sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String(receiveCount),
+			},
+			MessageAttributes: pointer.MessageAttributes,
+		}
+	}
+
+	consume := func(message *sqs.Message, handler pkg.MessageHandler) *poolMock {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		requests := make(chan interface{})
+		mock := &poolMock{batches: [][]*sqs.Message{{message}}}
+		go mock.serve(ctx, requests)
+
+		consumer := pkg.NewQueueConsumerWithClient(&pkg.Configuration{
+			QueueURL:            "foo",
+			MaxNumberOfMessages: 10,
+			VisibilityTimeout:   time.Minute,
+			HeartbeatInterval:   time.Minute,
+			DeadLetterQueueURL:  "foo-dlq",
+			MaxReceiveCount:     3,
+			NonFatal:            true,
+		}, sqsmock.New(ctx, requests)).WithPayloadStore(store)
+
+		_, err := consumer.ConsumeMessages(ctx, handler)
+		g.Expect(err).ToNot(HaveOccurred())
+		return mock
+	}
+
+	t.Run("DeadLetterKeepsPayload", func(t *testing.T) {
+		mock := consume(received("poison", "3"), func(ctx context.Context, message string) error {
+			g.Expect(message).To(Equal(large))
+			return errors.New("boom")
+		})
+
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		g.Expect(mock.deleted).To(ConsistOf("poison"))
+		g.Expect(mock.sent).To(HaveLen(1))
+		g.Expect(mock.sent[0].MessageBody).To(Equal(pointer.MessageBody))
+		g.Expect(mock.sent[0].MessageAttributes).To(HaveKey(pkg.ExtendedPayloadSizeAttribute))
+
+		_, err := store.Get(context.Background(), &ref)
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+
+	t.Run("ConsumedDeletesPayload", func(t *testing.T) {
+		var body string
+		mock := consume(received("ok", "1"), func(ctx context.Context, message string) error {
+			body = message
+			return nil
+		})
+		g.Expect(body).To(Equal(large))
+
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		g.Expect(mock.deleted).To(ConsistOf("ok"))
+
+		_, err := store.Get(context.Background(), &ref)
+		g.Expect(err).To(HaveOccurred())
+	})
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/scraly/go.pkg/log"
+)
+
+// consumeConcurrently dispatches received messages to a pool of workers.
+//
+// Each message outcome is independent: a failed message is made visible again
+// without affecting the other messages of its batch, and failures don't stop the
+// consumer. Received messages are queued for the workers with room for a full
+// batch, so the next batch is prefetched while the current one is processed.
+// Queued messages stay locked by their heartbeat until a worker picks them up.
+//
+// On context cancellation, the messages which were not picked up are released
+// immediately while in-flight messages are given the drain timeout to complete.
+func (m *QueueConsumer) consumeConcurrently(ctx context.Context, handler Handler) (int, error) {
+	var (
+		consumed int64
+		wg       sync.WaitGroup
+		jobs     = make(chan *MessageLock, m.maxNumberOfMessages)
+	)
+
+	// In-flight messages keep being processed and locked during the drain
+	workCtx, cancelWork := context.WithCancel(detach(ctx))
+	defer cancelWork()
+
+	// Start workers
+	for i := 0; i < m.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for lock := range jobs {
+				if ctx.Err() != nil {
+					// Release prefetched messages
+					_ = lock.Release(&noDelay)
+					continue
+				}
+				if result, _ := m.processMessage(workCtx, handler, lock); result == outcomeConsumed {
+					atomic.AddInt64(&consumed, 1)
+				}
+			}
+		}()
+	}
+
+	// Receive and dispatch messages
+	err := m.dispatchMessages(ctx, workCtx, jobs)
+	close(jobs)
+
+	// Wait for in-flight messages
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	if ctx.Err() != nil {
+		select {
+		case <-done:
+		case <-time.After(m.drainTimeout):
+			log.For(ctx).Warn("Drain timeout exceeded, cancelling in-flight messages",
+				zap.Duration("drainTimeout", m.drainTimeout),
+			)
+			cancelWork()
+			<-done
+		}
+	} else {
+		<-done
+	}
+
+	return int(atomic.LoadInt64(&consumed)), err
+}
+
+func (m *QueueConsumer) dispatchMessages(ctx, workCtx context.Context, jobs chan<- *MessageLock) error {
+	for {
+		result, err := m.receiveMessages(ctx)
+		if err != nil {
+			return err
+		}
+
+		if len(result.Messages) == 0 {
+			if m.forever {
+				continue
+			}
+			return nil
+		}
+
+		// Lock all messages
+		locks := NewLockManager(workCtx, m.svc, m.queue, m.visibilityTimeout, m.heartbeatInterval, result.Messages).Locks()
+
+		// Hand messages over to workers
+		for index, lock := range locks {
+			select {
+			case jobs <- lock:
+			case <-ctx.Done():
+				// Release messages which were not picked up
+				for _, pending := range locks[index:] {
+					_ = pending.Release(&noDelay)
+				}
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// detachedContext keeps the values of its parent but ignores its cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+func (c detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (c detachedContext) Done() <-chan struct{}             { return nil }
+func (c detachedContext) Err() error                        { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
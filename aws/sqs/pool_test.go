@@ -0,0 +1,276 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	pkg "github.com/scraly/go.pkg/aws/sqs"
+	sqsmock "github.com/scraly/go.pkg/aws/sqs/sqsmock"
+
+	. "github.com/onsi/gomega"
+)
+
+// poolMock replies to the SQS mock requests with the given batches and records
+// released messages.
+type poolMock struct {
+	mu          sync.Mutex
+	batches     [][]*sqs.Message
+	receives    []time.Time
+	inputs      []*sqs.ReceiveMessageInput
+	deleted     []string
+	deletions   [][]string
+	visibleZero []string
+	visibility  map[string]int64
+	sent        []*sqs.SendMessageInput
+}
+
+func (p *poolMock) serve(ctx context.Context, requests <-chan interface{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-requests:
+			p.mu.Lock()
+			switch req := req.(type) {
+			case sqsmock.ReceiveMessageRequest:
+				p.receives = append(p.receives, time.Now())
+				p.inputs = append(p.inputs, req.ReceiveMessageInput)
+				output := &sqs.ReceiveMessageOutput{}
+				if len(p.batches) > 0 {
+					output.Messages, p.batches = p.batches[0], p.batches[1:]
+				}
+				req.Reply(output, nil)
+			case sqsmock.DeleteMessageRequest:
+				p.deleted = append(p.deleted, aws.StringValue(req.ReceiptHandle))
+				req.Reply(&sqs.DeleteMessageOutput{}, nil)
+			case sqsmock.DeleteMessageBatchRequest:
+				output := &sqs.DeleteMessageBatchOutput{}
+				handles := make([]string, 0, len(req.Entries))
+				for _, entry := range req.Entries {
+					handles = append(handles, aws.StringValue(entry.ReceiptHandle))
+					output.Successful = append(output.Successful, &sqs.DeleteMessageBatchResultEntry{Id: entry.Id})
+				}
+				p.deleted = append(p.deleted, handles...)
+				p.deletions = append(p.deletions, handles)
+				req.Reply(output, nil)
+			case sqsmock.SendMessageRequest:
+				p.sent = append(p.sent, req.SendMessageInput)
+				req.Reply(&sqs.SendMessageOutput{MessageId: aws.String("dlq")}, nil)
+			case sqsmock.ChangeMessageVisibilityRequest:
+				p.changeVisibility(req.ReceiptHandle, req.VisibilityTimeout)
+				req.Reply(&sqs.ChangeMessageVisibilityOutput{}, nil)
+			case sqsmock.ChangeMessageVisibilityBatchRequest:
+				output := &sqs.ChangeMessageVisibilityBatchOutput{}
+				for _, entry := range req.Entries {
+					p.changeVisibility(entry.ReceiptHandle, entry.VisibilityTimeout)
+					output.Successful = append(output.Successful, &sqs.ChangeMessageVisibilityBatchResultEntry{Id: entry.Id})
+				}
+				req.Reply(output, nil)
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *poolMock) changeVisibility(receiptHandle *string, visibilityTimeout *int64) {
+	if p.visibility == nil {
+		p.visibility = map[string]int64{}
+	}
+	p.visibility[aws.StringValue(receiptHandle)] = aws.Int64Value(visibilityTimeout)
+	if aws.Int64Value(visibilityTimeout) == 0 {
+		p.visibleZero = append(p.visibleZero, aws.StringValue(receiptHandle))
+	}
+}
+
+func poolMessages(count int) []*sqs.Message {
+	messages := make([]*sqs.Message, count)
+	for i := range messages {
+		messages[i] = &sqs.Message{
+			MessageId:     aws.String(fmt.Sprintf("bar%d", i)),
+			ReceiptHandle: aws.String(fmt.Sprintf("baz%d", i)),
+			Body:          aws.String(fmt.Sprintf("qux%d", i)),
+		}
+	}
+	return messages
+}
+
+func TestConsumerBatchRelease(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	requests := make(chan interface{})
+	mock := &poolMock{batches: [][]*sqs.Message{poolMessages(5)}}
+	go mock.serve(ctx, requests)
+
+	consumer := pkg.NewQueueConsumerWithClient(&pkg.Configuration{
+		QueueURL:            "foo",
+		MaxNumberOfMessages: 10,
+		VisibilityTimeout:   time.Minute,
+		HeartbeatInterval:   time.Minute,
+	}, sqsmock.New(ctx, requests))
+
+	consumed, err := consumer.ConsumeMessages(ctx, func(ctx context.Context, message string) error {
+		return nil
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(consumed).To(Equal(5))
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	// The messages of a receive are deleted at once
+	g.Expect(mock.deletions).To(Equal([][]string{{"baz0", "baz1", "baz2", "baz3", "baz4"}}))
+}
+
+func TestConsumerPool(t *testing.T) {
+	t.Run("IndependentOutcomes", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		requests := make(chan interface{})
+		mock := &poolMock{batches: [][]*sqs.Message{poolMessages(5)}}
+		go mock.serve(ctx, requests)
+
+		consumer := pkg.NewQueueConsumerWithClient(&pkg.Configuration{
+			QueueURL:            "foo",
+			MaxNumberOfMessages: 10,
+			VisibilityTimeout:   time.Minute,
+			HeartbeatInterval:   time.Minute,
+			Concurrency:         3,
+			DrainTimeout:        time.Second,
+		}, sqsmock.New(ctx, requests))
+
+		var running, maxRunning int32
+		start := time.Now()
+		consumed, err := consumer.ConsumeMessages(ctx, func(ctx context.Context, message string) error {
+			current := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+					break
+				}
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			if message == "qux1" {
+				return errors.New("boom")
+			}
+			return nil
+		})
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(consumed).To(Equal(4))
+		g.Expect(atomic.LoadInt32(&maxRunning)).To(Equal(int32(3)))
+
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		g.Expect(mock.deleted).To(ConsistOf("baz0", "baz2", "baz3", "baz4"))
+		g.Expect(mock.visibleZero).To(ConsistOf("baz1"))
+
+		// The next batch is fetched while the last messages are processed
+		g.Expect(mock.receives).To(HaveLen(2))
+		g.Expect(mock.receives[1].Sub(start)).To(BeNumerically("<", 200*time.Millisecond))
+	})
+
+	t.Run("Prefetch", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		requests := make(chan interface{})
+		mock := &poolMock{batches: [][]*sqs.Message{poolMessages(4), poolMessages(4)}}
+		go mock.serve(ctx, requests)
+
+		consumer := pkg.NewQueueConsumerWithClient(&pkg.Configuration{
+			QueueURL:            "foo",
+			MaxNumberOfMessages: 4,
+			VisibilityTimeout:   time.Minute,
+			HeartbeatInterval:   time.Minute,
+			Concurrency:         2,
+			DrainTimeout:        time.Second,
+		}, sqsmock.New(ctx, requests))
+
+		start := time.Now()
+		consumed, err := consumer.ConsumeMessages(ctx, func(ctx context.Context, message string) error {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		})
+
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(consumed).To(Equal(8))
+
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+
+		// The second batch is received before the first one is processed
+		g.Expect(mock.receives).To(HaveLen(3))
+		g.Expect(mock.receives[1].Sub(start)).To(BeNumerically("<", 50*time.Millisecond))
+	})
+
+	t.Run("GracefulDrain", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		requests := make(chan interface{})
+		mock := &poolMock{batches: [][]*sqs.Message{poolMessages(4)}}
+		go mock.serve(ctx, requests)
+
+		consumer := pkg.NewQueueConsumerWithClient(&pkg.Configuration{
+			QueueURL:            "foo",
+			MaxNumberOfMessages: 10,
+			VisibilityTimeout:   time.Minute,
+			HeartbeatInterval:   time.Minute,
+			Forever:             true,
+			Concurrency:         2,
+			DrainTimeout:        time.Second,
+		}, sqsmock.New(ctx, requests))
+
+		consumerCtx, cancelConsumer := context.WithCancel(ctx)
+		started := make(chan struct{}, 4)
+
+		go func() {
+			<-started
+			<-started
+			cancelConsumer()
+		}()
+
+		consumed, err := consumer.ConsumeMessages(consumerCtx, func(ctx context.Context, message string) error {
+			started <- struct{}{}
+			time.Sleep(100 * time.Millisecond)
+			return ctx.Err()
+		})
+
+		g.Expect(err).To(MatchError(context.Canceled))
+		g.Expect(consumed).To(Equal(2))
+
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		g.Expect(mock.deleted).To(ConsistOf("baz0", "baz1"))
+		g.Expect(mock.visibleZero).To(ConsistOf("baz2", "baz3"))
+	})
+}
@@ -0,0 +1,354 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"github.com/scraly/go.pkg/log"
+)
+
+const (
+	// MaxBatchSize is the SQS-enforced maximum count of entries per batch.
+	MaxBatchSize = 10
+	// MaxBatchBytes is the SQS-enforced maximum payload size of a batch.
+	MaxBatchBytes = 256 * 1024
+	// maxMessageAttributes is the SQS-enforced maximum count of message attributes.
+	maxMessageAttributes = 10
+)
+
+var (
+	// ErrPublisherClosed is returned when publishing on a closed publisher.
+	ErrPublisherClosed = xerrors.New("sqs: publisher is closed")
+	// ErrMessageTooLarge is returned when a message exceeds the SQS size limit.
+	ErrMessageTooLarge = xerrors.New("message exceeds the SQS size limit")
+	// ErrMissingGroupID is returned when publishing to a FIFO queue without group ID.
+	ErrMissingGroupID = xerrors.New("sqs: message group ID is required for FIFO queues")
+)
+
+// PublisherConfiguration to publish to an AWS SQS queue.
+type PublisherConfiguration struct {
+	QueueURL   string        `toml:"queueURL" default:"" comment:"URL of target SQS queue"`
+	BatchSize  int           `toml:"batchSize" default:"10" comment:"Max number of messages sent per batch"`
+	LingerTime time.Duration `toml:"lingerTime" default:"50ms" comment:"Time to wait for a batch to fill up before sending it"`
+	MaxRetries int           `toml:"maxRetries" default:"3" comment:"Number of retries of failed entries"`
+	RetryDelay time.Duration `toml:"retryDelay" default:"100ms" comment:"Initial delay between retries, doubled on each attempt"`
+	// ClaimCheckThreshold only applies when a payload store is set, see WithPayloadStore.
+	ClaimCheckThreshold int `toml:"claimCheckThreshold" default:"262144" comment:"Message size above which the payload is stored outside of SQS"`
+}
+
+// OutgoingMessage is a message to publish.
+type OutgoingMessage struct {
+	Body       string
+	Attributes map[string]*sqs.MessageAttributeValue
+	// Delay is ignored by FIFO queues, which only support a queue-level delay.
+	Delay time.Duration
+	// GroupID is required for FIFO queues.
+	GroupID string
+	// DeduplicationID is optional for FIFO queues with content-based deduplication.
+	DeduplicationID string
+}
+
+type publishResult struct {
+	messageID string
+	err       error
+}
+
+type publishRequest struct {
+	entry   *sqs.SendMessageBatchRequestEntry
+	size    int
+	payload *PayloadPointer
+	result  chan publishResult
+}
+
+// QueuePublisher allows to publish messages to an AWS SQS queue.
+//
+// Messages are transparently grouped into SendMessageBatch calls.
+type QueuePublisher struct {
+	svc        sqsiface.SQSAPI
+	queue      string
+	fifo       bool
+	batchSize  int
+	lingerTime time.Duration
+	maxRetries int
+	retryDelay time.Duration
+	payloads   PayloadStore
+	threshold  int
+
+	requests chan *publishRequest
+	closing  chan struct{}
+	closed   chan struct{}
+	close    sync.Once
+	inflight sync.WaitGroup
+}
+
+// NewQueuePublisher creates a QueuePublisher from the given configuration.
+func NewQueuePublisher(conf *PublisherConfiguration, awsSession client.ConfigProvider) *QueuePublisher {
+	return NewQueuePublisherWithClient(conf, sqs.New(awsSession))
+}
+
+// NewQueuePublisherWithClient creates a QueuePublisher from the given configuration and using a
+// preconfigured SQS client.
+func NewQueuePublisherWithClient(conf *PublisherConfiguration, sqsClient sqsiface.SQSAPI) *QueuePublisher {
+	batchSize := conf.BatchSize
+	if batchSize <= 0 || batchSize > MaxBatchSize {
+		batchSize = MaxBatchSize
+	}
+
+	threshold := conf.ClaimCheckThreshold
+	if threshold <= 0 || threshold > MaxBatchBytes {
+		threshold = MaxBatchBytes
+	}
+
+	p := &QueuePublisher{
+		svc:        sqsClient,
+		queue:      conf.QueueURL,
+		fifo:       strings.HasSuffix(conf.QueueURL, ".fifo"),
+		batchSize:  batchSize,
+		lingerTime: conf.LingerTime,
+		maxRetries: conf.MaxRetries,
+		retryDelay: conf.RetryDelay,
+		threshold:  threshold,
+		requests:   make(chan *publishRequest),
+		closing:    make(chan struct{}),
+		closed:     make(chan struct{}),
+	}
+	go p.loop()
+	return p
+}
+
+// Publish the given message and return its SQS message ID.
+//
+// The call blocks until the batch containing the message is sent.
+func (p *QueuePublisher) Publish(ctx context.Context, message *OutgoingMessage) (string, error) {
+	ctx, span := trace.StartSpan(ctx, "sqs.Publish", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	span.AddAttributes(trace.StringAttribute("sqs.queue", p.queue))
+
+	req, err := p.newRequest(ctx, span.SpanContext(), message)
+	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeInvalidArgument, Message: err.Error()})
+		return "", err
+	}
+
+	// Enqueue the message
+	select {
+	case p.requests <- req:
+	case <-p.closing:
+		p.discardPayload(ctx, req)
+		return "", ErrPublisherClosed
+	case <-ctx.Done():
+		p.discardPayload(ctx, req)
+		return "", ctx.Err()
+	}
+
+	// Wait for the batch to be sent
+	select {
+	case result := <-req.result:
+		if result.err != nil {
+			span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: result.err.Error()})
+			log.For(ctx).Error("Failed to publish message", zap.String("queue", p.queue), zap.Error(result.err))
+			p.discardPayload(ctx, req)
+		}
+		return result.messageID, result.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Close flushes pending messages and stops the publisher.
+func (p *QueuePublisher) Close() error {
+	p.close.Do(func() {
+		close(p.closing)
+	})
+	<-p.closed
+	return nil
+}
+
+func (p *QueuePublisher) newRequest(ctx context.Context, sc trace.SpanContext, message *OutgoingMessage) (*publishRequest, error) {
+	if p.fifo && message.GroupID == "" {
+		return nil, ErrMissingGroupID
+	}
+
+	entry := &sqs.SendMessageBatchRequestEntry{
+		MessageBody:       aws.String(message.Body),
+		MessageAttributes: make(map[string]*sqs.MessageAttributeValue, len(message.Attributes)+1),
+	}
+	for name, value := range message.Attributes {
+		entry.MessageAttributes[name] = value
+	}
+	if len(entry.MessageAttributes) < maxMessageAttributes {
+		injectTraceContext(sc, entry.MessageAttributes)
+	}
+	if message.GroupID != "" {
+		entry.MessageGroupId = aws.String(message.GroupID)
+	}
+	if message.DeduplicationID != "" {
+		entry.MessageDeduplicationId = aws.String(message.DeduplicationID)
+	}
+	if message.Delay > 0 && !p.fifo {
+		entry.DelaySeconds = aws.Int64(int64(message.Delay / time.Second))
+	}
+
+	req := &publishRequest{
+		entry:  entry,
+		size:   entrySize(entry),
+		result: make(chan publishResult, 1),
+	}
+
+	if p.payloads != nil && req.size > p.threshold {
+		if err := p.storePayload(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.size > MaxBatchBytes {
+		p.discardPayload(ctx, req)
+		return nil, xerrors.Errorf("sqs: message of %d bytes: %w", req.size, ErrMessageTooLarge)
+	}
+
+	return req, nil
+}
+
+func (p *QueuePublisher) loop() {
+	var (
+		batch  []*publishRequest
+		size   int
+		linger <-chan time.Time
+	)
+
+	flush := func() {
+		if len(batch) > 0 {
+			p.inflight.Add(1)
+			go func(batch []*publishRequest) {
+				defer p.inflight.Done()
+				p.send(batch)
+			}(batch)
+		}
+		batch, size, linger = nil, 0, nil
+	}
+
+	for {
+		select {
+		case req := <-p.requests:
+			if len(batch) > 0 && size+req.size > MaxBatchBytes {
+				flush()
+			}
+			batch = append(batch, req)
+			size += req.size
+			if len(batch) >= p.batchSize {
+				flush()
+			} else if linger == nil {
+				linger = time.After(p.lingerTime)
+			}
+
+		case <-linger:
+			flush()
+
+		case <-p.closing:
+			flush()
+			p.inflight.Wait()
+			close(p.closed)
+			return
+		}
+	}
+}
+
+// send the batch, retrying failed entries which are not caused by the sender.
+func (p *QueuePublisher) send(batch []*publishRequest) {
+	pending := make(map[string]*publishRequest, len(batch))
+	for index, req := range batch {
+		pending[strconv.Itoa(index)] = req
+	}
+
+	delay := p.retryDelay
+	for attempt := 0; ; attempt++ {
+		entries := make([]*sqs.SendMessageBatchRequestEntry, 0, len(pending))
+		for id, req := range pending {
+			req.entry.Id = aws.String(id)
+			entries = append(entries, req.entry)
+		}
+
+		output, err := p.svc.SendMessageBatchWithContext(context.Background(), &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(p.queue),
+			Entries:  entries,
+		})
+
+		var lastErr error
+		if err != nil {
+			lastErr = xerrors.Errorf("sqs: unable to send message batch: %w", err)
+		} else {
+			for _, success := range output.Successful {
+				if req, ok := pending[aws.StringValue(success.Id)]; ok {
+					req.result <- publishResult{messageID: aws.StringValue(success.MessageId)}
+					delete(pending, aws.StringValue(success.Id))
+				}
+			}
+			for _, failure := range output.Failed {
+				req, ok := pending[aws.StringValue(failure.Id)]
+				if !ok {
+					continue
+				}
+				failureErr := xerrors.Errorf("sqs: unable to send message: %s: %s", aws.StringValue(failure.Code), aws.StringValue(failure.Message))
+				if aws.BoolValue(failure.SenderFault) {
+					// Retrying won't help
+					req.result <- publishResult{err: failureErr}
+					delete(pending, aws.StringValue(failure.Id))
+					continue
+				}
+				lastErr = failureErr
+			}
+		}
+
+		if len(pending) == 0 {
+			return
+		}
+
+		if attempt >= p.maxRetries {
+			if lastErr == nil {
+				lastErr = xerrors.New("sqs: message missing from batch response")
+			}
+			for _, req := range pending {
+				req.result <- publishResult{err: lastErr}
+			}
+			return
+		}
+
+		log.Bg().Warn("Retry sending failed batch entries",
+			zap.String("queue", p.queue),
+			zap.Int("entries", len(pending)),
+			zap.Duration("retryDelay", delay),
+			zap.Error(lastErr),
+		)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// entrySize returns the payload size of the entry as computed by SQS.
+func entrySize(entry *sqs.SendMessageBatchRequestEntry) int {
+	size := len(aws.StringValue(entry.MessageBody))
+	for name, value := range entry.MessageAttributes {
+		size += len(name) + len(aws.StringValue(value.DataType)) + len(aws.StringValue(value.StringValue)) + len(value.BinaryValue)
+	}
+	return size
+}
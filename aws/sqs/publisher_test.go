@@ -0,0 +1,201 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"golang.org/x/xerrors"
+
+	pkg "github.com/scraly/go.pkg/aws/sqs"
+	sqsmock "github.com/scraly/go.pkg/aws/sqs/sqsmock"
+
+	. "github.com/onsi/gomega"
+)
+
+// publisherMock replies to SendMessageBatch requests, failing the entries
+// whose body is registered in failures.
+type publisherMock struct {
+	mu       sync.Mutex
+	batches  [][]*sqs.SendMessageBatchRequestEntry
+	failures map[string][]bool
+}
+
+func (p *publisherMock) serve(ctx context.Context, requests <-chan interface{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-requests:
+			batch, ok := req.(sqsmock.SendMessageBatchRequest)
+			if !ok {
+				continue
+			}
+
+			p.mu.Lock()
+			p.batches = append(p.batches, batch.Entries)
+			output := &sqs.SendMessageBatchOutput{}
+			for _, entry := range batch.Entries {
+				body := aws.StringValue(entry.MessageBody)
+				if faults := p.failures[body]; len(faults) > 0 {
+					p.failures[body] = faults[1:]
+					output.Failed = append(output.Failed, &sqs.BatchResultErrorEntry{
+						Id:          entry.Id,
+						Code:        aws.String("InternalError"),
+						Message:     aws.String("boom"),
+						SenderFault: aws.Bool(faults[0]),
+					})
+					continue
+				}
+				output.Successful = append(output.Successful, &sqs.SendMessageBatchResultEntry{
+					Id:        entry.Id,
+					MessageId: aws.String("id-" + body),
+				})
+			}
+			p.mu.Unlock()
+
+			batch.Reply(output, nil)
+		}
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	newPublisher := func(ctx context.Context, queueURL string, mock *publisherMock) *pkg.QueuePublisher {
+		requests := make(chan interface{})
+		go mock.serve(ctx, requests)
+
+		return pkg.NewQueuePublisherWithClient(&pkg.PublisherConfiguration{
+			QueueURL:   queueURL,
+			BatchSize:  10,
+			LingerTime: 50 * time.Millisecond,
+			MaxRetries: 2,
+			RetryDelay: 10 * time.Millisecond,
+		}, sqsmock.New(ctx, requests))
+	}
+
+	t.Run("Batching", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		mock := &publisherMock{}
+		publisher := newPublisher(ctx, "foo", mock)
+
+		var wg sync.WaitGroup
+		ids := make([]string, 12)
+		for i := range ids {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				id, err := publisher.Publish(ctx, &pkg.OutgoingMessage{
+					Body:  fmt.Sprintf("qux%d", i),
+					Delay: 2 * time.Second,
+				})
+				g.Expect(err).ToNot(HaveOccurred())
+				ids[i] = id
+			}(i)
+		}
+		wg.Wait()
+		g.Expect(publisher.Close()).To(Succeed())
+
+		for i, id := range ids {
+			g.Expect(id).To(Equal(fmt.Sprintf("id-qux%d", i)))
+		}
+
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		g.Expect(mock.batches).To(HaveLen(2))
+		g.Expect(len(mock.batches[0]) + len(mock.batches[1])).To(Equal(12))
+
+		entry := mock.batches[0][0]
+		g.Expect(aws.Int64Value(entry.DelaySeconds)).To(Equal(int64(2)))
+		g.Expect(entry.MessageAttributes).To(HaveKey(pkg.TraceParentAttribute))
+		g.Expect(aws.StringValue(entry.MessageAttributes[pkg.TraceParentAttribute].StringValue)).To(MatchRegexp(`^00-[0-9a-f]{32}-[0-9a-f]{16}-0[01]$`))
+	})
+
+	t.Run("PartialFailures", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		mock := &publisherMock{failures: map[string][]bool{
+			"retried": {false},
+			"invalid": {true},
+			"failing": {false, false, false},
+		}}
+		publisher := newPublisher(ctx, "foo", mock)
+		defer publisher.Close()
+
+		results := map[string]error{}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, body := range []string{"ok", "retried", "invalid", "failing"} {
+			wg.Add(1)
+			go func(body string) {
+				defer wg.Done()
+				_, err := publisher.Publish(ctx, &pkg.OutgoingMessage{Body: body})
+				mu.Lock()
+				results[body] = err
+				mu.Unlock()
+			}(body)
+		}
+		wg.Wait()
+
+		g.Expect(results["ok"]).ToNot(HaveOccurred())
+		g.Expect(results["retried"]).ToNot(HaveOccurred())
+		g.Expect(results["invalid"]).To(HaveOccurred())
+		g.Expect(results["failing"]).To(HaveOccurred())
+
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		g.Expect(mock.batches).To(HaveLen(3))
+		g.Expect(mock.batches[1]).To(HaveLen(2))
+		g.Expect(mock.batches[2]).To(HaveLen(1))
+	})
+
+	t.Run("FIFO", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		mock := &publisherMock{}
+		publisher := newPublisher(ctx, "foo.fifo", mock)
+
+		_, err := publisher.Publish(ctx, &pkg.OutgoingMessage{Body: "qux"})
+		g.Expect(xerrors.Is(err, pkg.ErrMissingGroupID)).To(BeTrue())
+
+		_, err = publisher.Publish(ctx, &pkg.OutgoingMessage{Body: strings.Repeat("x", pkg.MaxBatchBytes+1), GroupID: "g"})
+		g.Expect(xerrors.Is(err, pkg.ErrMessageTooLarge)).To(BeTrue())
+
+		_, err = publisher.Publish(ctx, &pkg.OutgoingMessage{Body: "qux", GroupID: "g", DeduplicationID: "d", Delay: time.Second})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(publisher.Close()).To(Succeed())
+
+		_, err = publisher.Publish(ctx, &pkg.OutgoingMessage{Body: "qux", GroupID: "g"})
+		g.Expect(err).To(Equal(pkg.ErrPublisherClosed))
+
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		entry := mock.batches[0][0]
+		g.Expect(aws.StringValue(entry.MessageGroupId)).To(Equal("g"))
+		g.Expect(aws.StringValue(entry.MessageDeduplicationId)).To(Equal("d"))
+		g.Expect(entry.DelaySeconds).To(BeNil())
+	})
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1" // #nosec: SNS signature version 1 is SHA1 based
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrInvalidSignature is returned when the signature of an SNS notification cannot be verified.
+var ErrInvalidSignature = xerrors.New("sqs: invalid SNS signature")
+
+// snsCertificateHost matches the hosts serving SNS signing certificates.
+var snsCertificateHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// maxCertificateSize bounds the size of downloaded certificates.
+const maxCertificateSize = 64 * 1024
+
+// SNSVerifier verifies the signatures of SNS notifications.
+//
+// Signing certificates are only downloaded from SNS hosts over HTTPS, and are
+// cached by URL.
+type SNSVerifier struct {
+	client       *http.Client
+	topics       map[string]bool
+	mu           sync.RWMutex
+	certificates map[string]*x509.Certificate
+}
+
+// NewSNSVerifier creates a SNSVerifier downloading certificates with the given
+// client, a default one is used if nil.
+func NewSNSVerifier(client *http.Client) *SNSVerifier {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &SNSVerifier{
+		client:       client,
+		certificates: map[string]*x509.Certificate{},
+	}
+}
+
+// WithTopics restricts the accepted notifications to the given topic ARNs, any
+// topic is accepted when none is given. Must be called before verifying.
+func (v *SNSVerifier) WithTopics(topicArns ...string) *SNSVerifier {
+	if len(topicArns) == 0 {
+		v.topics = nil
+		return v
+	}
+	v.topics = make(map[string]bool, len(topicArns))
+	for _, topicArn := range topicArns {
+		v.topics[topicArn] = true
+	}
+	return v
+}
+
+// AddCertificate registers the certificate of the given signing certificate
+// URL, which is then not downloaded.
+func (v *SNSVerifier) AddCertificate(certURL string, certificate *x509.Certificate) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.certificates[certURL] = certificate
+}
+
+// Verify the signature of the notification.
+func (v *SNSVerifier) Verify(ctx context.Context, notification *SNSNotification) error {
+	if v.topics != nil && !v.topics[notification.TopicArn] {
+		return xerrors.Errorf("sqs: untrusted topic %q: %w", notification.TopicArn, ErrInvalidSignature)
+	}
+
+	var (
+		h       hash.Hash
+		hashing crypto.Hash
+	)
+	switch notification.SignatureVersion {
+	case "1":
+		h, hashing = sha1.New(), crypto.SHA1 // #nosec
+	case "2":
+		h, hashing = sha256.New(), crypto.SHA256
+	default:
+		return xerrors.Errorf("sqs: unsupported signature version %q: %w", notification.SignatureVersion, ErrInvalidSignature)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(notification.Signature)
+	if err != nil {
+		return xerrors.Errorf("sqs: %v: %w", err, ErrInvalidSignature)
+	}
+
+	certificate, err := v.certificate(ctx, notification.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	publicKey, ok := certificate.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return xerrors.Errorf("sqs: unexpected signing key type %T: %w", certificate.PublicKey, ErrInvalidSignature)
+	}
+
+	_, _ = h.Write([]byte(notification.stringToSign()))
+	if err := rsa.VerifyPKCS1v15(publicKey, hashing, h.Sum(nil), signature); err != nil {
+		return xerrors.Errorf("sqs: notification %s: %w", notification.MessageID, ErrInvalidSignature)
+	}
+
+	return nil
+}
+
+// certificate returns the signing certificate of the given URL.
+func (v *SNSVerifier) certificate(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	u, err := url.Parse(certURL)
+	if err != nil || u.Scheme != "https" || !snsCertificateHost.MatchString(u.Hostname()) || !strings.HasSuffix(u.Path, ".pem") {
+		return nil, xerrors.Errorf("sqs: untrusted signing certificate URL %q: %w", certURL, ErrInvalidSignature)
+	}
+
+	v.mu.RLock()
+	certificate, ok := v.certificates[certURL]
+	v.mu.RUnlock()
+	if ok {
+		return certificate, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, certURL, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("sqs: unable to download signing certificate: %w", err)
+	}
+	resp, err := v.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, xerrors.Errorf("sqs: unable to download signing certificate: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("sqs: unable to download signing certificate: unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCertificateSize+1))
+	if err != nil {
+		return nil, xerrors.Errorf("sqs: unable to download signing certificate: %w", err)
+	}
+	if len(data) > maxCertificateSize {
+		return nil, xerrors.Errorf("sqs: signing certificate exceeds %d bytes: %w", maxCertificateSize, ErrInvalidSignature)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, xerrors.Errorf("sqs: signing certificate is not PEM encoded: %w", ErrInvalidSignature)
+	}
+	certificate, err = x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, xerrors.Errorf("sqs: unable to parse signing certificate: %w", err)
+	}
+
+	v.AddCertificate(certURL, certificate)
+	return certificate, nil
+}
+
+// stringToSign returns the signed content of the notification.
+func (n *SNSNotification) stringToSign() string {
+	var b strings.Builder
+	field := func(name, value string) {
+		b.WriteString(name)
+		b.WriteByte('\n')
+		b.WriteString(value)
+		b.WriteByte('\n')
+	}
+
+	field("Message", n.Message)
+	field("MessageId", n.MessageID)
+	if n.Subject != "" {
+		field("Subject", n.Subject)
+	}
+	field("Timestamp", n.Timestamp)
+	field("TopicArn", n.TopicArn)
+	field("Type", n.Type)
+
+	return b.String()
+}
@@ -152,3 +152,163 @@ func (m *sqsMock) DeleteMessageWithContext(ctx aws.Context, input *sqs.DeleteMes
 func (m *sqsMock) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
 	return m.DeleteMessageWithContext(m.ctx, input)
 }
+
+type sendMessageBatchResponse struct {
+	output *sqs.SendMessageBatchOutput
+	err    error
+}
+
+// SendMessageBatchRequest from the SQS mock.
+type SendMessageBatchRequest struct {
+	*sqs.SendMessageBatchInput
+	response chan<- sendMessageBatchResponse
+}
+
+// Reply to a SendMessageBatchRequest from the SQS mock.
+func (r SendMessageBatchRequest) Reply(output *sqs.SendMessageBatchOutput, err error) {
+	r.response <- sendMessageBatchResponse{output, err}
+	close(r.response)
+}
+
+func (m *sqsMock) SendMessageBatchWithContext(ctx aws.Context, input *sqs.SendMessageBatchInput, options ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+	responseChan := make(chan sendMessageBatchResponse, 1)
+
+	// Send request
+	select {
+	case m.requests <- SendMessageBatchRequest{input, responseChan}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	// Receive response
+	select {
+	case response := <-responseChan:
+		return response.output, response.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *sqsMock) SendMessageBatch(input *sqs.SendMessageBatchInput) (*sqs.SendMessageBatchOutput, error) {
+	return m.SendMessageBatchWithContext(m.ctx, input)
+}
+
+type sendMessageResponse struct {
+	output *sqs.SendMessageOutput
+	err    error
+}
+
+// SendMessageRequest from the SQS mock.
+type SendMessageRequest struct {
+	*sqs.SendMessageInput
+	response chan<- sendMessageResponse
+}
+
+// Reply to a SendMessageRequest from the SQS mock.
+func (r SendMessageRequest) Reply(output *sqs.SendMessageOutput, err error) {
+	r.response <- sendMessageResponse{output, err}
+	close(r.response)
+}
+
+func (m *sqsMock) SendMessageWithContext(ctx aws.Context, input *sqs.SendMessageInput, options ...request.Option) (*sqs.SendMessageOutput, error) {
+	responseChan := make(chan sendMessageResponse, 1)
+
+	// Send request
+	select {
+	case m.requests <- SendMessageRequest{input, responseChan}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	// Receive response
+	select {
+	case response := <-responseChan:
+		return response.output, response.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *sqsMock) SendMessage(input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error) {
+	return m.SendMessageWithContext(m.ctx, input)
+}
+
+type changeMessageVisibilityBatchResponse struct {
+	output *sqs.ChangeMessageVisibilityBatchOutput
+	err    error
+}
+
+// ChangeMessageVisibilityBatchRequest from the SQS mock.
+type ChangeMessageVisibilityBatchRequest struct {
+	*sqs.ChangeMessageVisibilityBatchInput
+	response chan<- changeMessageVisibilityBatchResponse
+}
+
+// Reply to a ChangeMessageVisibilityBatchRequest from the SQS mock.
+func (r ChangeMessageVisibilityBatchRequest) Reply(output *sqs.ChangeMessageVisibilityBatchOutput, err error) {
+	r.response <- changeMessageVisibilityBatchResponse{output, err}
+	close(r.response)
+}
+
+func (m *sqsMock) ChangeMessageVisibilityBatchWithContext(ctx aws.Context, input *sqs.ChangeMessageVisibilityBatchInput, options ...request.Option) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	responseChan := make(chan changeMessageVisibilityBatchResponse, 1)
+
+	// Send request
+	select {
+	case m.requests <- ChangeMessageVisibilityBatchRequest{input, responseChan}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	// Receive response
+	select {
+	case response := <-responseChan:
+		return response.output, response.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *sqsMock) ChangeMessageVisibilityBatch(input *sqs.ChangeMessageVisibilityBatchInput) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	return m.ChangeMessageVisibilityBatchWithContext(m.ctx, input)
+}
+
+type deleteMessageBatchResponse struct {
+	output *sqs.DeleteMessageBatchOutput
+	err    error
+}
+
+// DeleteMessageBatchRequest from the SQS mock.
+type DeleteMessageBatchRequest struct {
+	*sqs.DeleteMessageBatchInput
+	response chan<- deleteMessageBatchResponse
+}
+
+// Reply to a DeleteMessageBatchRequest from the SQS mock.
+func (r DeleteMessageBatchRequest) Reply(output *sqs.DeleteMessageBatchOutput, err error) {
+	r.response <- deleteMessageBatchResponse{output, err}
+	close(r.response)
+}
+
+func (m *sqsMock) DeleteMessageBatchWithContext(ctx aws.Context, input *sqs.DeleteMessageBatchInput, options ...request.Option) (*sqs.DeleteMessageBatchOutput, error) {
+	responseChan := make(chan deleteMessageBatchResponse, 1)
+
+	// Send request
+	select {
+	case m.requests <- DeleteMessageBatchRequest{input, responseChan}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	// Receive response
+	select {
+	case response := <-responseChan:
+		return response.output, response.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *sqsMock) DeleteMessageBatch(input *sqs.DeleteMessageBatchInput) (*sqs.DeleteMessageBatchOutput, error) {
+	return m.DeleteMessageBatchWithContext(m.ctx, input)
+}
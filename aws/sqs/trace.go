@@ -0,0 +1,111 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opencensus.io/trace"
+)
+
+// TraceParentAttribute is the message attribute holding the W3C trace context
+// of the producer span.
+const TraceParentAttribute = "traceparent"
+
+// injectTraceContext adds the span context to the message attributes.
+func injectTraceContext(sc trace.SpanContext, attributes map[string]*sqs.MessageAttributeValue) {
+	attributes[TraceParentAttribute] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(FormatTraceParent(sc)),
+	}
+}
+
+// extractTraceContext returns the producer span context of the message attributes.
+func extractTraceContext(attributes map[string]*sqs.MessageAttributeValue) (trace.SpanContext, bool) {
+	attribute, ok := attributes[TraceParentAttribute]
+	if !ok || attribute == nil {
+		return trace.SpanContext{}, false
+	}
+	return ParseTraceParent(aws.StringValue(attribute.StringValue))
+}
+
+// startSpan starts the processing span of the message, continuing the producer
+// trace unless the context already holds a span, which is then linked to it.
+func (m *QueueConsumer) startSpan(ctx context.Context, message *Message) (context.Context, *trace.Span) {
+	var span *trace.Span
+	sc, remote := extractTraceContext(message.Attributes)
+	if remote && trace.FromContext(ctx) == nil {
+		ctx, span = trace.StartSpanWithRemoteParent(ctx, "sqs.Process", sc, trace.WithSpanKind(trace.SpanKindServer))
+	} else {
+		ctx, span = trace.StartSpan(ctx, "sqs.Process", trace.WithSpanKind(trace.SpanKindServer))
+		if remote {
+			span.AddLink(trace.Link{TraceID: sc.TraceID, SpanID: sc.SpanID, Type: trace.LinkTypeParent})
+		}
+	}
+
+	span.AddAttributes(
+		trace.StringAttribute("sqs.queue", m.queue),
+		trace.StringAttribute("sqs.message_id", message.ID),
+		trace.Int64Attribute("sqs.receive_count", int64(message.ReceiveCount)),
+		trace.StringAttribute("sqs.source", message.Source),
+	)
+	return ctx, span
+}
+
+// FormatTraceParent returns the W3C traceparent representation of the span context.
+func FormatTraceParent(sc trace.SpanContext) string {
+	return fmt.Sprintf("00-%s-%s-%02x",
+		hex.EncodeToString(sc.TraceID[:]),
+		hex.EncodeToString(sc.SpanID[:]),
+		uint32(sc.TraceOptions),
+	)
+}
+
+// ParseTraceParent returns the span context of the given W3C traceparent.
+func ParseTraceParent(traceParent string) (trace.SpanContext, bool) {
+	var sc trace.SpanContext
+
+	parts := strings.Split(traceParent, "-")
+	if len(parts) < 4 || parts[0] != "00" && len(parts) != 4 {
+		return sc, false
+	}
+	if len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != len(sc.TraceID) {
+		return sc, false
+	}
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != len(sc.SpanID) {
+		return sc, false
+	}
+	options, err := hex.DecodeString(parts[3])
+	if err != nil || len(options) != 1 {
+		return sc, false
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.TraceOptions = trace.TraceOptions(options[0])
+
+	// All-zero identifiers are invalid
+	if sc.TraceID == (trace.TraceID{}) || sc.SpanID == (trace.SpanID{}) {
+		return trace.SpanContext{}, false
+	}
+
+	return sc, true
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"golang.org/x/xerrors"
+)
+
+// Sources of message bodies.
+const (
+	SourceSQS         = "sqs"
+	SourceSNS         = "sns"
+	SourceEventBridge = "eventbridge"
+)
+
+// SNSNotification is the JSON wrapper of messages delivered by an SNS topic
+// without raw message delivery.
+type SNSNotification struct {
+	Type      string `json:"Type"`
+	MessageID string `json:"MessageId"`
+	TopicArn  string `json:"TopicArn"`
+	Subject   string `json:"Subject,omitempty"`
+	Message   string `json:"Message"`
+	// Timestamp is kept as sent, since it is part of the signed content.
+	Timestamp         string                  `json:"Timestamp"`
+	SignatureVersion  string                  `json:"SignatureVersion"`
+	Signature         string                  `json:"Signature"`
+	SigningCertURL    string                  `json:"SigningCertURL"`
+	UnsubscribeURL    string                  `json:"UnsubscribeURL,omitempty"`
+	MessageAttributes map[string]SNSAttribute `json:"MessageAttributes,omitempty"`
+}
+
+// SNSAttribute is a message attribute of an SNS notification.
+type SNSAttribute struct {
+	Type  string `json:"Type"`
+	Value string `json:"Value"`
+}
+
+// EventBridgeEvent is the JSON wrapper of events delivered by an EventBridge rule.
+type EventBridgeEvent struct {
+	Version    string          `json:"version"`
+	ID         string          `json:"id"`
+	DetailType string          `json:"detail-type"`
+	Source     string          `json:"source"`
+	Account    string          `json:"account"`
+	Time       time.Time       `json:"time"`
+	Region     string          `json:"region"`
+	Resources  []string        `json:"resources"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// wrapper holds the fields identifying both wrappers.
+type wrapper struct {
+	Type       string          `json:"Type"`
+	TopicArn   string          `json:"TopicArn"`
+	DetailType *string         `json:"detail-type"`
+	Source     string          `json:"source"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// WithSNSVerifier verifies the signatures of unwrapped SNS notifications with
+// the given verifier, it also enables unwrapping.
+func (m *QueueConsumer) WithSNSVerifier(verifier *SNSVerifier) *QueueConsumer {
+	m.unwrap = true
+	m.snsVerifier = verifier
+	return m
+}
+
+// unwrapMessage replaces the body of the message with the content of its SNS
+// or EventBridge wrapper, if any. SNS message attributes are merged into the
+// message attributes.
+//
+// When SNS signatures are verified, messages which are not SNS notifications
+// are rejected.
+func (m *QueueConsumer) unwrapMessage(ctx context.Context, message *Message) error {
+	if !m.unwrap {
+		return nil
+	}
+
+	var w wrapper
+	valid := json.Unmarshal([]byte(message.Body), &w) == nil
+	isNotification := valid && w.Type == "Notification" && w.TopicArn != ""
+	if m.snsVerifier != nil && !isNotification {
+		return xerrors.Errorf("sqs: message %s is not an SNS notification: %w", message.ID, ErrInvalidSignature)
+	}
+	if !valid {
+		// Not a wrapper
+		return nil
+	}
+
+	if isNotification {
+		var notification SNSNotification
+		if err := json.Unmarshal([]byte(message.Body), &notification); err != nil {
+			return xerrors.Errorf("sqs: unable to decode SNS notification: %w", err)
+		}
+		if m.snsVerifier != nil {
+			if err := m.snsVerifier.Verify(ctx, &notification); err != nil {
+				return err
+			}
+		}
+
+		attributes, err := notification.attributes()
+		if err != nil {
+			return err
+		}
+		for name, value := range message.Attributes {
+			if _, ok := attributes[name]; !ok {
+				attributes[name] = value
+			}
+		}
+
+		message.Body = notification.Message
+		message.Attributes = attributes
+		message.Source = SourceSNS
+		message.Notification = &notification
+
+		// EventBridge rules may target SNS topics
+		w = wrapper{}
+		if json.Unmarshal([]byte(message.Body), &w) != nil {
+			return nil
+		}
+	}
+
+	if w.DetailType != nil && w.Source != "" && len(w.Detail) > 0 {
+		var event EventBridgeEvent
+		if err := json.Unmarshal([]byte(message.Body), &event); err != nil {
+			return xerrors.Errorf("sqs: unable to decode EventBridge event: %w", err)
+		}
+
+		message.Body = string(event.Detail)
+		message.Source = SourceEventBridge
+		message.Event = &event
+	}
+
+	return nil
+}
+
+// attributes converts the notification attributes to SQS message attributes.
+func (n *SNSNotification) attributes() (map[string]*sqs.MessageAttributeValue, error) {
+	attributes := make(map[string]*sqs.MessageAttributeValue, len(n.MessageAttributes))
+	for name, attribute := range n.MessageAttributes {
+		value := &sqs.MessageAttributeValue{
+			DataType: aws.String(attribute.Type),
+		}
+		if attribute.Type == "Binary" {
+			data, err := base64.StdEncoding.DecodeString(attribute.Value)
+			if err != nil {
+				return nil, xerrors.Errorf("sqs: invalid binary attribute %q: %w", name, err)
+			}
+			value.BinaryValue = data
+		} else {
+			value.StringValue = aws.String(attribute.Value)
+		}
+		attributes[name] = value
+	}
+	return attributes, nil
+}
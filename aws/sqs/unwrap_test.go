@@ -0,0 +1,290 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqs_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"golang.org/x/xerrors"
+
+	pkg "github.com/scraly/go.pkg/aws/sqs"
+	sqsmock "github.com/scraly/go.pkg/aws/sqs/sqsmock"
+
+	. "github.com/onsi/gomega"
+)
+
+const (
+	testTopicArn = "arn:aws:sns:eu-west-1:123456789012:orders"
+	testCertURL  = "https://sns.eu-west-1.amazonaws.com/SimpleNotificationService-test.pem"
+)
+
+const eventBridgeEvent = `{
+	"version": "0",
+	"id": "6a7e8feb-b491-4cf7-a9f1-bf3703467718",
+	"detail-type": "OrderCreated",
+	"source": "com.example.orders",
+	"account": "123456789012",
+	"time": "2020-05-12T10:00:00Z",
+	"region": "eu-west-1",
+	"resources": [],
+	"detail": {"orderId": "42"}
+}`
+
+// signedNotification returns the body of an SNS notification signed with the given key.
+func signedNotification(t *testing.T, key *rsa.PrivateKey, message string) string {
+	notification := map[string]interface{}{
+		"Type":             "Notification",
+		"MessageId":        "sns-1",
+		"TopicArn":         testTopicArn,
+		"Subject":          "Order",
+		"Message":          message,
+		"Timestamp":        "2020-05-12T10:00:00.100Z",
+		"SignatureVersion": "2",
+		"SigningCertURL":   testCertURL,
+		"MessageAttributes": map[string]interface{}{
+			"origin":   map[string]string{"Type": "String", "Value": "sns"},
+			"priority": map[string]string{"Type": "Number", "Value": "3"},
+			"blob":     map[string]string{"Type": "Binary", "Value": base64.StdEncoding.EncodeToString([]byte{1, 2})},
+		},
+	}
+
+	if key != nil {
+		content := "Message\n" + message + "\nMessageId\nsns-1\nSubject\nOrder\nTimestamp\n2020-05-12T10:00:00.100Z\nTopicArn\n" + testTopicArn + "\nType\nNotification\n"
+		digest := sha256.Sum256([]byte(content))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		notification["Signature"] = base64.StdEncoding.EncodeToString(signature)
+	}
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func signingCertificate(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, certificate
+}
+
+func TestConsumerUnwrap(t *testing.T) {
+	newConsumer := func(ctx context.Context, conf *pkg.Configuration, mock *poolMock) *pkg.QueueConsumer {
+		requests := make(chan interface{})
+		go mock.serve(ctx, requests)
+
+		conf.QueueURL = "foo"
+		conf.MaxNumberOfMessages = 10
+		conf.VisibilityTimeout = time.Minute
+		conf.HeartbeatInterval = time.Minute
+		conf.NonFatal = true
+		return pkg.NewQueueConsumerWithClient(conf, sqsmock.New(ctx, requests))
+	}
+
+	collect := func(messages *[]*pkg.Message) pkg.Handler {
+		return func(ctx context.Context, message *pkg.Message) error {
+			*messages = append(*messages, message)
+			return nil
+		}
+	}
+
+	t.Run("Wrappers", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		mock := &poolMock{batches: [][]*sqs.Message{{
+			receivedMessage(signedNotification(t, nil, "hello"), "1"),
+			receivedMessage(eventBridgeEvent, "1"),
+			receivedMessage(signedNotification(t, nil, eventBridgeEvent), "1"),
+			receivedMessage(`{"plain":"json"}`, "1"),
+			receivedMessage("plain text", "1"),
+		}}}
+
+		var messages []*pkg.Message
+		consumed, err := newConsumer(ctx, &pkg.Configuration{Unwrap: true}, mock).Consume(ctx, collect(&messages))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(consumed).To(Equal(5))
+		g.Expect(messages).To(HaveLen(5))
+
+		// SNS notification with its original attributes
+		sns := messages[0]
+		g.Expect(sns.Body).To(Equal("hello"))
+		g.Expect(sns.Source).To(Equal(pkg.SourceSNS))
+		g.Expect(sns.Notification.TopicArn).To(Equal(testTopicArn))
+		g.Expect(sns.Notification.Subject).To(Equal("Order"))
+		origin, _ := sns.StringAttribute("origin")
+		g.Expect(origin).To(Equal("sns"))
+		priority, _ := sns.IntAttribute("priority")
+		g.Expect(priority).To(Equal(int64(3)))
+		blob, _ := sns.BinaryAttribute("blob")
+		g.Expect(blob).To(Equal([]byte{1, 2}))
+		g.Expect(sns.Attributes).To(HaveKey("origin"))
+
+		// EventBridge event
+		event := messages[1]
+		g.Expect(event.Body).To(MatchJSON(`{"orderId": "42"}`))
+		g.Expect(event.Source).To(Equal(pkg.SourceEventBridge))
+		g.Expect(event.Event.DetailType).To(Equal("OrderCreated"))
+		g.Expect(event.Event.Source).To(Equal("com.example.orders"))
+
+		// EventBridge event delivered through SNS
+		nested := messages[2]
+		g.Expect(nested.Body).To(MatchJSON(`{"orderId": "42"}`))
+		g.Expect(nested.Source).To(Equal(pkg.SourceEventBridge))
+		g.Expect(nested.Notification).ToNot(BeNil())
+		g.Expect(nested.Event).ToNot(BeNil())
+
+		// Other bodies are left untouched
+		g.Expect(messages[3].Body).To(Equal(`{"plain":"json"}`))
+		g.Expect(messages[3].Source).To(Equal(pkg.SourceSQS))
+		g.Expect(messages[4].Body).To(Equal("plain text"))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		body := signedNotification(t, nil, "hello")
+		mock := &poolMock{batches: [][]*sqs.Message{{receivedMessage(body, "1")}}}
+
+		var messages []*pkg.Message
+		_, err := newConsumer(ctx, &pkg.Configuration{}, mock).Consume(ctx, collect(&messages))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(messages).To(HaveLen(1))
+		g.Expect(messages[0].Body).To(Equal(body))
+	})
+
+	t.Run("Signatures", func(t *testing.T) {
+		g := NewWithT(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		key, certificate := signingCertificate(t)
+		_, otherCertificate := signingCertificate(t)
+
+		valid := signedNotification(t, key, "hello")
+		tampered := signedNotification(t, key, "hello")
+		tampered = tampered[:len(tampered)-1] + `,"Message":"forged"}`
+
+		mock := &poolMock{batches: [][]*sqs.Message{{
+			receivedMessage(valid, "1"),
+			receivedMessage(tampered, "1"),
+			receivedMessage(signedNotification(t, nil, "unsigned"), "1"),
+			receivedMessage(eventBridgeEvent, "1"),
+			receivedMessage(`{"plain":"json"}`, "1"),
+			receivedMessage("plain text", "1"),
+		}}}
+
+		verifier := pkg.NewSNSVerifier(nil)
+		verifier.AddCertificate(testCertURL, certificate)
+
+		var messages []*pkg.Message
+		consumed, err := newConsumer(ctx, &pkg.Configuration{}, mock).WithSNSVerifier(verifier).Consume(ctx, collect(&messages))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(consumed).To(Equal(1))
+		g.Expect(messages).To(HaveLen(1))
+		g.Expect(messages[0].Body).To(Equal("hello"))
+
+		mock.mu.Lock()
+		g.Expect(mock.deleted).To(HaveLen(1))
+		mock.mu.Unlock()
+
+		// Wrong certificate and untrusted certificate URL
+		notification := &pkg.SNSNotification{}
+		g.Expect(json.Unmarshal([]byte(valid), notification)).To(Succeed())
+
+		other := pkg.NewSNSVerifier(nil)
+		other.AddCertificate(testCertURL, otherCertificate)
+		g.Expect(xerrors.Is(other.Verify(ctx, notification), pkg.ErrInvalidSignature)).To(BeTrue())
+
+		notification.SigningCertURL = "https://example.com/SimpleNotificationService-test.pem"
+		verifier.AddCertificate(notification.SigningCertURL, certificate)
+		g.Expect(xerrors.Is(verifier.Verify(ctx, notification), pkg.ErrInvalidSignature)).To(BeTrue())
+	})
+
+	t.Run("AllowedTopics", func(t *testing.T) {
+		g := NewWithT(t)
+
+		key, certificate := signingCertificate(t)
+		notification := &pkg.SNSNotification{}
+		g.Expect(json.Unmarshal([]byte(signedNotification(t, key, "hello")), notification)).To(Succeed())
+
+		verifier := pkg.NewSNSVerifier(nil).WithTopics(testTopicArn)
+		verifier.AddCertificate(testCertURL, certificate)
+		g.Expect(verifier.Verify(context.Background(), notification)).To(Succeed())
+
+		verifier.WithTopics("arn:aws:sns:eu-west-1:123456789012:payments")
+		g.Expect(xerrors.Is(verifier.Verify(context.Background(), notification), pkg.ErrInvalidSignature)).To(BeTrue())
+	})
+
+	t.Run("OversizedCertificate", func(t *testing.T) {
+		g := NewWithT(t)
+
+		notification := &pkg.SNSNotification{}
+		g.Expect(json.Unmarshal([]byte(signedNotification(t, nil, "hello")), notification)).To(Succeed())
+		notification.Signature = base64.StdEncoding.EncodeToString([]byte("signature"))
+
+		verifier := pkg.NewSNSVerifier(&http.Client{Transport: roundTripper(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 128*1024))),
+				Request:    req,
+			}, nil
+		})})
+		err := verifier.Verify(context.Background(), notification)
+		g.Expect(xerrors.Is(err, pkg.ErrInvalidSignature)).To(BeTrue())
+		g.Expect(err.Error()).To(ContainSubstring("exceeds"))
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
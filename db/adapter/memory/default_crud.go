@@ -0,0 +1,439 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memory
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/scraly/go.pkg/db"
+
+	"github.com/jmoiron/sqlx/reflectx"
+	"golang.org/x/xerrors"
+)
+
+// Default contains an in-memory implementation of the SQL adapter interface,
+// filters, sorts and pagination are evaluated in Go.
+type Default struct {
+	table string
+	db    string
+
+	mu      sync.RWMutex
+	records []Record
+
+	mapper          *reflectx.Mapper
+	columns         []string
+	sortableColumns map[string]bool
+}
+
+// NewCRUDTable sets up a new Default struct
+func NewCRUDTable(db, table string, columns, sortable []string) *Default {
+	sortableColumns := map[string]bool{}
+	for _, column := range sortable {
+		sortableColumns[column] = true
+	}
+
+	return &Default{
+		db:              db,
+		table:           table,
+		mapper:          reflectx.NewMapper("db"),
+		columns:         columns,
+		sortableColumns: sortableColumns,
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// GetTableName returns table's name
+func (d *Default) GetTableName() string {
+	return d.table
+}
+
+// GetDBName returns database's name
+func (d *Default) GetDBName() string {
+	return d.db
+}
+
+// GetSession returns the current session
+func (d *Default) GetSession() interface{} {
+	return d
+}
+
+// Reset removes all stored records
+func (d *Default) Reset() {
+	d.mu.Lock()
+	d.records = nil
+	d.mu.Unlock()
+}
+
+// -----------------------------------------------------------------------------
+
+// Create a record
+func (d *Default) Create(_ context.Context, data interface{}) error {
+	// Extract columns and values
+	record, err := d.extractRecord(data)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.records = append(d.records, record)
+	d.mu.Unlock()
+
+	return nil
+}
+
+// WhereCount is used to cound resultset elements from the given filter
+func (d *Default) WhereCount(_ context.Context, filter interface{}) (int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	matches, err := d.where(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	// Return no error
+	return len(matches), nil
+}
+
+// WhereAndFetchOne returns only one element from the given filter
+func (d *Default) WhereAndFetchOne(_ context.Context, filter interface{}, result interface{}) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	matches, err := d.where(filter)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return db.ErrNoResult
+	}
+
+	// Decode the first match
+	return d.decode(d.records[matches[0]], reflect.ValueOf(result))
+}
+
+// Update the collection element with updates set matching the given filter
+func (d *Default) Update(_ context.Context, updates map[string]interface{}, filter interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	matches, err := d.where(filter)
+	if err != nil {
+		return err
+	}
+
+	// If no rows where affected return an handled error
+	if len(matches) == 0 {
+		return db.ErrNoModification
+	}
+
+	for _, i := range matches {
+		record := d.records[i].clone()
+		for column, value := range updates {
+			record[column] = value
+		}
+		d.records[i] = record
+	}
+
+	// Return no error
+	return nil
+}
+
+// RemoveOne is used to remove one element from the collection that match the filter
+func (d *Default) RemoveOne(_ context.Context, filter interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	matches, err := d.where(filter)
+	if err != nil {
+		return err
+	}
+
+	// If no rows where affected return an handled error
+	if len(matches) == 0 {
+		return db.ErrNoModification
+	}
+
+	// Remove matching records, like the SQL adapters do
+	removed := make(map[int]bool, len(matches))
+	for _, i := range matches {
+		removed[i] = true
+	}
+
+	records := make([]Record, 0, len(d.records)-len(matches))
+	for i, record := range d.records {
+		if !removed[i] {
+			records = append(records, record)
+		}
+	}
+	d.records = records
+
+	// Return no error
+	return nil
+}
+
+// Search for element in collection
+func (d *Default) Search(_ context.Context, filter interface{}, pagination *db.Pagination, sortParams *db.SortParameters, results interface{}) (int, error) {
+	// Check result type
+	target := reflect.ValueOf(results)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Slice {
+		return 0, xerrors.Errorf("memory: results must be a pointer to a slice, got %T", results)
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	matches, err := d.where(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	// If no result skip data request
+	count := len(matches)
+	if count == 0 {
+		return 0, db.ErrNoResult
+	}
+
+	records := make([]Record, 0, count)
+	for _, i := range matches {
+		records = append(records, d.records[i])
+	}
+
+	// Apply sort parameters
+	if sortParams != nil {
+		d.sort(records, *sortParams)
+	}
+
+	// Apply pagination on data only
+	if pagination != nil {
+		pagination.SetTotal(uint(count))
+
+		start := int(pagination.Offset())
+		end := start + int(pagination.PerPage)
+		if end > len(records) {
+			end = len(records)
+		}
+		records = records[start:end]
+	}
+
+	// Decode records
+	slice := target.Elem()
+	elemType := slice.Type().Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, len(records)))
+	for _, record := range records {
+		var item reflect.Value
+		if elemType.Kind() == reflect.Ptr {
+			item = reflect.New(elemType.Elem())
+		} else {
+			item = reflect.New(elemType)
+		}
+
+		if err := d.decode(record, item); err != nil {
+			return 0, err
+		}
+
+		if elemType.Kind() != reflect.Ptr {
+			item = item.Elem()
+		}
+		slice.Set(reflect.Append(slice, item))
+	}
+
+	// Return no error
+	return count, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// where returns the indexes of records matching the filter
+func (d *Default) where(filter interface{}) ([]int, error) {
+	var matches []int
+	for i, record := range d.records {
+		ok, err := match(filter, record)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, i)
+		}
+	}
+
+	return matches, nil
+}
+
+// sort the records according to sortable columns, ties keep insertion order
+func (d *Default) sort(records []Record, params db.SortParameters) {
+	type key struct {
+		column     string
+		descending bool
+	}
+
+	keys := make([]key, 0, len(params))
+	for _, param := range params {
+		column := ToSnakeCase(param.FieldName)
+		if !d.sortableColumns[column] {
+			continue
+		}
+		switch param.Direction {
+		case db.Ascending, db.Descending:
+			keys = append(keys, key{column: column, descending: param.Direction == db.Descending})
+		default:
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		for _, k := range keys {
+			a, b := records[i][k.column], records[j][k.column]
+
+			c, ok := compare(a, b)
+			if !ok {
+				// NULL values first in ascending order, as sorted by SQLite
+				switch {
+				case indirect(a) == nil && indirect(b) != nil:
+					c = -1
+				case indirect(a) != nil && indirect(b) == nil:
+					c = 1
+				default:
+					continue
+				}
+			}
+
+			if c == 0 {
+				continue
+			}
+			if k.descending {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// extractRecord builds a record from the tagged fields of the given struct
+func (d *Default) extractRecord(data interface{}) (Record, error) {
+	value := reflect.Indirect(reflect.ValueOf(data))
+	if value.Kind() != reflect.Struct {
+		return nil, xerrors.Errorf("memory: data must be a struct, got %T", data)
+	}
+
+	// Walk mapped fields without allocating nil pointers, so that they are
+	// stored as NULL values
+	fields := d.mapper.TypeMap(value.Type()).Names
+
+	record := make(Record, len(fields))
+	for column, fi := range fields {
+		record[column] = fieldValue(value, fi.Index)
+	}
+
+	// Return all elements
+	return record, nil
+}
+
+// decode assigns record values to the tagged fields of the given struct pointer
+func (d *Default) decode(record Record, target reflect.Value) error {
+	if target.Kind() != reflect.Ptr || target.IsNil() || target.Elem().Kind() != reflect.Struct {
+		return xerrors.Errorf("memory: result must be a pointer to a struct, got %s", target.Type())
+	}
+
+	columns := d.columns
+	if len(columns) == 0 {
+		for column := range record {
+			columns = append(columns, column)
+		}
+	}
+
+	elem := target.Elem()
+	traversals := d.mapper.TraversalsByName(elem.Type(), columns)
+	for i, column := range columns {
+		if len(traversals[i]) == 0 {
+			continue
+		}
+
+		field := reflectx.FieldByIndexes(elem, traversals[i])
+		if err := assign(field, record[column]); err != nil {
+			return xerrors.Errorf("memory: unable to decode column '%s': %w", column, err)
+		}
+	}
+
+	return nil
+}
+
+// fieldValue returns the value of the field at the given index path, nil when
+// traversing a nil pointer.
+func fieldValue(v reflect.Value, indexes []int) interface{} {
+	for _, i := range indexes {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// assign sets the value to the field, converting it when possible
+func assign(field reflect.Value, value interface{}) error {
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Type().AssignableTo(field.Type()):
+		field.Set(v)
+	case v.Type().ConvertibleTo(field.Type()):
+		field.Set(v.Convert(field.Type()))
+	case field.Kind() == reflect.Ptr && v.Type().ConvertibleTo(field.Type().Elem()):
+		ptr := reflect.New(field.Type().Elem())
+		ptr.Elem().Set(v.Convert(field.Type().Elem()))
+		field.Set(ptr)
+	case v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Type().ConvertibleTo(field.Type()):
+		field.Set(v.Elem().Convert(field.Type()))
+	case v.Kind() == reflect.Ptr && v.IsNil():
+		field.Set(reflect.Zero(field.Type()))
+	default:
+		return xerrors.Errorf("unable to assign %s to %s", v.Type(), field.Type())
+	}
+
+	return nil
+}
+
+// clone returns a shallow copy of the record
+func (r Record) clone() Record {
+	out := make(Record, len(r))
+	for k, v := range r {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,157 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/scraly/go.pkg/db"
+
+	sq "github.com/Masterminds/squirrel"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type user struct {
+	ID    int64   `db:"id"`
+	Login string  `db:"login"`
+	Age   int     `db:"age"`
+	Email *string `db:"email"`
+}
+
+func TestDefault(t *testing.T) {
+	Convey("Given an in-memory table", t, func() {
+		ctx := context.Background()
+		users := NewCRUDTable("", "users", []string{"id", "login", "age", "email"}, []string{"login", "age"})
+
+		for i, login := range []string{"alice", "bob", "carol", "dave"} {
+			So(users.Create(ctx, &user{ID: int64(i + 1), Login: login, Age: 20 + i%3}), ShouldBeNil)
+		}
+
+		Convey("When counting with filters", func() {
+			Convey("Then squirrel expressions should be evaluated", func() {
+				count, err := users.WhereCount(ctx, sq.Gt{"age": 20})
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 2)
+
+				count, err = users.WhereCount(ctx, sq.Eq{"login": []string{"alice", "dave"}})
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 2)
+
+				count, err = users.WhereCount(ctx, sq.Or{sq.Like{"login": "%o%"}, sq.And{sq.GtOrEq{"id": 4}, sq.NotEq{"age": 0}}})
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 3)
+
+				count, err = users.WhereCount(ctx, sq.Eq{"email": nil})
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 4)
+
+				count, err = users.WhereCount(ctx, Predicate(func(r Record) bool { return r["id"].(int64)%2 == 0 }))
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 2)
+			})
+
+			Convey("Then unsupported filters should be rejected", func() {
+				_, err := users.WhereCount(ctx, sq.Expr("age > ?", 20))
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When fetching one row", func() {
+			var result user
+			err := users.WhereAndFetchOne(ctx, sq.Eq{"login": "bob"}, &result)
+
+			Convey("Then the row should be decoded", func() {
+				So(err, ShouldBeNil)
+				So(result.ID, ShouldEqual, 2)
+				So(result.Age, ShouldEqual, 21)
+				So(result.Email, ShouldBeNil)
+			})
+		})
+
+		Convey("When fetching a missing row", func() {
+			var result user
+			err := users.WhereAndFetchOne(ctx, sq.Eq{"login": "eve"}, &result)
+
+			Convey("Then no result should be returned", func() {
+				So(err, ShouldEqual, db.ErrNoResult)
+			})
+		})
+
+		Convey("When updating and removing rows", func() {
+			So(users.Update(ctx, map[string]interface{}{"age": 42, "email": "alice@example.com"}, sq.Eq{"login": "alice"}), ShouldBeNil)
+			So(users.RemoveOne(ctx, sq.Eq{"login": "dave"}), ShouldBeNil)
+
+			Convey("Then changes should be visible", func() {
+				var result user
+				So(users.WhereAndFetchOne(ctx, sq.Eq{"login": "alice"}, &result), ShouldBeNil)
+				So(result.Age, ShouldEqual, 42)
+				So(*result.Email, ShouldEqual, "alice@example.com")
+
+				count, err := users.WhereCount(ctx, nil)
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 3)
+
+				So(users.Update(ctx, map[string]interface{}{"age": 1}, sq.Eq{"login": "eve"}), ShouldEqual, db.ErrNoModification)
+				So(users.RemoveOne(ctx, sq.Eq{"login": "eve"}), ShouldEqual, db.ErrNoModification)
+			})
+		})
+
+		Convey("When searching with pagination and sort", func() {
+			var results []*user
+			pagination := db.NewPaginator(1, 3)
+			sortParams := db.SortConverter([]string{"-age", "login"})
+
+			total, err := users.Search(ctx, nil, pagination, &sortParams, &results)
+
+			Convey("Then the requested page should be returned in order", func() {
+				So(err, ShouldBeNil)
+				So(total, ShouldEqual, 4)
+				So(pagination.Total(), ShouldEqual, 4)
+				So(results, ShouldHaveLength, 3)
+				So(results[0].Login, ShouldEqual, "carol")
+				So(results[1].Login, ShouldEqual, "bob")
+				So(results[2].Login, ShouldEqual, "alice")
+			})
+
+			Convey("Then the last page should contain the remaining rows", func() {
+				var last []user
+				pagination := db.NewPaginator(2, 3)
+
+				_, err := users.Search(ctx, nil, pagination, &sortParams, &last)
+				So(err, ShouldBeNil)
+				So(last, ShouldHaveLength, 1)
+				So(last[0].Login, ShouldEqual, "dave")
+			})
+		})
+
+		Convey("When searching without matches", func() {
+			var results []user
+			_, err := users.Search(ctx, sq.Eq{"login": "eve"}, nil, nil, &results)
+
+			Convey("Then no result should be returned", func() {
+				So(err, ShouldEqual, db.ErrNoResult)
+			})
+		})
+	})
+}
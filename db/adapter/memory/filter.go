@@ -0,0 +1,287 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memory
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"golang.org/x/xerrors"
+)
+
+// Record is a stored row, indexed by column name
+type Record map[string]interface{}
+
+// Predicate is a filter evaluated against each stored record
+type Predicate func(Record) bool
+
+// match evaluates the given filter against the record. Supported filters are
+// nil, Predicate, map[string]interface{} and the squirrel Eq, NotEq, Lt, LtOrEq,
+// Gt, GtOrEq, Like, NotLike, And and Or expressions.
+func match(filter interface{}, record Record) (bool, error) {
+	switch f := filter.(type) {
+	case nil:
+		return true, nil
+	case Predicate:
+		return f(record), nil
+	case func(Record) bool:
+		return f(record), nil
+	case map[string]interface{}:
+		return matchEq(f, record, false), nil
+	case sq.Eq:
+		return matchEq(f, record, false), nil
+	case sq.NotEq:
+		return matchEq(f, record, true), nil
+	case sq.Lt:
+		return matchCompare(f, record, func(c int) bool { return c < 0 })
+	case sq.LtOrEq:
+		return matchCompare(f, record, func(c int) bool { return c <= 0 })
+	case sq.Gt:
+		return matchCompare(f, record, func(c int) bool { return c > 0 })
+	case sq.GtOrEq:
+		return matchCompare(f, record, func(c int) bool { return c >= 0 })
+	case sq.Like:
+		return matchLike(f, record, false)
+	case sq.NotLike:
+		return matchLike(f, record, true)
+	case sq.And:
+		for _, cond := range f {
+			ok, err := match(cond, record)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case sq.Or:
+		for _, cond := range f {
+			ok, err := match(cond, record)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return len(f) == 0, nil
+	default:
+		return false, xerrors.Errorf("memory: unsupported filter type %T", filter)
+	}
+}
+
+// matchEq checks equality of all columns, slices are handled as IN clauses and
+// nil as IS NULL.
+func matchEq(filter map[string]interface{}, record Record, negate bool) bool {
+	for column, expected := range filter {
+		value := record[column]
+
+		var ok bool
+		if isList(expected) {
+			list := reflect.ValueOf(expected)
+			for i := 0; i < list.Len() && !ok; i++ {
+				ok = equal(value, list.Index(i).Interface())
+			}
+		} else {
+			ok = equal(value, expected)
+		}
+
+		if ok == negate {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchCompare checks the ordering of all columns
+func matchCompare(filter map[string]interface{}, record Record, accept func(int) bool) (bool, error) {
+	for column, expected := range filter {
+		c, ok := compare(record[column], expected)
+		if !ok {
+			return false, xerrors.Errorf("memory: unable to compare column '%s' with %T", column, expected)
+		}
+		if !accept(c) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// matchLike evaluates SQL LIKE patterns with % and _ wildcards
+func matchLike(filter map[string]interface{}, record Record, negate bool) (bool, error) {
+	for column, pattern := range filter {
+		p, ok := pattern.(string)
+		if !ok {
+			return false, xerrors.Errorf("memory: like pattern of column '%s' must be a string", column)
+		}
+
+		if like(fmt.Sprint(indirect(record[column])), p) == negate {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// like matches the value against the SQL pattern
+func like(value, pattern string) bool {
+	if pattern == "" {
+		return value == ""
+	}
+
+	switch pattern[0] {
+	case '%':
+		for i := 0; i <= len(value); i++ {
+			if like(value[i:], pattern[1:]) {
+				return true
+			}
+		}
+		return false
+	case '_':
+		return value != "" && like(value[1:], pattern[1:])
+	default:
+		return value != "" && value[0] == pattern[0] && like(value[1:], pattern[1:])
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// equal compares values, numbers are compared by value whatever their type
+func equal(a, b interface{}) bool {
+	a, b = indirect(a), indirect(b)
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare returns the ordering of the given values, the boolean is false when
+// the values are not comparable.
+func compare(a, b interface{}) (int, bool) {
+	a, b = indirect(a), indirect(b)
+	if a == nil || b == nil {
+		return 0, false
+	}
+
+	// Numbers
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		default:
+			return 0, true
+		}
+	}
+
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	case time.Time:
+		y, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x.Before(y):
+			return -1, true
+		case x.After(y):
+			return 1, true
+		default:
+			return 0, true
+		}
+	case bool:
+		y, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x == y:
+			return 0, true
+		case !x:
+			return -1, true
+		default:
+			return 1, true
+		}
+	}
+
+	return 0, false
+}
+
+// toFloat converts any numeric value to float64
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// indirect dereferences pointers, nil pointers become nil
+func indirect(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+	return rv.Interface()
+}
+
+// isList returns true for slices and arrays, except byte slices
+func isList(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice:
+		return rv.Type().Elem().Kind() != reflect.Uint8
+	case reflect.Array:
+		return true
+	default:
+		return false
+	}
+}
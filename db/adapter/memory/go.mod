@@ -0,0 +1,11 @@
+module github.com/scraly/go.pkg/db/adapter/memory
+
+go 1.12
+
+require (
+	github.com/scraly/go.pkg/db v0.0.8
+	github.com/Masterminds/squirrel v1.1.0
+	github.com/jmoiron/sqlx v1.2.0
+	github.com/smartystreets/goconvey v1.6.4
+	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543
+)
@@ -0,0 +1,138 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mongodb
+
+import (
+	"context"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"github.com/scraly/go.pkg/db"
+	"github.com/scraly/go.pkg/log"
+)
+
+// WithAudit records the writes executed on the collection to the given sink
+func (d *Default) WithAudit(sink db.AuditSink) *Default {
+	d.audit = sink
+	return d
+}
+
+// AuditCollection returns an audit sink inserting records in the given collection
+func AuditCollection(session *mongowrapper.WrappedClient, database, collection string) db.AuditSink {
+	return db.AuditSinkFunc(func(ctx context.Context, record *db.AuditRecord) error {
+		if _, err := session.Database(database).Collection(collection).InsertOne(ctx, bson.M{
+			"table":      record.Table,
+			"action":     string(record.Action),
+			"entity":     record.Entity,
+			"actor":      record.Actor,
+			"trace_id":   record.TraceID,
+			"before":     record.Before,
+			"after":      record.After,
+			"changes":    record.Changes,
+			"created_at": record.Timestamp,
+		}); err != nil {
+			return xerrors.Errorf("mongodb: unable to insert audit record: %w", err)
+		}
+		return nil
+	})
+}
+
+// -----------------------------------------------------------------------------
+
+// snapshot returns the documents matching the filter when the collection is
+// audited, at most db.MaxAuditedRows documents are loaded.
+func (d *Default) snapshot(ctx context.Context, c *mongowrapper.WrappedCollection, filter interface{}) ([]bson.M, error) {
+	if d.audit == nil {
+		return nil, nil
+	}
+
+	cursor, err := c.Find(ctx, filter, options.Find().SetLimit(db.MaxAuditedRows+1))
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []bson.M
+	if err := decodeAll(ctx, cursor, &documents); err != nil {
+		return nil, err
+	}
+	if len(documents) > db.MaxAuditedRows {
+		return nil, db.ErrTooManyAuditedRows
+	}
+
+	return documents, nil
+}
+
+// recordCreate sends the audit record of an inserted document
+func (d *Default) recordCreate(ctx context.Context, data interface{}) error {
+	if d.audit == nil {
+		return nil
+	}
+
+	raw, err := bson.Marshal(data)
+	if err != nil {
+		return xerrors.Errorf("mongodb: unable to encode audited document: %w", err)
+	}
+
+	var after bson.M
+	if err := bson.Unmarshal(raw, &after); err != nil {
+		return xerrors.Errorf("mongodb: unable to decode audited document: %w", err)
+	}
+
+	return db.Audit(ctx, d.audit, db.NewAuditRecord(ctx, d.table, db.AuditCreate, after["_id"], nil, after))
+}
+
+// recordUpdates sends the audit records of the updated documents, the new
+// state is read back from the collection.
+func (d *Default) recordUpdates(ctx context.Context, c *mongowrapper.WrappedCollection, before []bson.M) error {
+	for _, previous := range before {
+		var current bson.M
+		if err := c.FindOne(ctx, bson.M{"_id": previous["_id"]}).Decode(&current); err != nil {
+			log.For(ctx).Warn("Unable to read audited document back", zap.String("collection", d.table), zap.Error(err))
+		}
+
+		if err := db.Audit(ctx, d.audit, db.NewAuditRecord(ctx, d.table, db.AuditUpdate, previous["_id"], previous, current)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteAudited deletes the first document matching the filter and sends its
+// audit record.
+func (d *Default) deleteAudited(ctx context.Context, c *mongowrapper.WrappedCollection, filter interface{}) error {
+	var previous bson.M
+	if err := c.FindOneAndDelete(ctx, filter).Decode(&previous); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+
+	return db.Audit(ctx, d.audit, db.NewAuditRecord(ctx, d.table, db.AuditDelete, previous["_id"], previous, nil))
+}
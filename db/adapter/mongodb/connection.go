@@ -24,38 +24,112 @@ package mongodb
 
 import (
 	"context"
+	"strconv"
 	"time"
 
-	"github.com/scraly/go.pkg/log"
-
 	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 	"go.uber.org/zap"
 	"golang.org/x/xerrors"
+	try "gopkg.in/matryer/try.v1"
+
+	"github.com/scraly/go.pkg/log"
+	"github.com/scraly/go.pkg/tlsconfig"
 )
 
 // Configuration repesents database connection configuration
 type Configuration struct {
-	AutoMigrate      bool
-	ConnectionString string
-	DatabaseName     string
-	Username         string
-	Password         string
+	AutoMigrate            bool          `toml:"autoMigrate" default:"false" comment:"Create declared indexes on startup"`
+	DropUnmanagedIndexes   bool          `toml:"dropUnmanagedIndexes" default:"false" comment:"Drop indexes not declared by the application during migration"`
+	ConnectionString       string        `toml:"connectionString" default:"mongodb://localhost:27017" comment:"MongoDB connection URI"`
+	DatabaseName           string        `toml:"databaseName" default:"" comment:"Database name, also used as authentication database when authSource is blank"`
+	Username               string        `toml:"username" default:"" comment:"Authentication username"`
+	Password               string        `toml:"password" default:"" comment:"Authentication password"`
+	AuthSource             string        `toml:"authSource" default:"" comment:"Authentication database"`
+	MaxPoolSize            uint16        `toml:"maxPoolSize" default:"100" comment:"Maximum number of connections per server"`
+	ConnectTimeout         time.Duration `toml:"connectTimeout" default:"10s" comment:"Maximum duration to establish the connection, retries included"`
+	ServerSelectionTimeout time.Duration `toml:"serverSelectionTimeout" default:"30s" comment:"Maximum duration to find an available server for an operation"`
+	ReadPreference         string        `toml:"readPreference" default:"" comment:"Read preference (primary, primaryPreferred, secondary, secondaryPreferred, nearest), blank to use the connection string"`
+	ReadConcern            string        `toml:"readConcern" default:"" comment:"Read concern level (local, available, majority, linearizable, snapshot)"`
+	WriteConcern           string        `toml:"writeConcern" default:"" comment:"Write concern (majority or number of acknowledging members)"`
+	RetryWrites            *bool         `toml:"retryWrites" comment:"Retry write operations once on network errors, unset to use the connection string"`
+	UseTLS                 bool          `toml:"useTLS" default:"false" comment:"Enable TLS connection"`
+	TLS                    struct {
+		CertificatePath    string `toml:"certificatePath" default:"" comment:"Client certificate path"`
+		PrivateKeyPath     string `toml:"privateKeyPath" default:"" comment:"Client private key path"`
+		CACertificatePath  string `toml:"caCertificatePath" default:"" comment:"CA certificate path"`
+		InsecureSkipVerify bool   `toml:"insecureSkipVerify" default:"false" comment:"Disable server certificate verification"`
+	} `toml:"TLS" comment:"TLS settings"`
+}
+
+// Validate checks that the configuration is valid.
+func (c *Configuration) Validate() error {
+	if c.ConnectionString == "" {
+		return xerrors.New("mongodb: connection string must not be blank")
+	}
+	if _, err := c.readPreference(); err != nil {
+		return err
+	}
+	if _, err := c.readConcern(); err != nil {
+		return err
+	}
+	if _, err := c.writeConcern(); err != nil {
+		return err
+	}
+	return nil
 }
 
 // Connection provides Wire provider for a MongoDB database connection
 func Connection(ctx context.Context, cfg *Configuration) (*mongowrapper.WrappedClient, error) {
+	// Validate config first
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	opts, err := cfg.clientOptions()
+	if err != nil {
+		return nil, err
+	}
 
 	log.For(ctx).Info("Trying to connect to MongoDB servers ...")
 
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
+	timeout := cfg.ConnectTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+
+	var client *mongowrapper.WrappedClient
+	err = try.Do(func(attempt int) (bool, error) {
+		connectCtx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+
+		c, err := mongowrapper.Connect(connectCtx, opts)
+		if err != nil {
+			return false, xerrors.Errorf("mongodb: unable to initialize client: %w", err)
+		}
+
+		// Check connection
+		if err := c.Ping(connectCtx, nil); err != nil {
+			log.CheckErrCtx(ctx, "Unable to disconnect from MongoDB", c.Disconnect(ctx))
+			log.For(ctx).Warn("Unable to ping MongoDB", zap.Int("attempt", attempt), zap.Error(err))
 
-	// Extract database name from connection string
-	client, err := mongowrapper.Connect(ctx, options.Client().ApplyURI(cfg.ConnectionString))
+			retry := time.Now().Before(deadline)
+			if retry {
+				time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+			}
+			return retry, xerrors.Errorf("mongodb: unable to ping database: %w", TranslateError(err))
+		}
+
+		client = c
+		return false, nil
+	})
 	if err != nil {
 		log.For(ctx).Error("Unable to connect to MongoDB", zap.Error(err))
-		return nil, xerrors.Errorf("mongodb: %w", err)
+		return nil, xerrors.Errorf("mongodb: unable to connect to database: %w", err)
 	}
 
 	log.For(ctx).Info("Connected to MongoDB.")
@@ -63,3 +137,122 @@ func Connection(ctx context.Context, cfg *Configuration) (*mongowrapper.WrappedC
 	// Return session
 	return client, nil
 }
+
+// -----------------------------------------------------------------------------
+
+func (c *Configuration) clientOptions() (*options.ClientOptions, error) {
+	opts := options.Client().ApplyURI(c.ConnectionString)
+
+	// Overrides settings
+	if c.Username != "" {
+		authSource := c.AuthSource
+		if authSource == "" {
+			authSource = c.DatabaseName
+		}
+		opts.SetAuth(options.Credential{
+			AuthSource: authSource,
+			Username:   c.Username,
+			Password:   c.Password,
+		})
+	}
+	if c.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(c.MaxPoolSize)
+	}
+	if c.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(c.ServerSelectionTimeout)
+	}
+	if c.RetryWrites != nil {
+		opts.SetRetryWrites(*c.RetryWrites)
+	}
+
+	// Consistency settings
+	rp, err := c.readPreference()
+	if err != nil {
+		return nil, err
+	}
+	if rp != nil {
+		opts.SetReadPreference(rp)
+	}
+	rc, err := c.readConcern()
+	if err != nil {
+		return nil, err
+	}
+	if rc != nil {
+		opts.SetReadConcern(rc)
+	}
+	wc, err := c.writeConcern()
+	if err != nil {
+		return nil, err
+	}
+	if wc != nil {
+		opts.SetWriteConcern(wc)
+	}
+
+	// Enable TLS if requested
+	if c.UseTLS {
+		tlsConfig, err := tlsconfig.Client(tlsconfig.Options{
+			CAFile:             c.TLS.CACertificatePath,
+			CertFile:           c.TLS.CertificatePath,
+			KeyFile:            c.TLS.PrivateKeyPath,
+			InsecureSkipVerify: c.TLS.InsecureSkipVerify,
+		})
+		if err != nil {
+			return nil, xerrors.Errorf("mongodb: unable to initialize TLS settings: %w", err)
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	return opts, nil
+}
+
+func (c *Configuration) readPreference() (*readpref.ReadPref, error) {
+	if c.ReadPreference == "" {
+		return nil, nil
+	}
+
+	mode, err := readpref.ModeFromString(c.ReadPreference)
+	if err != nil {
+		return nil, xerrors.Errorf("mongodb: invalid read preference %q: %w", c.ReadPreference, err)
+	}
+
+	rp, err := readpref.New(mode)
+	if err != nil {
+		return nil, xerrors.Errorf("mongodb: invalid read preference %q: %w", c.ReadPreference, err)
+	}
+
+	return rp, nil
+}
+
+func (c *Configuration) readConcern() (*readconcern.ReadConcern, error) {
+	switch c.ReadConcern {
+	case "":
+		return nil, nil
+	case "local":
+		return readconcern.Local(), nil
+	case "available":
+		return readconcern.Available(), nil
+	case "majority":
+		return readconcern.Majority(), nil
+	case "linearizable":
+		return readconcern.Linearizable(), nil
+	case "snapshot":
+		return readconcern.Snapshot(), nil
+	default:
+		return nil, xerrors.Errorf("mongodb: invalid read concern %q", c.ReadConcern)
+	}
+}
+
+func (c *Configuration) writeConcern() (*writeconcern.WriteConcern, error) {
+	switch c.WriteConcern {
+	case "":
+		return nil, nil
+	case "majority":
+		return writeconcern.New(writeconcern.WMajority()), nil
+	default:
+		w, err := strconv.Atoi(c.WriteConcern)
+		if err != nil || w < 0 {
+			return nil, xerrors.Errorf("mongodb: invalid write concern %q, 'majority' or a number of members expected", c.WriteConcern)
+		}
+		return writeconcern.New(writeconcern.W(w)), nil
+	}
+}
@@ -24,13 +24,18 @@ package mongodb
 
 import (
 	"context"
+	"reflect"
+	"sync"
 
 	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
 	"golang.org/x/xerrors"
 
 	"github.com/scraly/go.pkg/db"
+	"github.com/scraly/go.pkg/db/encryption"
 	"github.com/scraly/go.pkg/log"
 )
 
@@ -39,6 +44,17 @@ type Default struct {
 	table   string
 	db      string
 	session *mongowrapper.WrappedClient
+
+	topologyMutex sync.Mutex
+	topologyKnown bool
+	transactional bool
+
+	tenants   db.TenantResolver
+	databases sync.Map
+
+	audit      db.AuditSink
+	encryption *encryption.Encryptor
+	encrypted  map[string]encryption.Mode
 }
 
 // NewCRUDTable sets up a new Default struct
@@ -50,6 +66,34 @@ func NewCRUDTable(session *mongowrapper.WrappedClient, db, table string) *Defaul
 	}
 }
 
+// NewMigratedCRUDTable sets up a new Default struct and applies the given
+// index specifications when AutoMigrate is enabled in the configuration.
+func NewMigratedCRUDTable(ctx context.Context, cfg *Configuration, session *mongowrapper.WrappedClient, database, table string, specs ...db.IndexSpec) (*Default, error) {
+	d := NewCRUDTable(session, database, table)
+	if err := d.Migrate(ctx, cfg, specs...); err != nil {
+		return nil, xerrors.Errorf("mongodb: unable to migrate table %q: %w", table, err)
+	}
+	return d, nil
+}
+
+// WithTenants routes every query to the database returned by the resolver,
+// queries are refused when no tenant is resolved.
+func (d *Default) WithTenants(resolver db.TenantResolver) *Default {
+	if resolver == nil {
+		resolver = db.ContextTenant
+	}
+	d.tenants = resolver
+	return d
+}
+
+// WithEncryption encrypts the fields of the given model marked with the
+// encrypt struct tag on write and decrypts them on read.
+func (d *Default) WithEncryption(enc *encryption.Encryptor, model interface{}) *Default {
+	d.encryption = enc.WithNameTag("bson")
+	d.encrypted = encryption.Fields(model, "bson")
+	return d
+}
+
 // -----------------------------------------------------------------------------
 
 // GetTableName returns table's name
@@ -76,147 +120,151 @@ func (d *Default) GetSession() interface{} {
 
 // Insert inserts a document into the database
 func (d *Default) Insert(ctx context.Context, data interface{}) error {
-	// Run in transaction
-	return Transaction(ctx, d.session, func() error {
-		_, err := d.session.Database(d.db).Collection(d.table).InsertOne(ctx, data)
+	data, err := d.seal(ctx, data)
+	if err != nil {
 		return err
+	}
+
+	return d.write(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
+		if _, err := c.InsertOne(ctx, data); err != nil {
+			return err
+		}
+		return d.recordCreate(ctx, data)
 	})
 }
 
 // InsertOrUpdate inserts or update document if exists
 func (d *Default) InsertOrUpdate(ctx context.Context, id interface{}, data interface{}) error {
-	// Run in transaction
-	return Transaction(ctx, d.session, func() error {
-		_, err := d.session.Database(d.db).Collection(d.table).UpdateOne(ctx, id, data)
+	data, err := d.seal(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	return d.write(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
+		_, err := c.UpdateOne(ctx, id, data)
 		return err
 	})
 }
 
 // Update performs an update on an existing resource according to passed data
 func (d *Default) Update(ctx context.Context, selector interface{}, data interface{}) error {
-	// Run in transaction
-	return Transaction(ctx, d.session, func() error {
-		_, err := d.session.Database(d.db).Collection(d.table).UpdateMany(ctx, selector, data)
+	data, err := d.seal(ctx, data)
+	if err != nil {
 		return err
+	}
+
+	return d.write(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
+		before, err := d.snapshot(ctx, c, selector)
+		if err != nil {
+			return err
+		}
+		if _, err := c.UpdateMany(ctx, selector, data); err != nil {
+			return err
+		}
+		return d.recordUpdates(ctx, c, before)
 	})
 }
 
 // UpdateID performs an update on an existing resource with ID that equals the id argument
 func (d *Default) UpdateID(ctx context.Context, id interface{}, data interface{}) error {
-	// Run in transaction
-	return Transaction(ctx, d.session, func() error {
-		_, err := d.session.Database(d.db).Collection(d.table).UpdateOne(ctx, bson.M{
-			"_id": id,
-		}, data)
+	data, err := d.seal(ctx, data)
+	if err != nil {
 		return err
+	}
+
+	return d.write(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
+		before, err := d.snapshot(ctx, c, bson.M{
+			"_id": id,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := c.UpdateOne(ctx, bson.M{
+			"_id": id,
+		}, data); err != nil {
+			return err
+		}
+		return d.recordUpdates(ctx, c, before)
 	})
 }
 
 // DeleteAll deletes resources that match the passed filter
 func (d *Default) DeleteAll(ctx context.Context, pred interface{}) error {
-	// Run in transaction
-	return Transaction(ctx, d.session, func() error {
-		_, err := d.session.Database(d.db).Collection(d.table).DeleteMany(ctx, pred)
+	return d.write(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
+		_, err := c.DeleteMany(ctx, pred)
 		return err
 	})
 }
 
 // Delete deletes a resource with specified ID
 func (d *Default) Delete(ctx context.Context, id interface{}) error {
-	// Run in transaction
-	return Transaction(ctx, d.session, func() error {
-		_, err := d.session.Database(d.db).Collection(d.table).DeleteOne(ctx, id)
+	return d.write(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
+		if d.audit != nil {
+			return d.deleteAudited(ctx, c, id)
+		}
+		_, err := c.DeleteOne(ctx, id)
 		return err
 	})
 }
 
 // Find searches for a resource in the database and then returns a cursor
 func (d *Default) Find(ctx context.Context, id interface{}, value interface{}) error {
-	// Run in transaction
-	return Transaction(ctx, d.session, func() error {
-		res, err := d.session.Database(d.db).Collection(d.table).Find(ctx, bson.M{
+	return d.read(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
+		return d.decrypt(ctx, value, decodeOne(c.FindOne(ctx, bson.M{
 			"_id": id,
-		})
-		if err != nil {
-			return err
-		}
-		return res.Decode(value)
+		}), value))
 	})
 }
 
 // FindFetchOne searches for a resource and then unmarshals the first row into value
 func (d *Default) FindFetchOne(ctx context.Context, id string, value interface{}) error {
-	// Run in transaction
-	return Transaction(ctx, d.session, func() error {
-		res := d.session.Database(d.db).Collection(d.table).FindOne(ctx, id)
-		return res.Decode(value)
+	return d.read(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
+		return d.decrypt(ctx, value, decodeOne(c.FindOne(ctx, bson.M{
+			"_id": id,
+		}), value))
 	})
 }
 
 // FindOneBy is an utility for fetching values if they are stored in a key-value manenr.
 func (d *Default) FindOneBy(ctx context.Context, key string, value interface{}, result interface{}) error {
-	// Run in transaction
-	return Transaction(ctx, d.session, func() error {
-		res := d.session.Database(d.db).Collection(d.table).FindOne(ctx, bson.M{
+	return d.read(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
+		return d.decrypt(ctx, result, decodeOne(c.FindOne(ctx, bson.M{
 			key: value,
-		})
-		return res.Decode(result)
+		}), result))
 	})
 }
 
 // FindBy is an utility for fetching values if they are stored in a key-value manenr.
 func (d *Default) FindBy(ctx context.Context, key string, value interface{}, results interface{}) error {
-	// Run in transaction
-	return Transaction(ctx, d.session, func() error {
-		res, err := d.session.Database(d.db).Collection(d.table).Find(ctx, bson.M{
+	return d.read(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
+		res, err := c.Find(ctx, bson.M{
 			key: value,
 		})
 		if err != nil {
 			return err
 		}
-		return res.Decode(results)
+		return d.decrypt(ctx, results, decodeAll(ctx, res, results))
 	})
 }
 
 // FindByAndCount returns the number of elements that match the filter
 func (d *Default) FindByAndCount(ctx context.Context, key string, value interface{}) (int64, error) {
-	var count int64
-
-	// Run in transaction
-	if err := Transaction(ctx, d.session, func() error {
-		n, err := d.session.Database(d.db).Collection(d.table).CountDocuments(ctx, bson.M{
-			key: value,
-		})
-		count = n
-		return err
-	}); err != nil {
-		return count, err
-	}
-
-	return count, nil
+	return d.WhereCount(ctx, bson.M{
+		key: value,
+	})
 }
 
 // FindByAndFetch retrieves a value by key and then fills results with the result.
 func (d *Default) FindByAndFetch(ctx context.Context, key string, value interface{}, results interface{}) error {
-	// Run in transaction
-	return Transaction(ctx, d.session, func() error {
-		res, err := d.session.Database(d.db).Collection(d.table).Find(ctx, bson.M{
-			key: value,
-		})
-		if err != nil {
-			return err
-		}
-		return res.Decode(results)
-	})
+	return d.FindBy(ctx, key, value, results)
 }
 
 // WhereCount allows counting with multiple fields
 func (d *Default) WhereCount(ctx context.Context, filter interface{}) (int64, error) {
 	var count int64
 
-	// Run in transaction
-	if err := Transaction(ctx, d.session, func() error {
-		n, err := d.session.Database(d.db).Collection(d.table).CountDocuments(ctx, filter)
+	if err := d.read(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
+		n, err := c.CountDocuments(ctx, filter)
 		count = n
 		return err
 	}); err != nil {
@@ -228,50 +276,51 @@ func (d *Default) WhereCount(ctx context.Context, filter interface{}) (int64, er
 
 // Where allows filtering with multiple fields
 func (d *Default) Where(ctx context.Context, filter interface{}, results interface{}) error {
-	// Run in transaction
-	return Transaction(ctx, d.session, func() error {
-		res, err := d.session.Database(d.db).Collection(d.table).Find(ctx, filter)
+	return d.read(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
+		res, err := c.Find(ctx, filter)
 		if err != nil {
 			return err
 		}
-		return res.Decode(results)
+		return d.decrypt(ctx, results, decodeAll(ctx, res, results))
 	})
 }
 
 // WhereAndFetchLimit filters with multiple fields and then fills results with all found resources
 func (d *Default) WhereAndFetchLimit(ctx context.Context, filter interface{}, paginator *db.Pagination, results interface{}) error {
-	// Run in transaction
-	return Transaction(ctx, d.session, func() error {
+	return d.read(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
 		limit := int64(paginator.PerPage)
 		skip := int64(paginator.Offset())
-		res, err := d.session.Database(d.db).Collection(d.table).Find(ctx, filter, &options.FindOptions{
+		res, err := c.Find(ctx, filter, &options.FindOptions{
 			Limit: &limit,
 			Skip:  &skip,
 		})
 		if err != nil {
 			return err
 		}
-		return res.Decode(results)
+		return d.decrypt(ctx, results, decodeAll(ctx, res, results))
 	})
 }
 
 // WhereAndFetchOne filters with multiple fields and then fills result with the first found resource
 func (d *Default) WhereAndFetchOne(ctx context.Context, filter interface{}, result interface{}) error {
-	// Run in transaction
-	return Transaction(ctx, d.session, func() error {
-		res := d.session.Database(d.db).Collection(d.table).FindOne(ctx, filter)
-		return res.Decode(result)
+	return d.read(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
+		return d.decrypt(ctx, result, decodeOne(c.FindOne(ctx, filter), result))
 	})
 }
 
 // List all entities from the database
 func (d *Default) List(ctx context.Context, results interface{}, sortParams *db.SortParameters, pagination *db.Pagination) error {
-	// Run in transaction
 	return d.Search(ctx, results, bson.M{}, sortParams, pagination)
 }
 
 // Search all entities from the database
 func (d *Default) Search(ctx context.Context, results interface{}, filter interface{}, sortParams *db.SortParameters, pagination *db.Pagination) error {
+	return d.SearchWithProjection(ctx, results, filter, nil, sortParams, pagination)
+}
+
+// SearchWithProjection searches all entities from the database and only
+// returns fields selected by the given projection.
+func (d *Default) SearchWithProjection(ctx context.Context, results interface{}, filter interface{}, projection interface{}, sortParams *db.SortParameters, pagination *db.Pagination) error {
 	// Apply Filter
 	if filter == nil {
 		filter = bson.M{}
@@ -281,17 +330,22 @@ func (d *Default) Search(ctx context.Context, results interface{}, filter interf
 	if pagination != nil {
 		total, err := d.WhereCount(ctx, filter)
 		if err != nil {
-			return xerrors.Errorf("mongodb: %w", err)
+			return err
 		}
 		pagination.SetTotal(uint(total))
 	}
 
 	// Prepare the query
-	opts := &options.FindOptions{}
+	opts := options.Find()
+
+	// Apply projection
+	if projection != nil {
+		opts.SetProjection(projection)
+	}
 
 	// Apply sorts
 	if sortParams != nil {
-		sort := ConvertSortParameters(*sortParams)
+		sort := ConvertSortDocument(*sortParams)
 		if len(sort) > 0 {
 			opts.SetSort(sort)
 		}
@@ -303,47 +357,244 @@ func (d *Default) Search(ctx context.Context, results interface{}, filter interf
 		opts.SetSkip(int64(pagination.Offset()))
 	}
 
-	return Transaction(ctx, d.session, func() error {
-		res, err := d.session.Database(d.db).Collection(d.table).Find(ctx, filter, opts)
+	return d.read(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
+		res, err := c.Find(ctx, filter, opts)
 		if err != nil {
 			return err
 		}
-		return res.Decode(results)
+		return d.decrypt(ctx, results, decodeAll(ctx, res, results))
+	})
+}
+
+// Aggregate searches all entities from the database using an aggregation
+// pipeline, the total count and the requested page are retrieved in one round
+// trip using a $facet stage.
+func (d *Default) Aggregate(ctx context.Context, results interface{}, filter interface{}, projection interface{}, sortParams *db.SortParameters, pagination *db.Pagination) error {
+	// Apply Filter
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+	}
+
+	// Apply sorts
+	if sortParams != nil {
+		sort := ConvertSortDocument(*sortParams)
+		if len(sort) > 0 {
+			pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sort}})
+		}
+	}
+
+	// Build the page stages
+	page := bson.A{}
+	if pagination != nil {
+		page = append(page,
+			bson.D{{Key: "$skip", Value: int64(pagination.Offset())}},
+			bson.D{{Key: "$limit", Value: int64(pagination.PerPage)}},
+		)
+	}
+	if projection != nil {
+		page = append(page, bson.D{{Key: "$project", Value: projection}})
+	}
+	if len(page) == 0 {
+		// $facet requires at least one stage per output field
+		page = append(page, bson.D{{Key: "$skip", Value: int64(0)}})
+	}
+
+	pipeline = append(pipeline, bson.D{{Key: "$facet", Value: bson.D{
+		{Key: "total", Value: bson.A{bson.D{{Key: "$count", Value: "count"}}}},
+		{Key: "page", Value: page},
+	}}})
+
+	return d.read(ctx, func(ctx context.Context, c *mongowrapper.WrappedCollection) error {
+		res, err := c.Aggregate(ctx, pipeline)
+		if err != nil {
+			return err
+		}
+
+		var facets []struct {
+			Total []struct {
+				Count int64 `bson:"count"`
+			} `bson:"total"`
+			Page []bson.Raw `bson:"page"`
+		}
+		if err := decodeAll(ctx, res, &facets); err != nil {
+			return err
+		}
+		if len(facets) == 0 {
+			return db.ErrNoResult
+		}
+
+		// Set total
+		if pagination != nil {
+			total := int64(0)
+			if len(facets[0].Total) > 0 {
+				total = facets[0].Total[0].Count
+			}
+			pagination.SetTotal(uint(total))
+		}
+
+		return d.decrypt(ctx, results, decodeRaws(facets[0].Page, results))
 	})
 }
 
 // -----------------------------------------------------------------------------
 
-// TransactionFunc is the transaction handler closure contract
-type TransactionFunc func() error
+type operation func(ctx context.Context, c *mongowrapper.WrappedCollection) error
+
+// collection returns the collection of the tenant attached to the context,
+// database handles are cached per tenant.
+func (d *Default) collection(ctx context.Context) (*mongowrapper.WrappedCollection, error) {
+	if d.tenants == nil {
+		return d.session.Database(d.db).Collection(d.table), nil
+	}
+
+	name, err := d.tenants(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("mongodb: unable to resolve tenant: %w", err)
+	}
+
+	database, ok := d.databases.Load(name)
+	if !ok {
+		database, _ = d.databases.LoadOrStore(name, d.session.Database(name))
+	}
+
+	return database.(*mongowrapper.WrappedDatabase).Collection(d.table), nil
+}
+
+// read runs a read operation, in a transaction only if the caller requested it.
+func (d *Default) read(ctx context.Context, fn operation) error {
+	c, err := d.collection(ctx)
+	if err != nil {
+		return err
+	}
+
+	if transactionRequested(ctx) {
+		return TransactionWithContext(ctx, d.session, func(ctx context.Context) error {
+			return fn(ctx, c)
+		})
+	}
+
+	if err := fn(ctx, c); err != nil {
+		return wrapError(err)
+	}
+
+	return nil
+}
+
+// write runs a write operation, in a transaction if the caller requested it or
+// if the server topology supports it.
+func (d *Default) write(ctx context.Context, fn operation) error {
+	c, err := d.collection(ctx)
+	if err != nil {
+		return err
+	}
+
+	if transactionRequested(ctx) || d.supportsTransactions(ctx) {
+		return TransactionWithContext(ctx, d.session, func(ctx context.Context) error {
+			return fn(ctx, c)
+		})
+	}
+
+	if err := fn(ctx, c); err != nil {
+		return wrapError(err)
+	}
 
-// Transaction runs the transactionfunc in a transaction
-func Transaction(ctx context.Context, client *mongowrapper.WrappedClient, fn TransactionFunc) error {
-	// Initialize a session
-	session, err := client.StartSession()
+	return nil
+}
+
+// supportsTransactions detects the server topology once, failed detections are
+// not cached so that they are retried on the next write.
+func (d *Default) supportsTransactions(ctx context.Context) bool {
+	d.topologyMutex.Lock()
+	defer d.topologyMutex.Unlock()
+
+	if d.topologyKnown {
+		return d.transactional
+	}
+
+	supported, err := detectTransactions(ctx, d.session)
 	if err != nil {
-		return xerrors.Errorf("mongodb: %w", err)
+		log.For(ctx).Warn("Unable to detect MongoDB topology, transactions disabled", zap.Error(err))
+		return false
+	}
+	d.topologyKnown, d.transactional = true, supported
+
+	return supported
+}
+
+func wrapError(err error) error {
+	if xerrors.Is(err, db.ErrNoResult) {
+		return err
+	}
+	return xerrors.Errorf("mongodb: %w", TranslateError(err))
+}
+
+func decodeOne(res *mongo.SingleResult, result interface{}) error {
+	if err := res.Decode(result); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return db.ErrNoResult
+		}
+		return err
 	}
-	defer session.EndSession(ctx)
+	return nil
+}
 
-	// Start transaction
-	if err := session.StartTransaction(); err != nil {
-		return xerrors.Errorf("mongodb: %w", err)
+// decodeAll iterates over the cursor and appends each document to the results slice.
+func decodeAll(ctx context.Context, cursor *mongo.Cursor, results interface{}) error {
+	defer func() {
+		log.CheckErrCtx(ctx, "Unable to close cursor", cursor.Close(ctx))
+	}()
+
+	slice, err := resultSlice(results)
+	if err != nil {
+		return err
 	}
 
-	// Run the closure
-	if err := fn(); err != nil {
-		log.CheckErrCtx(ctx, "Unable to abort transaction", session.AbortTransaction(ctx))
-		return xerrors.Errorf("mongodb: %w", err)
+	elemType := slice.Type().Elem()
+	values := slice.Slice(0, 0)
+	for cursor.Next(ctx) {
+		elem := reflect.New(elemType)
+		if err := cursor.Decode(elem.Interface()); err != nil {
+			return err
+		}
+		values = reflect.Append(values, elem.Elem())
+	}
+	if err := cursor.Err(); err != nil {
+		return err
 	}
 
-	// Commit the transaction
-	err = session.CommitTransaction(ctx)
+	slice.Set(values)
+	return nil
+}
+
+// decodeRaws decodes all raw documents into the results slice.
+func decodeRaws(raws []bson.Raw, results interface{}) error {
+	slice, err := resultSlice(results)
 	if err != nil {
-		log.CheckErrCtx(ctx, "Unable to abort transaction", session.AbortTransaction(ctx))
-		return xerrors.Errorf("mongodb: %w", err)
+		return err
+	}
+
+	elemType := slice.Type().Elem()
+	values := reflect.MakeSlice(slice.Type(), 0, len(raws))
+	for _, raw := range raws {
+		elem := reflect.New(elemType)
+		if err := bson.Unmarshal(raw, elem.Interface()); err != nil {
+			return err
+		}
+		values = reflect.Append(values, elem.Elem())
 	}
 
-	// No error
+	slice.Set(values)
 	return nil
 }
+
+func resultSlice(results interface{}) (reflect.Value, error) {
+	value := reflect.ValueOf(results)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Slice {
+		return reflect.Value{}, xerrors.New("results argument must be a slice address")
+	}
+	return value.Elem(), nil
+}
@@ -0,0 +1,109 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mongodb
+
+import (
+	"context"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/xerrors"
+)
+
+// seal encrypts the sensitive fields of a document or of the $set and
+// $setOnInsert operators of an update document.
+func (d *Default) seal(ctx context.Context, data interface{}) (interface{}, error) {
+	if d.encryption == nil {
+		return data, nil
+	}
+
+	var (
+		sealed interface{}
+		err    error
+	)
+	switch doc := data.(type) {
+	case bson.M:
+		sealed, err = d.sealMap(ctx, doc)
+	case map[string]interface{}:
+		sealed, err = d.sealMap(ctx, doc)
+	default:
+		sealed, err = d.encryption.Seal(ctx, data)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("mongodb: unable to encrypt document: %w", err)
+	}
+
+	return sealed, nil
+}
+
+func (d *Default) sealMap(ctx context.Context, doc map[string]interface{}) (map[string]interface{}, error) {
+	sealed := make(map[string]interface{}, len(doc))
+
+	for key, value := range doc {
+		if !strings.HasPrefix(key, "$") {
+			// Plain document
+			return d.encryption.SealMap(ctx, doc, d.encrypted)
+		}
+
+		switch key {
+		case "$set", "$setOnInsert":
+			var fields map[string]interface{}
+			switch v := value.(type) {
+			case bson.M:
+				fields = v
+			case map[string]interface{}:
+				fields = v
+			default:
+				var err error
+				if value, err = d.encryption.Seal(ctx, value); err != nil {
+					return nil, err
+				}
+				sealed[key] = value
+				continue
+			}
+
+			values, err := d.encryption.SealMap(ctx, fields, d.encrypted)
+			if err != nil {
+				return nil, err
+			}
+			sealed[key] = values
+		default:
+			sealed[key] = value
+		}
+	}
+
+	return sealed, nil
+}
+
+// decrypt the sensitive fields of the given result once decoded
+func (d *Default) decrypt(ctx context.Context, result interface{}, err error) error {
+	if err != nil || d.encryption == nil {
+		return err
+	}
+
+	if err := d.encryption.Open(ctx, result); err != nil {
+		return xerrors.Errorf("mongodb: unable to decrypt result: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mongodb
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/scraly/go.pkg/db"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+	"golang.org/x/xerrors"
+)
+
+const (
+	codeMaxTimeMSExpired          = 50
+	codeWriteConflict             = 112
+	codeDocumentValidationFailure = 121
+)
+
+var (
+	// duplicateKeyIndex extracts the index name from E11000 error messages
+	duplicateKeyIndex = regexp.MustCompile(`index: (\S+) dup key`)
+	// duplicateKeyField extracts the first field name from E11000 error messages
+	duplicateKeyField = regexp.MustCompile(`dup key: \{ ?"?([^:" ]+)"?:`)
+)
+
+// TranslateError classifies MongoDB driver errors as db errors, unknown errors
+// are returned unchanged.
+func TranslateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// Already classified
+	var dbErr *db.Error
+	if xerrors.As(err, &dbErr) {
+		return err
+	}
+
+	var (
+		writeErr mongo.WriteException
+		bulkErr  mongo.BulkWriteException
+		cmdErr   mongo.CommandError
+		netErr   net.Error
+	)
+
+	switch {
+	case xerrors.As(err, &writeErr):
+		for _, we := range writeErr.WriteErrors {
+			if kind := classifyCode(we.Code); kind != nil {
+				return newError(kind, we.Message, err)
+			}
+		}
+		if wce := writeErr.WriteConcernError; wce != nil {
+			if kind := classifyCode(wce.Code); kind != nil {
+				return newError(kind, wce.Message, err)
+			}
+		}
+	case xerrors.As(err, &bulkErr):
+		for _, we := range bulkErr.WriteErrors {
+			if kind := classifyCode(we.Code); kind != nil {
+				return newError(kind, we.Message, err)
+			}
+		}
+	case xerrors.As(err, &cmdErr):
+		if kind := classifyCode(int(cmdErr.Code)); kind != nil {
+			return newError(kind, cmdErr.Message, err)
+		}
+		switch {
+		case cmdErr.HasErrorLabel("TransientTransactionError"):
+			return db.NewError(db.ErrSerialization, "", "", err)
+		case cmdErr.HasErrorLabel("NetworkError"):
+			return db.NewError(db.ErrConnection, "", "", err)
+		}
+	case xerrors.Is(err, context.DeadlineExceeded):
+		return db.NewError(db.ErrTimeout, "", "", err)
+	case xerrors.Is(err, mongo.ErrClientDisconnected), xerrors.Is(err, topology.ErrTopologyClosed):
+		return db.NewError(db.ErrConnection, "", "", err)
+	case strings.Contains(err.Error(), topology.ErrServerSelectionTimeout.Error()):
+		// Server selection errors are flattened by the driver
+		return db.NewError(db.ErrConnection, "", "", err)
+	case xerrors.As(err, &netErr):
+		if netErr.Timeout() {
+			return db.NewError(db.ErrTimeout, "", "", err)
+		}
+		return db.NewError(db.ErrConnection, "", "", err)
+	}
+
+	return err
+}
+
+// classifyCode returns the db error kind of the given server error code
+func classifyCode(code int) error {
+	switch code {
+	case 11000, 11001, 12582:
+		return db.ErrDuplicateKey
+	case codeDocumentValidationFailure:
+		return db.ErrCheckViolation
+	case codeWriteConflict:
+		return db.ErrSerialization
+	case codeMaxTimeMSExpired:
+		return db.ErrTimeout
+	default:
+		return nil
+	}
+}
+
+// newError builds a classified error, extracting the index and field names
+// from duplicate key messages.
+func newError(kind error, message string, err error) error {
+	var index, field string
+	if kind == db.ErrDuplicateKey {
+		if m := duplicateKeyIndex.FindStringSubmatch(message); m != nil {
+			index = m[1]
+		}
+		if m := duplicateKeyField.FindStringSubmatch(message); m != nil {
+			field = m[1]
+		}
+	}
+
+	return db.NewError(kind, index, field, err)
+}
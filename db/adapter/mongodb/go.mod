@@ -6,7 +6,9 @@ replace github.com/opencensus-integrations/gomongowrapper => github.com/Zenithar
 
 require (
 	github.com/scraly/go.pkg/db v0.0.8
+	github.com/scraly/go.pkg/db/encryption v0.0.1
 	github.com/scraly/go.pkg/log v0.0.12
+	github.com/scraly/go.pkg/tlsconfig v0.0.4
 	github.com/aws/aws-sdk-go v1.19.15 // indirect
 	github.com/golang/snappy v0.0.1 // indirect
 	github.com/gopherjs/gopherjs v0.0.0-20190411002643-bd77b112433e // indirect
@@ -18,4 +20,5 @@ require (
 	golang.org/x/oauth2 v0.0.0-20190402181905-9f3314589c9a // indirect
 	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543
 	google.golang.org/appengine v1.5.0 // indirect
+	gopkg.in/matryer/try.v1 v1.0.0-20150601225556-312d2599e12e
 )
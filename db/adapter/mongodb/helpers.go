@@ -26,10 +26,14 @@ import (
 	"fmt"
 	"strings"
 
+	"go.mongodb.org/mongo-driver/bson"
+
 	"github.com/scraly/go.pkg/db"
 )
 
 // ConvertSortParameters to sql query string
+//
+// Deprecated: the MongoDB driver expects a sort document, use ConvertSortDocument.
 func ConvertSortParameters(params db.SortParameters) []string {
 	sorts := make([]string, 0, len(params))
 
@@ -46,3 +50,19 @@ func ConvertSortParameters(params db.SortParameters) []string {
 
 	return sorts
 }
+
+// ConvertSortDocument converts sort parameters to a MongoDB sort document
+func ConvertSortDocument(params db.SortParameters) bson.D {
+	sorts := make(bson.D, 0, len(params))
+
+	for _, param := range params {
+		switch param.Direction {
+		case db.Descending:
+			sorts = append(sorts, bson.E{Key: strings.ToLower(param.FieldName), Value: -1})
+		default:
+			sorts = append(sorts, bson.E{Key: strings.ToLower(param.FieldName), Value: 1})
+		}
+	}
+
+	return sorts
+}
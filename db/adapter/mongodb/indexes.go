@@ -0,0 +1,295 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mongodb
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"github.com/scraly/go.pkg/db"
+	"github.com/scraly/go.pkg/log"
+)
+
+// primaryIndexName is the name of the mandatory _id index
+const primaryIndexName = "_id_"
+
+// indexDescription is an index as returned by listIndexes
+type indexDescription struct {
+	Name                    string   `bson:"name"`
+	Key                     bson.D   `bson:"key"`
+	Unique                  bool     `bson:"unique,omitempty"`
+	Sparse                  bool     `bson:"sparse,omitempty"`
+	ExpireAfterSeconds      *int32   `bson:"expireAfterSeconds,omitempty"`
+	PartialFilterExpression bson.Raw `bson:"partialFilterExpression,omitempty"`
+}
+
+// Migrate ensures the given indexes when AutoMigrate is enabled, and drops
+// unmanaged ones when DropUnmanagedIndexes is also enabled.
+func (d *Default) Migrate(ctx context.Context, cfg *Configuration, specs ...db.IndexSpec) error {
+	if cfg == nil || !cfg.AutoMigrate {
+		return nil
+	}
+
+	if err := d.EnsureIndexes(ctx, specs...); err != nil {
+		return err
+	}
+
+	if cfg.DropUnmanagedIndexes {
+		return d.DropUnmanagedIndexes(ctx, specs...)
+	}
+
+	return nil
+}
+
+// EnsureIndexes creates missing indexes and rebuilds the ones whose definition
+// differs from the given specifications.
+func (d *Default) EnsureIndexes(ctx context.Context, specs ...db.IndexSpec) error {
+	existing, err := d.listIndexes(ctx)
+	if err != nil {
+		return err
+	}
+
+	c, err := d.collection(ctx)
+	if err != nil {
+		return err
+	}
+	indexes := c.Indexes()
+
+	for _, spec := range specs {
+		if err := spec.Validate(); err != nil {
+			return xerrors.Errorf("mongodb: %w", err)
+		}
+
+		name := spec.IndexName()
+		keys := indexKeys(spec)
+
+		// Look for an index with the same key or the same name
+		var current *indexDescription
+		for i := range existing {
+			if sameKeys(existing[i].Key, keys) || existing[i].Name == name {
+				current = &existing[i]
+				break
+			}
+		}
+
+		if current != nil {
+			same, err := sameIndex(current, spec, keys)
+			if err != nil {
+				return err
+			}
+			if same {
+				continue
+			}
+
+			log.For(ctx).Info("Dropping outdated index",
+				zap.String("collection", d.table),
+				zap.String("index", current.Name),
+			)
+			if _, err := indexes.DropOne(ctx, current.Name); err != nil {
+				return xerrors.Errorf("mongodb: unable to drop index %q: %w", current.Name, err)
+			}
+		}
+
+		log.For(ctx).Info("Creating index",
+			zap.String("collection", d.table),
+			zap.String("index", name),
+		)
+		if _, err := indexes.CreateOne(ctx, mongo.IndexModel{
+			Keys:    keys,
+			Options: indexOptions(spec),
+		}); err != nil {
+			return xerrors.Errorf("mongodb: unable to create index %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// DropUnmanagedIndexes removes all indexes that don't match one of the given
+// specifications. The primary index is always kept.
+func (d *Default) DropUnmanagedIndexes(ctx context.Context, specs ...db.IndexSpec) error {
+	existing, err := d.listIndexes(ctx)
+	if err != nil {
+		return err
+	}
+
+	c, err := d.collection(ctx)
+	if err != nil {
+		return err
+	}
+	indexes := c.Indexes()
+
+	for _, index := range existing {
+		if index.Name == primaryIndexName {
+			continue
+		}
+
+		managed := false
+		for _, spec := range specs {
+			if index.Name == spec.IndexName() || sameKeys(index.Key, indexKeys(spec)) {
+				managed = true
+				break
+			}
+		}
+		if managed {
+			continue
+		}
+
+		log.For(ctx).Info("Dropping unmanaged index",
+			zap.String("collection", d.table),
+			zap.String("index", index.Name),
+		)
+		if _, err := indexes.DropOne(ctx, index.Name); err != nil {
+			return xerrors.Errorf("mongodb: unable to drop index %q: %w", index.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+func (d *Default) listIndexes(ctx context.Context) ([]indexDescription, error) {
+	c, err := d.collection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := c.Indexes().List(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("mongodb: unable to list indexes: %w", err)
+	}
+	defer func() {
+		log.CheckErrCtx(ctx, "Unable to close cursor", cursor.Close(ctx))
+	}()
+
+	var indexes []indexDescription
+	for cursor.Next(ctx) {
+		var index indexDescription
+		if err := cursor.Decode(&index); err != nil {
+			return nil, xerrors.Errorf("mongodb: unable to decode index description: %w", err)
+		}
+		indexes = append(indexes, index)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, xerrors.Errorf("mongodb: unable to list indexes: %w", err)
+	}
+
+	return indexes, nil
+}
+
+func indexKeys(spec db.IndexSpec) bson.D {
+	keys := make(bson.D, 0, len(spec.Fields))
+	for _, field := range spec.Fields {
+		direction := int32(1)
+		if field.Direction == db.Descending {
+			direction = -1
+		}
+		keys = append(keys, bson.E{Key: field.Name, Value: direction})
+	}
+	return keys
+}
+
+func indexOptions(spec db.IndexSpec) *options.IndexOptions {
+	opts := options.Index().
+		SetName(spec.IndexName()).
+		SetUnique(spec.Unique).
+		SetSparse(spec.Sparse)
+
+	if spec.TTL > 0 {
+		opts.SetExpireAfterSeconds(int32(spec.TTL / time.Second))
+	}
+	if spec.PartialFilter != nil {
+		opts.SetPartialFilterExpression(spec.PartialFilter)
+	}
+
+	return opts
+}
+
+func keyDirection(value interface{}) int {
+	switch v := value.(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	default:
+		// Special indexes (text, 2dsphere, hashed...) are never managed
+		return 0
+	}
+}
+
+func sameKeys(existing, expected bson.D) bool {
+	if len(existing) != len(expected) {
+		return false
+	}
+	for i := range existing {
+		if existing[i].Key != expected[i].Key || keyDirection(existing[i].Value) != keyDirection(expected[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameIndex(current *indexDescription, spec db.IndexSpec, keys bson.D) (bool, error) {
+	if !sameKeys(current.Key, keys) || current.Unique != spec.Unique || current.Sparse != spec.Sparse {
+		return false, nil
+	}
+
+	// Compare expiration
+	var ttl time.Duration
+	if current.ExpireAfterSeconds != nil {
+		ttl = time.Duration(*current.ExpireAfterSeconds) * time.Second
+	}
+	if ttl != spec.TTL.Truncate(time.Second) {
+		return false, nil
+	}
+
+	// Compare partial filters once both are decoded the same way
+	if spec.PartialFilter == nil || len(current.PartialFilterExpression) == 0 {
+		return spec.PartialFilter == nil && len(current.PartialFilterExpression) == 0, nil
+	}
+
+	raw, err := bson.Marshal(spec.PartialFilter)
+	if err != nil {
+		return false, xerrors.Errorf("mongodb: unable to encode partial filter: %w", err)
+	}
+
+	var expected, actual bson.M
+	if err := bson.Unmarshal(raw, &expected); err != nil {
+		return false, xerrors.Errorf("mongodb: unable to decode partial filter: %w", err)
+	}
+	if err := bson.Unmarshal(current.PartialFilterExpression, &actual); err != nil {
+		return false, xerrors.Errorf("mongodb: unable to decode partial filter: %w", err)
+	}
+
+	return reflect.DeepEqual(expected, actual), nil
+}
@@ -0,0 +1,108 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mongodb
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/xerrors"
+
+	"github.com/scraly/go.pkg/db"
+)
+
+// iterateBatchSize is the number of documents fetched by each cursor round trip
+const iterateBatchSize = 500
+
+// Rows returns a cursor over the documents matching the filter, documents are
+// fetched by batches while the cursor is advanced.
+func (d *Default) Rows(ctx context.Context, filter interface{}, sortParams *db.SortParameters) (db.Rows, error) {
+	c, err := d.collection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply Filter
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	// Prepare the query
+	opts := options.Find().SetBatchSize(iterateBatchSize)
+
+	// Apply sorts
+	if sortParams != nil {
+		sort := ConvertSortDocument(*sortParams)
+		if len(sort) > 0 {
+			opts.SetSort(sort)
+		}
+	}
+
+	res, err := c.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	return &cursor{ctx: ctx, cursor: res, decrypt: d.decrypt}, nil
+}
+
+// Iterate calls fn for each document matching the filter, the next document
+// is only decoded once fn returns. Return db.ErrStopIteration from fn to stop
+// early.
+func (d *Default) Iterate(ctx context.Context, filter interface{}, sortParams *db.SortParameters, fn db.IteratorFunc) error {
+	rows, err := d.Rows(ctx, filter, sortParams)
+	if err != nil {
+		return err
+	}
+
+	return db.Iterate(ctx, rows, fn)
+}
+
+// -----------------------------------------------------------------------------
+
+type cursor struct {
+	ctx     context.Context
+	cursor  *mongo.Cursor
+	decrypt func(ctx context.Context, result interface{}, err error) error
+}
+
+func (c *cursor) Next(ctx context.Context) bool {
+	return c.cursor.Next(ctx)
+}
+
+func (c *cursor) Scan(dest interface{}) error {
+	if err := c.cursor.Decode(dest); err != nil {
+		return xerrors.Errorf("mongodb: unable to decode document: %w", err)
+	}
+	return c.decrypt(c.ctx, dest, nil)
+}
+
+func (c *cursor) Err() error {
+	return c.cursor.Err()
+}
+
+func (c *cursor) Close() error {
+	return c.cursor.Close(c.ctx)
+}
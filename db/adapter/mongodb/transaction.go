@@ -0,0 +1,160 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mongodb
+
+import (
+	"context"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"github.com/scraly/go.pkg/log"
+)
+
+type transactionKey struct{}
+
+type sessionKey struct{}
+
+// RequireTransaction returns a context which forces all operations executed
+// with it to run in a transaction, regardless of the server topology.
+func RequireTransaction(ctx context.Context) context.Context {
+	return context.WithValue(ctx, transactionKey{}, true)
+}
+
+func transactionRequested(ctx context.Context) bool {
+	required, _ := ctx.Value(transactionKey{}).(bool)
+	return required
+}
+
+// sessionFromContext returns the session bound to the context, contexts derived
+// from a session context (i.e. with a timeout) are still bound to the session.
+//
+// The driver only exposes mongo.SessionFromContext from v1.4.0.
+func sessionFromContext(ctx context.Context) mongo.Session {
+	if sctx, ok := ctx.(mongo.SessionContext); ok {
+		return sctx
+	}
+	if session, ok := ctx.Value(sessionKey{}).(mongo.Session); ok {
+		return session
+	}
+	return nil
+}
+
+// SupportsTransactions checks if the server topology supports multi-document
+// transactions (replica set with MongoDB >= 4.0, or sharded cluster with
+// MongoDB >= 4.2).
+func SupportsTransactions(ctx context.Context, client *mongowrapper.WrappedClient) bool {
+	supported, err := detectTransactions(ctx, client)
+	if err != nil {
+		log.For(ctx).Warn("Unable to detect MongoDB topology, transactions disabled", zap.Error(err))
+		return false
+	}
+	return supported
+}
+
+func detectTransactions(ctx context.Context, client *mongowrapper.WrappedClient) (bool, error) {
+	var isMaster struct {
+		SetName        string `bson:"setName"`
+		Msg            string `bson:"msg"`
+		MaxWireVersion int32  `bson:"maxWireVersion"`
+	}
+
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&isMaster); err != nil {
+		return false, xerrors.Errorf("mongodb: unable to detect topology: %w", err)
+	}
+
+	switch {
+	case isMaster.SetName != "":
+		return isMaster.MaxWireVersion >= 7, nil
+	case isMaster.Msg == "isdbgrid":
+		return isMaster.MaxWireVersion >= 8, nil
+	default:
+		return false, nil
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// TransactionFunc is the transaction handler closure contract
+type TransactionFunc func() error
+
+// TransactionContextFunc is the transaction handler closure contract, the given
+// context is bound to the transaction session and must be used by all operations.
+type TransactionContextFunc func(ctx context.Context) error
+
+// Transaction runs the transactionfunc in a transaction
+func Transaction(ctx context.Context, client *mongowrapper.WrappedClient, fn TransactionFunc) error {
+	return TransactionWithContext(ctx, client, func(context.Context) error {
+		return fn()
+	})
+}
+
+// TransactionWithContext runs the given closure in a transaction.
+//
+// If the context, or one of its parents, is already bound to a session, the
+// closure joins the running transaction.
+func TransactionWithContext(ctx context.Context, client *mongowrapper.WrappedClient, fn TransactionContextFunc) error {
+	// Join the current transaction
+	if sessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	// Initialize a session
+	session, err := client.StartSession()
+	if err != nil {
+		return xerrors.Errorf("mongodb: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	// Start transaction
+	if err := session.StartTransaction(); err != nil {
+		return xerrors.Errorf("mongodb: %w", err)
+	}
+
+	// The driver only binds operations to its own session implementation
+	var inner mongo.Session = session
+	if wrapped, ok := session.(*mongowrapper.WrappedSession); ok {
+		inner = wrapped.Session
+	}
+
+	// Run the closure
+	if err := mongo.WithSession(ctx, inner, func(sctx mongo.SessionContext) error {
+		return fn(context.WithValue(sctx, sessionKey{}, sctx))
+	}); err != nil {
+		log.CheckErrCtx(ctx, "Unable to abort transaction", session.AbortTransaction(ctx))
+		return wrapError(err)
+	}
+
+	// Commit the transaction
+	err = session.CommitTransaction(ctx)
+	if err != nil {
+		log.CheckErrCtx(ctx, "Unable to abort transaction", session.AbortTransaction(ctx))
+		return wrapError(err)
+	}
+
+	// No error
+	return nil
+}
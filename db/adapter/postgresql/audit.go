@@ -0,0 +1,253 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/scraly/go.pkg/db"
+	"github.com/scraly/go.pkg/log"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// WithAudit records the writes executed on the table to the given sink. The
+// entity of the records is the value of the primary key columns ("id" by
+// default). Audited writes are executed in a transaction locking the modified
+// rows.
+func (d *Default) WithAudit(sink db.AuditSink, key ...string) *Default {
+	if len(key) == 0 {
+		key = []string{"id"}
+	}
+	d.audit = sink
+	d.auditKey = key
+	return d
+}
+
+// AuditTable returns an audit sink inserting records in the given table.
+//
+// When the audited table is written through the same session, records are
+// inserted in the transaction of the write: with RequireAudit, a failing insert
+// rolls the write back. Other failures only roll the insert back.
+//
+//	CREATE TABLE audit_trail (
+//	  table_name TEXT NOT NULL,
+//	  action     TEXT NOT NULL,
+//	  entity     JSONB,
+//	  actor      TEXT,
+//	  trace_id   TEXT,
+//	  before     JSONB,
+//	  after      JSONB,
+//	  changes    JSONB,
+//	  created_at TIMESTAMPTZ NOT NULL
+//	);
+func AuditTable(session *sqlx.DB, table string) db.AuditSink {
+	return db.AuditSinkFunc(func(ctx context.Context, record *db.AuditRecord) error {
+		values := []interface{}{record.Entity, record.Before, record.After, record.Changes}
+		for i, value := range values {
+			raw, err := json.Marshal(value)
+			if err != nil {
+				return xerrors.Errorf("postgresql: unable to encode audit record: %w", err)
+			}
+			values[i] = string(raw)
+		}
+
+		q, args, err := sq.Insert(table).
+			Columns("table_name", "action", "entity", "actor", "trace_id", "before", "after", "changes", "created_at").
+			Values(record.Table, string(record.Action), values[0], record.Actor, record.TraceID, values[1], values[2], values[3], record.Timestamp).
+			PlaceholderFormat(sq.Dollar).
+			ToSql()
+		if err != nil {
+			return xerrors.Errorf("postgresql: unable to build query: %w", err)
+		}
+
+		if tx := auditTxFromContext(ctx, session); tx != nil {
+			return execSavepoint(ctx, tx, q, args...)
+		}
+
+		if _, err := session.ExecContext(ctx, q, args...); err != nil {
+			return xerrors.Errorf("postgresql: unable to execute query: %w", TranslateError(err))
+		}
+
+		return nil
+	})
+}
+
+// execSavepoint executes the query in a savepoint of the transaction, so that
+// its failure doesn't abort the transaction.
+func execSavepoint(ctx context.Context, tx *sqlx.Tx, query string, args ...interface{}) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT audit_record"); err != nil {
+		return xerrors.Errorf("postgresql: unable to create savepoint: %w", TranslateError(err))
+	}
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		if _, rollbackErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT audit_record"); rollbackErr != nil {
+			log.For(ctx).Error("Unable to rollback to savepoint", zap.Error(rollbackErr))
+		}
+		return xerrors.Errorf("postgresql: unable to execute query: %w", TranslateError(err))
+	}
+
+	if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT audit_record"); err != nil {
+		return xerrors.Errorf("postgresql: unable to release savepoint: %w", TranslateError(err))
+	}
+
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+// queryer is implemented by *sqlx.DB and *sqlx.Tx
+type queryer interface {
+	PreparexContext(ctx context.Context, query string) (*sqlx.Stmt, error)
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+}
+
+// auditTxKey holds the transaction of the audited write in the context given
+// to the audit sink.
+type auditTxKey struct{}
+
+type auditTxValue struct {
+	session *sqlx.DB
+	tx      *sqlx.Tx
+}
+
+// auditTxFromContext returns the transaction of the audited write when it was
+// started from the given session.
+func auditTxFromContext(ctx context.Context, session *sqlx.DB) *sqlx.Tx {
+	value, ok := ctx.Value(auditTxKey{}).(auditTxValue)
+	if !ok || value.session != session {
+		return nil
+	}
+	return value.tx
+}
+
+// auditTx runs fn in a transaction when the table is audited, so that the
+// snapshot, the write and the audit records inserted by AuditTable are atomic.
+func (d *Default) auditTx(ctx context.Context, session *sqlx.DB, fn func(ctx context.Context, conn queryer) error) error {
+	if d.audit == nil {
+		return fn(ctx, session)
+	}
+
+	tx, err := session.BeginTxx(ctx, nil)
+	if err != nil {
+		return xerrors.Errorf("postgresql: unable to start transaction: %w", TranslateError(err))
+	}
+
+	if err := fn(context.WithValue(ctx, auditTxKey{}, auditTxValue{session: session, tx: tx}), tx); err != nil {
+		log.CheckErrCtx(ctx, "Unable to rollback transaction", tx.Rollback())
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return xerrors.Errorf("postgresql: unable to commit transaction: %w", TranslateError(err))
+	}
+
+	return nil
+}
+
+// snapshot locks and returns the rows matching the filter when the table is
+// audited, at most db.MaxAuditedRows rows are loaded.
+func (d *Default) snapshot(ctx context.Context, conn queryer, table string, filter interface{}) ([]map[string]interface{}, error) {
+	if d.audit == nil {
+		return nil, nil
+	}
+
+	q, args, err := sq.Select(d.columns...).
+		From(table).
+		Where(filter).
+		Limit(db.MaxAuditedRows + 1).
+		Suffix("FOR UPDATE").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, xerrors.Errorf("postgresql: unable to build query: %w", err)
+	}
+
+	rows, err := conn.QueryxContext(ctx, q, args...)
+	if err != nil {
+		return nil, xerrors.Errorf("postgresql: unable to execute query: %w", TranslateError(err))
+	}
+	defer log.SafeClose(rows, "Unable to close rows")
+
+	var snapshot []map[string]interface{}
+	for rows.Next() {
+		if len(snapshot) == db.MaxAuditedRows {
+			return nil, db.ErrTooManyAuditedRows
+		}
+
+		row := map[string]interface{}{}
+		if err := rows.MapScan(row); err != nil {
+			return nil, xerrors.Errorf("postgresql: unable to retrieve query result: %w", err)
+		}
+		for column, value := range row {
+			// Text columns are returned as bytes by the driver
+			if raw, ok := value.([]byte); ok {
+				row[column] = string(raw)
+			}
+		}
+		snapshot = append(snapshot, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.Errorf("postgresql: unable to retrieve query result: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// record sends one audit record per row of the snapshot, or a single record
+// built from after when there is no snapshot.
+func (d *Default) record(ctx context.Context, action db.AuditAction, before []map[string]interface{}, after map[string]interface{}) error {
+	if d.audit == nil {
+		return nil
+	}
+
+	if len(before) == 0 {
+		return db.Audit(ctx, d.audit, db.NewAuditRecord(ctx, d.table, action, d.entity(after), nil, after))
+	}
+
+	for _, row := range before {
+		if err := db.Audit(ctx, d.audit, db.NewAuditRecord(ctx, d.table, action, d.entity(row), row, after)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// entity returns the primary key value of the row, or a map of the primary key
+// columns for composite keys.
+func (d *Default) entity(row map[string]interface{}) interface{} {
+	if len(d.auditKey) == 1 {
+		return row[d.auditKey[0]]
+	}
+
+	key := make(map[string]interface{}, len(d.auditKey))
+	for _, column := range d.auditKey {
+		key[column] = row[column]
+	}
+	return key
+}
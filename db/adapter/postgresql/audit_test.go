@@ -0,0 +1,194 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/xerrors"
+
+	"github.com/scraly/go.pkg/db"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type auditedUser struct {
+	ID    int64  `db:"id"`
+	Login string `db:"login"`
+}
+
+func TestAuditTable(t *testing.T) {
+	Convey("Given an audited table recording to an audit table", t, func() {
+		server := &auditServer{}
+		conn := sqlx.NewDb(sql.OpenDB(server), "postgres")
+		Reset(func() {
+			_ = conn.Close()
+		})
+
+		ctx := context.Background()
+
+		Convey("When the audit insert fails with a required sink", func() {
+			server.failAudit = true
+			users := NewCRUDTable(conn, "", "users", []string{"id", "login"}, nil).
+				WithAudit(db.RequireAudit(AuditTable(conn, "audit_trail")))
+
+			err := users.Create(ctx, &auditedUser{ID: 1, Login: "alice"})
+
+			Convey("Then the write should be rolled back", func() {
+				So(err, ShouldNotBeNil)
+				So(server.rollbacks, ShouldEqual, 1)
+				So(server.commits, ShouldEqual, 0)
+				So(server.statements, ShouldContain, "ROLLBACK TO SAVEPOINT audit_record")
+			})
+		})
+
+		Convey("When the audit insert fails with an optional sink", func() {
+			server.failAudit = true
+			users := NewCRUDTable(conn, "", "users", []string{"id", "login"}, nil).
+				WithAudit(AuditTable(conn, "audit_trail"))
+
+			err := users.Create(ctx, &auditedUser{ID: 1, Login: "alice"})
+
+			Convey("Then the write should be committed without the record", func() {
+				So(err, ShouldBeNil)
+				So(server.commits, ShouldEqual, 1)
+				So(server.rollbacks, ShouldEqual, 0)
+				So(server.statements, ShouldContain, "ROLLBACK TO SAVEPOINT audit_record")
+			})
+		})
+
+		Convey("When the audit insert succeeds", func() {
+			users := NewCRUDTable(conn, "", "users", []string{"id", "login"}, nil).
+				WithAudit(db.RequireAudit(AuditTable(conn, "audit_trail")))
+
+			err := users.Create(ctx, &auditedUser{ID: 1, Login: "alice"})
+
+			Convey("Then the record should be inserted in the write transaction", func() {
+				So(err, ShouldBeNil)
+				So(server.commits, ShouldEqual, 1)
+				So(server.inTx("INSERT INTO users"), ShouldBeTrue)
+				So(server.inTx("INSERT INTO audit_trail"), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+// -----------------------------------------------------------------------------
+
+// auditServer is a database/sql driver recording the executed statements and
+// the transaction outcomes, inserts in audit_trail fail when failAudit is set.
+type auditServer struct {
+	mu         sync.Mutex
+	failAudit  bool
+	statements []string
+	txQueries  []string
+	inTxn      bool
+	commits    int
+	rollbacks  int
+}
+
+func (s *auditServer) Connect(context.Context) (driver.Conn, error) {
+	return &auditConn{server: s}, nil
+}
+
+func (s *auditServer) Driver() driver.Driver { return nil }
+
+func (s *auditServer) inTx(prefix string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, query := range s.txQueries {
+		if strings.HasPrefix(query, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type auditConn struct {
+	server *auditServer
+}
+
+func (c *auditConn) Prepare(query string) (driver.Stmt, error) {
+	return &auditStmt{server: c.server, query: query}, nil
+}
+
+func (c *auditConn) Close() error { return nil }
+
+func (c *auditConn) Begin() (driver.Tx, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	c.server.inTxn = true
+	return c, nil
+}
+
+func (c *auditConn) Commit() error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	c.server.inTxn = false
+	c.server.commits++
+	return nil
+}
+
+func (c *auditConn) Rollback() error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	c.server.inTxn = false
+	c.server.rollbacks++
+	return nil
+}
+
+type auditStmt struct {
+	server *auditServer
+	query  string
+}
+
+func (s *auditStmt) Close() error  { return nil }
+func (s *auditStmt) NumInput() int { return -1 }
+
+func (s *auditStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+
+	s.server.statements = append(s.server.statements, s.query)
+	if s.server.inTxn {
+		s.server.txQueries = append(s.server.txQueries, s.query)
+	}
+	if s.server.failAudit && strings.HasPrefix(s.query, "INSERT INTO audit_trail") {
+		return nil, xerrors.New("relation \"audit_trail\" does not exist")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *auditStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, driver.ErrSkip
+}
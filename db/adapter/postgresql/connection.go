@@ -53,6 +53,9 @@ import (
 var (
 	once sync.Once
 	conn *sqlx.DB
+
+	driversMu sync.Mutex
+	drivers   = map[string]string{}
 )
 
 // Configuration represents database connection configuration
@@ -65,8 +68,38 @@ type Configuration struct {
 
 // Connection provides Wire provider for a PostgreSQL database connection
 func Connection(ctx context.Context, cfg *Configuration) (*sqlx.DB, error) {
+	var err error
+
+	conn, err = open(ctx, cfg, nil, 95)
+	if err != nil {
+		return nil, err
+	}
+
+	once.Do(func() {
+		// Start statistic puller
+		dbstatsCloser := ocsql.RecordStats(conn.DB, 5*time.Second)
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				dbstatsCloser()
+				log.SafeClose(conn, "Unable to close database connection")
+			}
+		}()
+	})
+
+	// Return connection
+	return conn, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// open a new connection pool, the given options override the ones from the
+// connection string.
+func open(ctx context.Context, cfg *Configuration, options map[string]string, maxOpenConns int) (*sqlx.DB, error) {
 	deadline := time.Now().Add(10 * time.Second)
 
+	var db *sqlx.DB
 	err := try.Do(func(attempt int) (bool, error) {
 		var err error
 
@@ -94,40 +127,35 @@ func Connection(ctx context.Context, cfg *Configuration) (*sqlx.DB, error) {
 		// Overrides settings
 		connStr.User = cfg.Username
 		connStr.Password = cfg.Password
+		if connStr.Options == nil {
+			connStr.Options = map[string]string{}
+		}
+		for k, v := range options {
+			connStr.Options[k] = v
+		}
 
 		// Instrument with opentracing
-		driverName, err := ocsql.Register(
-			defaultDriver,
-			ocsql.WithOptions(ocsql.TraceOptions{
-				AllowRoot:    false,
-				Ping:         false,
-				RowsNext:     false,
-				RowsClose:    false,
-				RowsAffected: false,
-				LastInsertID: false,
-				Query:        true,
-				QueryParams:  true,
-			}),
-		)
+		driverName, err := registerDriver(defaultDriver)
 		if err != nil {
-			return false, xerrors.Errorf("postgresql: failed to register ocsql driver: %w", err)
+			return false, err
 		}
 
 		// Connect to database
-		conn, err = sqlx.Open(driverName, connStr.String())
+		db, err = sqlx.Open(driverName, connStr.String())
 		if err != nil {
 			return time.Now().Before(deadline), xerrors.Errorf("postgresql: unable to open driver: %w", err)
 		}
 
 		// Check connection
-		if err = conn.Ping(); err != nil {
-			return time.Now().Before(deadline), xerrors.Errorf("postgresql: unable to ping database: %w", err)
+		if err = db.Ping(); err != nil {
+			log.SafeClose(db, "Unable to close database connection")
+			return time.Now().Before(deadline), xerrors.Errorf("postgresql: unable to ping database: %w", TranslateError(err))
 		}
 
 		// Update connection pool settings
-		conn.SetConnMaxLifetime(5 * time.Minute)
-		conn.SetMaxIdleConns(0)
-		conn.SetMaxOpenConns(95)
+		db.SetConnMaxLifetime(5 * time.Minute)
+		db.SetMaxIdleConns(0)
+		db.SetMaxOpenConns(maxOpenConns)
 
 		log.For(ctx).Info("PostGreSQL connected !")
 
@@ -137,19 +165,36 @@ func Connection(ctx context.Context, cfg *Configuration) (*sqlx.DB, error) {
 		return nil, xerrors.Errorf("postgresql: unable to connect to database: %w", err)
 	}
 
-	once.Do(func() {
-		// Start statistic puller
-		dbstatsCloser := ocsql.RecordStats(conn.DB, 5*time.Second)
+	return db, nil
+}
 
-		go func() {
-			select {
-			case <-ctx.Done():
-				dbstatsCloser()
-				log.SafeClose(conn, "Unable to close database connection")
-			}
-		}()
-	})
+// registerDriver wraps the given driver with ocsql only once, ocsql can only
+// register a limited number of wrappers per driver.
+func registerDriver(name string) (string, error) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
 
-	// Return connection
-	return conn, nil
+	if driverName, ok := drivers[name]; ok {
+		return driverName, nil
+	}
+
+	driverName, err := ocsql.Register(
+		name,
+		ocsql.WithOptions(ocsql.TraceOptions{
+			AllowRoot:    false,
+			Ping:         false,
+			RowsNext:     false,
+			RowsClose:    false,
+			RowsAffected: false,
+			LastInsertID: false,
+			Query:        true,
+			QueryParams:  true,
+		}),
+	)
+	if err != nil {
+		return "", xerrors.Errorf("postgresql: failed to register ocsql driver: %w", err)
+	}
+
+	drivers[name] = driverName
+	return driverName, nil
 }
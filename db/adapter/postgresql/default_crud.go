@@ -28,11 +28,13 @@ import (
 	"reflect"
 
 	"github.com/scraly/go.pkg/db"
+	"github.com/scraly/go.pkg/db/encryption"
 	"github.com/scraly/go.pkg/log"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
 	"github.com/jmoiron/sqlx/reflectx"
+	"github.com/lib/pq"
 	"golang.org/x/xerrors"
 )
 
@@ -45,6 +47,14 @@ type Default struct {
 	mapper          *reflectx.Mapper
 	columns         []string
 	sortableColumns map[string]bool
+
+	tenants     db.TenantResolver
+	connections *TenantConnections
+	fullText    *FullTextSearch
+	audit       db.AuditSink
+	auditKey    []string
+	encryption  *encryption.Encryptor
+	encrypted   map[string]encryption.Mode
 }
 
 // NewCRUDTable sets up a new Default struct
@@ -64,6 +74,31 @@ func NewCRUDTable(session *sqlx.DB, db, table string, columns, sortable []string
 	}
 }
 
+// WithTenants routes every query to the table of the tenant schema returned by
+// the resolver, queries are refused when no tenant is resolved.
+func (d *Default) WithTenants(resolver db.TenantResolver) *Default {
+	if resolver == nil {
+		resolver = db.ContextTenant
+	}
+	d.tenants = resolver
+	return d
+}
+
+// WithTenantConnections routes every query to the connection pool of the
+// tenant, table names are resolved by the pool search_path.
+func (d *Default) WithTenantConnections(connections *TenantConnections) *Default {
+	d.connections = connections
+	return d
+}
+
+// WithEncryption encrypts the fields of the given model marked with the
+// encrypt struct tag on write and decrypts them on read.
+func (d *Default) WithEncryption(enc *encryption.Encryptor, model interface{}) *Default {
+	d.encryption = enc.WithNameTag("db")
+	d.encrypted = encryption.Fields(model, "db")
+	return d
+}
+
 // -----------------------------------------------------------------------------
 
 // GetTableName returns table's name
@@ -85,12 +120,25 @@ func (d *Default) GetSession() interface{} {
 
 // Create a record
 func (d *Default) Create(ctx context.Context, data interface{}) error {
+	// Resolve tenant table and connection
+	table, session, release, err := d.target(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Encrypt sensitive fields
+	if d.encryption != nil {
+		if data, err = d.encryption.Seal(ctx, data); err != nil {
+			return xerrors.Errorf("postgresql: unable to encrypt entity: %w", err)
+		}
+	}
 
 	// Extract columns and values
 	columns, values := d.extractColumnPairs(data)
 
 	// Prepare query
-	query := sq.Insert(d.table).
+	query := sq.Insert(table).
 		Columns(columns...).
 		Values(values...).
 		PlaceholderFormat(sq.Dollar)
@@ -101,29 +149,46 @@ func (d *Default) Create(ctx context.Context, data interface{}) error {
 		return xerrors.Errorf("postgresql: unable to build query: %w", err)
 	}
 
-	// Prepare the statement
-	stmt, err := d.session.PreparexContext(ctx, q)
-	if err != nil {
-		return xerrors.Errorf("postgresql: unable to prepapre query: %w", err)
-	}
-	defer func(stmt *sqlx.Stmt) {
-		log.SafeClose(stmt, "Unable to close statement")
-	}(stmt)
-
-	// Do the insert query
-	_, err = stmt.ExecContext(ctx, args...)
-	if err != nil {
-		return xerrors.Errorf("postgresql: unable to execute query: %w", err)
-	}
-
-	return nil
+	return d.auditTx(ctx, session, func(ctx context.Context, conn queryer) error {
+		// Prepare the statement
+		stmt, err := conn.PreparexContext(ctx, q)
+		if err != nil {
+			return xerrors.Errorf("postgresql: unable to prepapre query: %w", TranslateError(err))
+		}
+		defer func(stmt *sqlx.Stmt) {
+			log.SafeClose(stmt, "Unable to close statement")
+		}(stmt)
+
+		// Do the insert query
+		_, err = stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return xerrors.Errorf("postgresql: unable to execute query: %w", TranslateError(err))
+		}
+
+		// Record the created entity
+		if d.audit == nil {
+			return nil
+		}
+		after := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			after[column] = values[i]
+		}
+		return d.record(ctx, db.AuditCreate, nil, after)
+	})
 }
 
 // WhereCount is used to cound resultset elements from the given filter
 func (d *Default) WhereCount(ctx context.Context, filter interface{}) (int, error) {
+	// Resolve tenant table and connection
+	table, session, release, err := d.target(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
 	// Prepare query
 	qb := sq.Select("COUNT(*) as count").
-		From(d.table).
+		From(table).
 		PlaceholderFormat(sq.Dollar)
 
 	if filter != nil {
@@ -137,9 +202,9 @@ func (d *Default) WhereCount(ctx context.Context, filter interface{}) (int, erro
 	}
 
 	// Prepare the statement
-	stmt, err := d.session.PreparexContext(ctx, q)
+	stmt, err := session.PreparexContext(ctx, q)
 	if err != nil {
-		return 0, xerrors.Errorf("postgresql: unable to prepare query: %w", err)
+		return 0, xerrors.Errorf("postgresql: unable to prepare query: %w", TranslateError(err))
 	}
 	defer func(stmt *sqlx.Stmt) {
 		log.SafeClose(stmt, "Unable to close statement")
@@ -149,7 +214,7 @@ func (d *Default) WhereCount(ctx context.Context, filter interface{}) (int, erro
 	if err := stmt.QueryRowContext(ctx, args...).Scan(&count); err == sql.ErrNoRows {
 		return 0, db.ErrNoResult
 	} else if err != nil {
-		return 0, xerrors.Errorf("postgresql: unable to execute query: %w", err)
+		return 0, xerrors.Errorf("postgresql: unable to execute query: %w", TranslateError(err))
 	}
 
 	// Return no error
@@ -158,9 +223,16 @@ func (d *Default) WhereCount(ctx context.Context, filter interface{}) (int, erro
 
 // WhereAndFetchOne returns only one element from the given filter
 func (d *Default) WhereAndFetchOne(ctx context.Context, filter interface{}, result interface{}) error {
+	// Resolve tenant table and connection
+	table, session, release, err := d.target(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	// Prepare query
 	qb := sq.Select(d.columns...).
-		From(d.table).
+		From(table).
 		Where(filter).
 		Limit(1).
 		PlaceholderFormat(sq.Dollar)
@@ -172,20 +244,25 @@ func (d *Default) WhereAndFetchOne(ctx context.Context, filter interface{}, resu
 	}
 
 	// Prepare the statement
-	stmt, err := d.session.PreparexContext(ctx, q)
+	stmt, err := session.PreparexContext(ctx, q)
 	if err != nil {
-		return xerrors.Errorf("postgresql: unable to prepare query: %w", err)
+		return xerrors.Errorf("postgresql: unable to prepare query: %w", TranslateError(err))
 	}
 	defer func(stmt *sqlx.Stmt) {
 		log.SafeClose(stmt, "Unable to close statement")
 	}(stmt)
 
 	// Do the insert query
-	err = d.session.QueryRowxContext(ctx, q, args...).StructScan(result)
+	err = session.QueryRowxContext(ctx, q, args...).StructScan(result)
 	if err == sql.ErrNoRows {
 		return db.ErrNoResult
 	} else if err != nil {
-		return xerrors.Errorf("postgresql: unable to execute query: %w", err)
+		return xerrors.Errorf("postgresql: unable to execute query: %w", TranslateError(err))
+	}
+
+	// Decrypt sensitive fields
+	if err := d.decrypt(ctx, result); err != nil {
+		return err
 	}
 
 	// Return no error
@@ -194,8 +271,22 @@ func (d *Default) WhereAndFetchOne(ctx context.Context, filter interface{}, resu
 
 // Update the collection element with updates set matching the given filter
 func (d *Default) Update(ctx context.Context, updates map[string]interface{}, filter interface{}) error {
+	// Resolve tenant table and connection
+	table, session, release, err := d.target(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Encrypt sensitive fields
+	if d.encryption != nil {
+		if updates, err = d.encryption.SealMap(ctx, updates, d.encrypted); err != nil {
+			return xerrors.Errorf("postgresql: unable to encrypt updates: %w", err)
+		}
+	}
+
 	// Prepare query
-	qb := sq.Update(d.table).
+	qb := sq.Update(table).
 		SetMap(updates).
 		Where(filter).
 		PlaceholderFormat(sq.Dollar)
@@ -206,41 +297,55 @@ func (d *Default) Update(ctx context.Context, updates map[string]interface{}, fi
 		return xerrors.Errorf("postgresql: unable to build query: %w", err)
 	}
 
-	// Prepare the statement
-	stmt, err := d.session.PreparexContext(ctx, q)
-	if err != nil {
-		return xerrors.Errorf("postgresql: unable to prepare query: %w", err)
-	}
-	defer func(stmt *sqlx.Stmt) {
-		log.SafeClose(stmt, "Unable to close statement")
-	}(stmt)
-
-	// Do the insert query
-	res, err := stmt.ExecContext(ctx, args...)
-	if err != nil {
-		return xerrors.Errorf("postgresql: unable to execute query: %w", err)
-	}
-
-	// Check updates
-	count, err := res.RowsAffected()
-	if err != nil {
-		return xerrors.Errorf("postgresql: unable to retrieve query result: %w", err)
-	}
-
-	// If no rows where affected return an handled error
-	if count == 0 {
-		return db.ErrNoModification
-	}
-
-	// Return no error
-	return nil
+	return d.auditTx(ctx, session, func(ctx context.Context, conn queryer) error {
+		// Keep the current state for the audit trail
+		before, err := d.snapshot(ctx, conn, table, filter)
+		if err != nil {
+			return err
+		}
+
+		// Prepare the statement
+		stmt, err := conn.PreparexContext(ctx, q)
+		if err != nil {
+			return xerrors.Errorf("postgresql: unable to prepare query: %w", TranslateError(err))
+		}
+		defer func(stmt *sqlx.Stmt) {
+			log.SafeClose(stmt, "Unable to close statement")
+		}(stmt)
+
+		// Do the insert query
+		res, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return xerrors.Errorf("postgresql: unable to execute query: %w", TranslateError(err))
+		}
+
+		// Check updates
+		count, err := res.RowsAffected()
+		if err != nil {
+			return xerrors.Errorf("postgresql: unable to retrieve query result: %w", err)
+		}
+
+		// If no rows where affected return an handled error
+		if count == 0 {
+			return db.ErrNoModification
+		}
+
+		// Record the modified rows
+		return d.record(ctx, db.AuditUpdate, before, updates)
+	})
 }
 
 // RemoveOne is used to remove one element from the collection that match the filter
 func (d *Default) RemoveOne(ctx context.Context, filter interface{}) error {
+	// Resolve tenant table and connection
+	table, session, release, err := d.target(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
 
 	// Prepare query
-	qb := sq.Delete(d.table).
+	qb := sq.Delete(table).
 		Where(filter).
 		PlaceholderFormat(sq.Dollar)
 
@@ -250,41 +355,61 @@ func (d *Default) RemoveOne(ctx context.Context, filter interface{}) error {
 		return xerrors.Errorf("postgresql: unable to build query: %w", err)
 	}
 
-	// Prepare the statement
-	stmt, err := d.session.PreparexContext(ctx, q)
-	if err != nil {
-		return xerrors.Errorf("postgresql: unable to prepare query: %w", err)
-	}
-	defer func(stmt *sqlx.Stmt) {
-		log.SafeClose(stmt, "Unable to close statement")
-	}(stmt)
+	return d.auditTx(ctx, session, func(ctx context.Context, conn queryer) error {
+		// Keep the current state for the audit trail
+		before, err := d.snapshot(ctx, conn, table, filter)
+		if err != nil {
+			return err
+		}
+
+		// Prepare the statement
+		stmt, err := conn.PreparexContext(ctx, q)
+		if err != nil {
+			return xerrors.Errorf("postgresql: unable to prepare query: %w", TranslateError(err))
+		}
+		defer func(stmt *sqlx.Stmt) {
+			log.SafeClose(stmt, "Unable to close statement")
+		}(stmt)
+
+		// Do the insert query
+		res, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return xerrors.Errorf("postgresql: unable to execute query: %w", TranslateError(err))
+		}
+
+		// Check updates
+		count, err := res.RowsAffected()
+		if err != nil {
+			return xerrors.Errorf("postgresql: unable to retrieve query result: %w", err)
+		}
+
+		// If no rows where affected return an handled error
+		if count == 0 {
+			return db.ErrNoModification
+		}
+
+		// Record the removed rows
+		return d.record(ctx, db.AuditDelete, before, nil)
+	})
+}
 
-	// Do the insert query
-	res, err := stmt.ExecContext(ctx, args...)
-	if err != nil {
-		return xerrors.Errorf("postgresql: unable to execute query: %w", err)
+// Search for element in collection
+func (d *Default) Search(ctx context.Context, filter interface{}, pagination *db.Pagination, sortParams *db.SortParameters, results interface{}) (int, error) {
+	// Rank is only available to text searches
+	if err := checkRankSort(sortParams); err != nil {
+		return 0, err
 	}
 
-	// Check updates
-	count, err := res.RowsAffected()
+	// Resolve tenant table and connection
+	table, session, release, err := d.target(ctx)
 	if err != nil {
-		return xerrors.Errorf("postgresql: unable to retrieve query result: %w", err)
+		return 0, err
 	}
+	defer release()
 
-	// If no rows where affected return an handled error
-	if count == 0 {
-		return db.ErrNoModification
-	}
-
-	// Return no error
-	return nil
-}
-
-// Search for element in collection
-func (d *Default) Search(ctx context.Context, filter interface{}, pagination *db.Pagination, sortParams *db.SortParameters, results interface{}) (int, error) {
 	// Initialize statement
 	q := sq.Select(d.columns...).
-		From(d.table).
+		From(table).
 		PlaceholderFormat(sq.Dollar)
 
 	// Count result set first
@@ -324,9 +449,9 @@ func (d *Default) Search(ctx context.Context, filter interface{}, pagination *db
 	}
 
 	// Prepare the statement
-	stmt, err := d.session.PreparexContext(ctx, sqlData)
+	stmt, err := session.PreparexContext(ctx, sqlData)
 	if err != nil {
-		return 0, xerrors.Errorf("postgresql: unable to prepare query: %w", err)
+		return 0, xerrors.Errorf("postgresql: unable to prepare query: %w", TranslateError(err))
 	}
 	defer func(stmt *sqlx.Stmt) {
 		log.SafeClose(stmt, "Unable to close statement")
@@ -335,7 +460,12 @@ func (d *Default) Search(ctx context.Context, filter interface{}, pagination *db
 	if err := stmt.SelectContext(ctx, results, args...); err == sql.ErrNoRows {
 		return 0, db.ErrNoResult
 	} else if err != nil {
-		return 0, xerrors.Errorf("postgresql: unable to execute query: %w", err)
+		return 0, xerrors.Errorf("postgresql: unable to execute query: %w", TranslateError(err))
+	}
+
+	// Decrypt sensitive fields
+	if err := d.decrypt(ctx, results); err != nil {
+		return 0, err
 	}
 
 	// Return no error
@@ -344,6 +474,44 @@ func (d *Default) Search(ctx context.Context, filter interface{}, pagination *db
 
 // -----------------------------------------------------------------------------
 
+// target returns the table name and the connection to use for the tenant
+// attached to the context, release must be called once the connection is no
+// longer used.
+func (d *Default) target(ctx context.Context) (string, *sqlx.DB, func(), error) {
+	table, session, release := d.table, d.session, func() {}
+
+	if d.tenants != nil {
+		schema, err := d.tenants(ctx)
+		if err != nil {
+			return "", nil, nil, xerrors.Errorf("postgresql: unable to resolve tenant: %w", err)
+		}
+		table = pq.QuoteIdentifier(schema) + "." + table
+	}
+
+	if d.connections != nil {
+		conn, done, err := d.connections.Get(ctx)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		session, release = conn, done
+	}
+
+	return table, session, release, nil
+}
+
+// decrypt the sensitive fields of the given result
+func (d *Default) decrypt(ctx context.Context, result interface{}) error {
+	if d.encryption == nil {
+		return nil
+	}
+
+	if err := d.encryption.Open(ctx, result); err != nil {
+		return xerrors.Errorf("postgresql: unable to decrypt result: %w", err)
+	}
+
+	return nil
+}
+
 func (d *Default) extractColumnPairs(data interface{}) ([]string, []interface{}) {
 	// Create type mapper
 	valueMap := d.mapper.FieldMap(reflect.ValueOf(data))
@@ -0,0 +1,114 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package postgresql
+
+import (
+	"context"
+	"database/sql/driver"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/scraly/go.pkg/db"
+
+	"github.com/jackc/pgx"
+	"github.com/lib/pq"
+	"golang.org/x/xerrors"
+)
+
+// keyDetail extracts the column list from "Key (a, b)=(...)" error details
+var keyDetail = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+
+// TranslateError classifies pq and pgx errors as db errors, unknown errors are
+// returned unchanged.
+func TranslateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// Already classified
+	var dbErr *db.Error
+	if xerrors.As(err, &dbErr) {
+		return err
+	}
+
+	var (
+		code, constraint, column, detail string
+	)
+
+	var pqErr *pq.Error
+	var pgxErr pgx.PgError
+	switch {
+	case xerrors.As(err, &pqErr):
+		code, constraint, column, detail = string(pqErr.Code), pqErr.Constraint, pqErr.Column, pqErr.Detail
+	case xerrors.As(err, &pgxErr):
+		code, constraint, column, detail = pgxErr.Code, pgxErr.ConstraintName, pgxErr.ColumnName, pgxErr.Detail
+	default:
+		return translateGenericError(err)
+	}
+
+	// Extract column from detail when not provided
+	if column == "" {
+		if m := keyDetail.FindStringSubmatch(detail); m != nil {
+			column = m[1]
+		}
+	}
+
+	// Classify by SQLSTATE
+	switch {
+	case code == "23505":
+		return db.NewError(db.ErrDuplicateKey, constraint, column, err)
+	case code == "23503":
+		return db.NewError(db.ErrForeignKey, constraint, column, err)
+	case code == "23514", code == "23502":
+		return db.NewError(db.ErrCheckViolation, constraint, column, err)
+	case code == "40001", code == "40P01":
+		return db.NewError(db.ErrSerialization, constraint, column, err)
+	case code == "57014", code == "55P03":
+		return db.NewError(db.ErrTimeout, constraint, column, err)
+	case strings.HasPrefix(code, "08"), code == "57P01", code == "57P02", code == "57P03", code == "53300":
+		return db.NewError(db.ErrConnection, constraint, column, err)
+	}
+
+	return err
+}
+
+// translateGenericError classifies context and network errors
+func translateGenericError(err error) error {
+	if xerrors.Is(err, context.DeadlineExceeded) {
+		return db.NewError(db.ErrTimeout, "", "", err)
+	}
+	if xerrors.Is(err, driver.ErrBadConn) {
+		return db.NewError(db.ErrConnection, "", "", err)
+	}
+
+	var netErr net.Error
+	if xerrors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return db.NewError(db.ErrTimeout, "", "", err)
+		}
+		return db.NewError(db.ErrConnection, "", "", err)
+	}
+
+	return err
+}
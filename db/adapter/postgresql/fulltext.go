@@ -0,0 +1,381 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/scraly/go.pkg/db"
+	"github.com/scraly/go.pkg/log"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"golang.org/x/xerrors"
+)
+
+// RankColumn is the column holding the full-text search rank of a result,
+// it is always sortable by TextSearch queries.
+const RankColumn = "search_rank"
+
+// ErrRankNotSortable is returned when RankColumn is used as sort field outside
+// of a full-text search, the rank is only computed by TextSearch.
+var ErrRankNotSortable = xerrors.New("postgresql: " + RankColumn + " can only be sorted on by a text search")
+
+// HeadlineSuffix is appended to the highlighted column names to build the
+// column holding the snippet.
+const HeadlineSuffix = "_headline"
+
+// Weight is the tsvector weight label of a searchable column
+type Weight string
+
+const (
+	// WeightA is the highest weight
+	WeightA Weight = "A"
+	// WeightB is the second highest weight
+	WeightB Weight = "B"
+	// WeightC is the third highest weight
+	WeightC Weight = "C"
+	// WeightD is the lowest weight
+	WeightD Weight = "D"
+)
+
+// SearchableColumn is a column included in the full-text search document
+type SearchableColumn struct {
+	Name   string
+	Weight Weight
+}
+
+// FullTextSearch describes how a table is searched using tsvector/tsquery.
+type FullTextSearch struct {
+	// Config is the text search configuration ("simple" by default)
+	Config string
+	// Columns are the columns building the document, ignored if VectorColumn
+	// is set.
+	Columns []SearchableColumn
+	// VectorColumn is a precomputed (generated or trigger maintained)
+	// tsvector column.
+	VectorColumn string
+	// Highlight are the columns for which a snippet is returned in the
+	// <column>_headline column.
+	Highlight []string
+	// HighlightOptions are the ts_headline options
+	// (i.e. "StartSel=<mark>, StopSel=</mark>, MaxFragments=2").
+	HighlightOptions string
+}
+
+var configPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// Validate the full-text search definition
+func (f FullTextSearch) Validate() error {
+	if f.Config != "" && !configPattern.MatchString(f.Config) {
+		return xerrors.Errorf("postgresql: invalid text search configuration %q", f.Config)
+	}
+	if f.VectorColumn == "" && len(f.Columns) == 0 {
+		return xerrors.New("postgresql: full-text search requires at least one column")
+	}
+	for _, column := range f.Columns {
+		switch column.Weight {
+		case "", WeightA, WeightB, WeightC, WeightD:
+		default:
+			return xerrors.Errorf("postgresql: invalid weight %q for column %q", column.Weight, column.Name)
+		}
+	}
+
+	return nil
+}
+
+// Document returns the tsvector expression of the searchable columns
+func (f FullTextSearch) Document() sq.Sqlizer {
+	document, err := f.document()
+	return expr{sql: document, err: err}
+}
+
+// Match returns the predicate matching the documents with the given web search
+// query (quoted phrases, "or" and "-" exclusions are supported), requires
+// PostgreSQL 11 or later.
+func (f FullTextSearch) Match(q string) sq.Sqlizer {
+	document, err := f.document()
+	if err != nil {
+		return expr{err: err}
+	}
+	query, err := f.query()
+	if err != nil {
+		return expr{err: err}
+	}
+
+	return expr{sql: fmt.Sprintf("(%s) @@ %s", document, query), args: []interface{}{q}}
+}
+
+// Rank returns the ts_rank expression of the documents for the given query
+func (f FullTextSearch) Rank(q string) sq.Sqlizer {
+	document, err := f.document()
+	if err != nil {
+		return expr{err: err}
+	}
+	query, err := f.query()
+	if err != nil {
+		return expr{err: err}
+	}
+
+	return expr{sql: fmt.Sprintf("ts_rank(%s, %s)", document, query), args: []interface{}{q}}
+}
+
+// Headline returns the ts_headline expression of the given column highlighting
+// the query terms.
+func (f FullTextSearch) Headline(column, q string) sq.Sqlizer {
+	config, err := f.config()
+	if err != nil {
+		return expr{err: err}
+	}
+	query, err := f.query()
+	if err != nil {
+		return expr{err: err}
+	}
+
+	return expr{
+		sql:  fmt.Sprintf("ts_headline(%s, coalesce(%s::text, ''), %s, ?)", config, pq.QuoteIdentifier(column), query),
+		args: []interface{}{q, f.HighlightOptions},
+	}
+}
+
+func (f FullTextSearch) document() (string, error) {
+	if f.VectorColumn != "" {
+		return pq.QuoteIdentifier(f.VectorColumn), nil
+	}
+
+	config, err := f.config()
+	if err != nil {
+		return "", err
+	}
+
+	parts := make([]string, 0, len(f.Columns))
+	for _, column := range f.Columns {
+		weight := column.Weight
+		switch weight {
+		case "":
+			weight = WeightD
+		case WeightA, WeightB, WeightC, WeightD:
+		default:
+			return "", xerrors.Errorf("postgresql: invalid weight %q for column %q", column.Weight, column.Name)
+		}
+		parts = append(parts, fmt.Sprintf("setweight(to_tsvector(%s, coalesce(%s::text, '')), '%s')", config, pq.QuoteIdentifier(column.Name), weight))
+	}
+
+	return strings.Join(parts, " || "), nil
+}
+
+// config returns the text search configuration literal, the configuration name
+// is validated since it can't be bound without preventing the use of
+// expression indexes.
+func (f FullTextSearch) config() (string, error) {
+	if f.Config == "" {
+		return "'simple'::regconfig", nil
+	}
+	if !configPattern.MatchString(f.Config) {
+		return "", xerrors.Errorf("postgresql: invalid text search configuration %q", f.Config)
+	}
+	return fmt.Sprintf("'%s'::regconfig", f.Config), nil
+}
+
+func (f FullTextSearch) query() (string, error) {
+	config, err := f.config()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("websearch_to_tsquery(%s, ?)", config), nil
+}
+
+// expr is a SQL expression that may carry a build error
+type expr struct {
+	sql  string
+	args []interface{}
+	err  error
+}
+
+func (e expr) ToSql() (string, []interface{}, error) {
+	return e.sql, e.args, e.err
+}
+
+// -----------------------------------------------------------------------------
+
+// WithFullTextSearch enables TextSearch using the given definition
+func (d *Default) WithFullTextSearch(fts FullTextSearch) *Default {
+	d.fullText = &fts
+	return d
+}
+
+// TextSearch returns the elements matching the web search query q and the
+// filter, ranked by relevance unless sort parameters are given. RankColumn can
+// be used as sort field. Falls back to Search when q is blank, ignoring the
+// RankColumn sort parameters.
+func (d *Default) TextSearch(ctx context.Context, q string, filter interface{}, pagination *db.Pagination, sortParams *db.SortParameters, results interface{}) (int, error) {
+	if d.fullText == nil {
+		return 0, xerrors.New("postgresql: full-text search is not enabled for this table")
+	}
+	if err := d.fullText.Validate(); err != nil {
+		return 0, err
+	}
+
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return d.Search(ctx, filter, pagination, withoutRank(sortParams), results)
+	}
+
+	// Resolve tenant table and connection
+	table, session, release, err := d.target(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	predicate := sq.And{d.fullText.Match(q)}
+	switch f := filter.(type) {
+	case nil:
+	case sq.Sqlizer:
+		predicate = append(predicate, f)
+	case map[string]interface{}:
+		predicate = append(predicate, sq.Eq(f))
+	default:
+		return 0, xerrors.Errorf("postgresql: unsupported filter type %T", filter)
+	}
+
+	// Count result set first
+	count, err := d.WhereCount(ctx, predicate)
+	if err != nil {
+		return 0, xerrors.Errorf("postgresql: unable to retrieve collection count: %w", err)
+	}
+
+	// If no result skip data request
+	if count == 0 {
+		return 0, db.ErrNoResult
+	}
+
+	if pagination != nil {
+		pagination.SetTotal(uint(count))
+	}
+
+	// Rank matching rows
+	rank, rankArgs, err := d.fullText.Rank(q).ToSql()
+	if err != nil {
+		return 0, xerrors.Errorf("postgresql: unable to build query: %w", err)
+	}
+	matches := sq.Select("*").
+		Column(sq.Expr(rank+" AS "+RankColumn, rankArgs...)).
+		From(table).
+		Where(predicate)
+
+	// Select columns and snippets
+	qb := sq.Select(d.columns...).
+		FromSelect(matches, "matches").
+		PlaceholderFormat(sq.Dollar)
+	for _, column := range d.fullText.Highlight {
+		headline, args, err := d.fullText.Headline(column, q).ToSql()
+		if err != nil {
+			return 0, xerrors.Errorf("postgresql: unable to build query: %w", err)
+		}
+		qb = qb.Column(sq.Expr(headline+" AS "+pq.QuoteIdentifier(column+HeadlineSuffix), args...))
+	}
+
+	// Apply pagination on data query only
+	if pagination != nil {
+		qb = qb.Offset(uint64(pagination.Offset())).Limit(uint64(pagination.PerPage))
+	}
+
+	// Apply sort parameters, best matches first by default
+	sorts := []string{}
+	if sortParams != nil {
+		sortable := map[string]bool{RankColumn: true}
+		for column := range d.sortableColumns {
+			sortable[column] = true
+		}
+		sorts = ConvertSortParameters(*sortParams, sortable)
+	}
+	if len(sorts) == 0 {
+		sorts = append(sorts, fmt.Sprintf("%s desc", RankColumn))
+	}
+	qb = qb.OrderBy(sorts...)
+
+	// Do the query
+	sqlData, args, err := qb.ToSql()
+	if err != nil {
+		return 0, xerrors.Errorf("postgresql: unable to build query: %w", err)
+	}
+
+	// Prepare the statement
+	stmt, err := session.PreparexContext(ctx, sqlData)
+	if err != nil {
+		return 0, xerrors.Errorf("postgresql: unable to prepare query: %w", TranslateError(err))
+	}
+	defer func(stmt *sqlx.Stmt) {
+		log.SafeClose(stmt, "Unable to close statement")
+	}(stmt)
+
+	if err := stmt.SelectContext(ctx, results, args...); err == sql.ErrNoRows {
+		return 0, db.ErrNoResult
+	} else if err != nil {
+		return 0, xerrors.Errorf("postgresql: unable to execute query: %w", TranslateError(err))
+	}
+
+	// Decrypt sensitive fields
+	if err := d.decrypt(ctx, results); err != nil {
+		return 0, err
+	}
+
+	// Return no error
+	return count, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// checkRankSort rejects the sort parameters referencing RankColumn, the rank
+// does not exist outside of TextSearch queries.
+func checkRankSort(sortParams *db.SortParameters) error {
+	if sortParams == nil {
+		return nil
+	}
+	for _, param := range *sortParams {
+		if ToSnakeCase(param.FieldName) == RankColumn {
+			return ErrRankNotSortable
+		}
+	}
+	return nil
+}
+
+// withoutRank returns the sort parameters without the ones referencing RankColumn.
+func withoutRank(sortParams *db.SortParameters) *db.SortParameters {
+	if sortParams == nil {
+		return nil
+	}
+	params := make(db.SortParameters, 0, len(*sortParams))
+	for _, param := range *sortParams {
+		if ToSnakeCase(param.FieldName) != RankColumn {
+			params = append(params, param)
+		}
+	}
+	return &params
+}
@@ -0,0 +1,219 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"github.com/scraly/go.pkg/db"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFullTextSearch(t *testing.T) {
+	Convey("Given full-text search definitions", t, func() {
+		testCases := []struct {
+			name     string
+			fts      FullTextSearch
+			sqlizer  func(FullTextSearch) sq.Sqlizer
+			expected string
+			args     []interface{}
+			invalid  bool
+		}{
+			{
+				name: "document with default config and weight",
+				fts:  FullTextSearch{Columns: []SearchableColumn{{Name: "title"}}},
+				sqlizer: func(f FullTextSearch) sq.Sqlizer {
+					return f.Document()
+				},
+				expected: `setweight(to_tsvector('simple'::regconfig, coalesce("title"::text, '')), 'D')`,
+			},
+			{
+				name: "document with weighted columns",
+				fts:  FullTextSearch{Config: "english", Columns: []SearchableColumn{{Name: "title", Weight: WeightA}, {Name: "body", Weight: WeightC}}},
+				sqlizer: func(f FullTextSearch) sq.Sqlizer {
+					return f.Document()
+				},
+				expected: `setweight(to_tsvector('english'::regconfig, coalesce("title"::text, '')), 'A') || setweight(to_tsvector('english'::regconfig, coalesce("body"::text, '')), 'C')`,
+			},
+			{
+				name: "document with vector column",
+				fts:  FullTextSearch{Config: "english", VectorColumn: "search"},
+				sqlizer: func(f FullTextSearch) sq.Sqlizer {
+					return f.Document()
+				},
+				expected: `"search"`,
+			},
+			{
+				name: "match",
+				fts:  FullTextSearch{Config: "french", VectorColumn: "search"},
+				sqlizer: func(f FullTextSearch) sq.Sqlizer {
+					return f.Match("chat -chien")
+				},
+				expected: `("search") @@ websearch_to_tsquery('french'::regconfig, ?)`,
+				args:     []interface{}{"chat -chien"},
+			},
+			{
+				name: "rank",
+				fts:  FullTextSearch{Columns: []SearchableColumn{{Name: "title", Weight: WeightB}}},
+				sqlizer: func(f FullTextSearch) sq.Sqlizer {
+					return f.Rank("go")
+				},
+				expected: `ts_rank(setweight(to_tsvector('simple'::regconfig, coalesce("title"::text, '')), 'B'), websearch_to_tsquery('simple'::regconfig, ?))`,
+				args:     []interface{}{"go"},
+			},
+			{
+				name: "headline",
+				fts:  FullTextSearch{Config: "english", VectorColumn: "search", HighlightOptions: "MaxFragments=2"},
+				sqlizer: func(f FullTextSearch) sq.Sqlizer {
+					return f.Headline("body", "go")
+				},
+				expected: `ts_headline('english'::regconfig, coalesce("body"::text, ''), websearch_to_tsquery('english'::regconfig, ?), ?)`,
+				args:     []interface{}{"go", "MaxFragments=2"},
+			},
+			{
+				name: "document with injected config",
+				fts:  FullTextSearch{Config: "english'::regconfig, 'x'); DROP TABLE users; --", Columns: []SearchableColumn{{Name: "title"}}},
+				sqlizer: func(f FullTextSearch) sq.Sqlizer {
+					return f.Document()
+				},
+				invalid: true,
+			},
+			{
+				name: "match with injected config",
+				fts:  FullTextSearch{Config: "English", VectorColumn: "search"},
+				sqlizer: func(f FullTextSearch) sq.Sqlizer {
+					return f.Match("go")
+				},
+				invalid: true,
+			},
+			{
+				name: "rank with injected config",
+				fts:  FullTextSearch{Config: "simple'", VectorColumn: "search"},
+				sqlizer: func(f FullTextSearch) sq.Sqlizer {
+					return f.Rank("go")
+				},
+				invalid: true,
+			},
+			{
+				name: "headline with injected config",
+				fts:  FullTextSearch{Config: "a b", VectorColumn: "search"},
+				sqlizer: func(f FullTextSearch) sq.Sqlizer {
+					return f.Headline("body", "go")
+				},
+				invalid: true,
+			},
+			{
+				name: "document with injected weight",
+				fts:  FullTextSearch{Columns: []SearchableColumn{{Name: "title", Weight: "A'), 'B"}}},
+				sqlizer: func(f FullTextSearch) sq.Sqlizer {
+					return f.Document()
+				},
+				invalid: true,
+			},
+			{
+				name: "match with unknown weight",
+				fts:  FullTextSearch{Columns: []SearchableColumn{{Name: "title", Weight: "E"}}},
+				sqlizer: func(f FullTextSearch) sq.Sqlizer {
+					return f.Match("go")
+				},
+				invalid: true,
+			},
+		}
+
+		for _, tc := range testCases {
+			tc := tc
+			Convey("When building the "+tc.name, func() {
+				query, args, err := tc.sqlizer(tc.fts).ToSql()
+
+				if tc.invalid {
+					Convey("Then it should be rejected", func() {
+						So(err, ShouldNotBeNil)
+						So(query, ShouldBeEmpty)
+						So(tc.fts.Validate(), ShouldNotBeNil)
+					})
+					return
+				}
+
+				Convey("Then the expected SQL should be produced", func() {
+					So(err, ShouldBeNil)
+					So(query, ShouldEqual, tc.expected)
+					So(args, ShouldResemble, tc.args)
+					So(tc.fts.Validate(), ShouldBeNil)
+				})
+			})
+		}
+	})
+}
+
+func TestRankSort(t *testing.T) {
+	Convey("Given a table with the rank declared as sortable", t, func() {
+		underTest := NewCRUDTable(nil, "db", "items", []string{"id", "title"}, []string{"title", RankColumn})
+		ctx := context.Background()
+
+		sortParams := db.SortParameters{
+			{FieldName: "title", Direction: db.Ascending},
+			{FieldName: "searchRank", Direction: db.Descending},
+		}
+
+		Convey("When searching sorted by rank", func() {
+			var results []map[string]interface{}
+			count, err := underTest.Search(ctx, nil, nil, &sortParams, &results)
+
+			Convey("Then it should be rejected", func() {
+				So(err, ShouldEqual, ErrRankNotSortable)
+				So(count, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When iterating sorted by rank", func() {
+			rows, err := underTest.Rows(ctx, nil, &sortParams)
+
+			Convey("Then it should be rejected", func() {
+				So(err, ShouldEqual, ErrRankNotSortable)
+				So(rows, ShouldBeNil)
+			})
+		})
+
+		Convey("When the text search falls back to Search", func() {
+			params := withoutRank(&sortParams)
+
+			Convey("Then the rank sort should be ignored", func() {
+				So(checkRankSort(params), ShouldBeNil)
+				So(*params, ShouldResemble, db.SortParameters{{FieldName: "title", Direction: db.Ascending}})
+			})
+		})
+
+		Convey("When searching sorted by columns only", func() {
+			params := db.SortParameters{{FieldName: "title", Direction: db.Descending}}
+
+			Convey("Then it should be accepted", func() {
+				So(checkRankSort(&params), ShouldBeNil)
+				So(checkRankSort(nil), ShouldBeNil)
+			})
+		})
+	})
+}
@@ -4,6 +4,7 @@ go 1.12
 
 require (
 	github.com/scraly/go.pkg/db v0.0.8
+	github.com/scraly/go.pkg/db/encryption v0.0.1
 	github.com/scraly/go.pkg/log v0.0.12
 	github.com/Masterminds/squirrel v1.1.0
 	github.com/cheekybits/is v0.0.0-20150225183255-68e9c0620927 // indirect
@@ -16,6 +17,8 @@ require (
 	github.com/opencensus-integrations/ocsql v0.1.4
 	github.com/satori/go.uuid v1.2.0 // indirect
 	github.com/shopspring/decimal v0.0.0-20180709203117-cd690d0c9e24 // indirect
+	github.com/smartystreets/goconvey v1.6.4
+	go.uber.org/zap v1.10.0
 	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543
 	google.golang.org/appengine v1.5.0 // indirect
 	gopkg.in/matryer/try.v1 v1.0.0-20150601225556-312d2599e12e
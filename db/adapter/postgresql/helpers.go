@@ -45,7 +45,8 @@ func ToSnakeCase(in string) string {
 	return string(out)
 }
 
-// ConvertSortParameters to sql query string
+// ConvertSortParameters to sql query string, RankColumn is only a column of
+// TextSearch queries and is rejected by Search and Rows.
 func ConvertSortParameters(params db.SortParameters, sortableColumns map[string]bool) []string {
 	sorts := make([]string, 0, len(params))
 
@@ -0,0 +1,246 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/scraly/go.pkg/log"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+var (
+	// ErrLockNotAcquired is raised when the advisory lock is held by another session
+	ErrLockNotAcquired = xerrors.New("postgresql: lock is held by another session")
+	// ErrLockLost is raised when the session holding the advisory lock is lost
+	ErrLockLost = xerrors.New("postgresql: lock session lost")
+)
+
+var (
+	// lockLeaseInterval is the delay between two checks of the lock ownership
+	lockLeaseInterval = 5 * time.Second
+	// lockReleaseTimeout is the maximum duration of the lock release
+	lockReleaseTimeout = 5 * time.Second
+)
+
+// lockHeldQuery checks that the advisory lock is still granted to the session,
+// bigint keys are split in classid (high bits) and objid (low bits).
+const lockHeldQuery = `SELECT EXISTS (
+	SELECT 1 FROM pg_locks
+	WHERE locktype = 'advisory' AND granted AND pid = pg_backend_pid()
+	AND classid::bigint = $1 AND objid::bigint = $2 AND objsubid = 1
+)`
+
+// AdvisoryLock is a session level advisory lock held by a dedicated connection.
+type AdvisoryLock struct {
+	name  string
+	key   int64
+	conn  *sql.Conn
+	lease time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu  sync.Mutex
+	err error
+}
+
+// Lock tries to acquire the advisory lock identified by name, it returns
+// ErrLockNotAcquired if the lock is held by another session. The lock is
+// held until Release is called or ctx is done, the ownership of the lock is
+// checked periodically and the lock context is cancelled as soon as it is lost.
+func Lock(ctx context.Context, db *sqlx.DB, name string) (*AdvisoryLock, error) {
+	key := lockKey(name)
+
+	// Advisory locks are bound to the session, use a dedicated connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("postgresql: unable to open lock connection: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired); err != nil {
+		log.SafeClose(conn, "Unable to close lock connection")
+		return nil, xerrors.Errorf("postgresql: unable to acquire lock %q: %w", name, err)
+	}
+	if !acquired {
+		log.SafeClose(conn, "Unable to close lock connection")
+		return nil, ErrLockNotAcquired
+	}
+
+	lock := &AdvisoryLock{
+		name:  name,
+		key:   key,
+		conn:  conn,
+		lease: lockLeaseInterval,
+	}
+	lock.ctx, lock.cancel = context.WithCancel(ctx)
+
+	go lock.renew()
+
+	return lock, nil
+}
+
+// Context returns a context cancelled when the lock is released or lost
+func (l *AdvisoryLock) Context() context.Context {
+	return l.ctx
+}
+
+// Err returns ErrLockLost if the lock session has been lost
+func (l *AdvisoryLock) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Release the lock and its connection, it is safe to call it many times.
+func (l *AdvisoryLock) Release() error {
+	l.cancel()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+	conn := l.conn
+	l.conn = nil
+	defer log.SafeClose(conn, "Unable to close lock connection")
+
+	ctx, cancel := context.WithTimeout(context.Background(), lockReleaseTimeout)
+	defer cancel()
+
+	// Unlock even when the lock is lost, the connection returns to the pool and
+	// must not keep the lock if the check failed for another reason.
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil && l.err == nil {
+		return xerrors.Errorf("postgresql: unable to release lock %q: %w", l.name, err)
+	}
+
+	return nil
+}
+
+// renew checks the lock ownership until the lock is released
+func (l *AdvisoryLock) renew() {
+	ticker := time.NewTicker(l.lease)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.ctx.Done():
+			log.CheckErrCtx(l.ctx, "Unable to release advisory lock", l.Release())
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			conn := l.conn
+			l.mu.Unlock()
+			if conn == nil {
+				return
+			}
+
+			if err := l.check(conn); err != nil && l.ctx.Err() == nil {
+				log.For(l.ctx).Error("Advisory lock lost", zap.String("lock", l.name), zap.Error(err))
+
+				// Stop lock holders before releasing the connection
+				l.mu.Lock()
+				l.err = ErrLockLost
+				l.mu.Unlock()
+				l.cancel()
+
+				log.CheckErrCtx(l.ctx, "Unable to release advisory lock", l.Release())
+				return
+			}
+		}
+	}
+}
+
+// check returns ErrLockLost if the lock is no longer granted to the session
+func (l *AdvisoryLock) check(conn *sql.Conn) error {
+	var held bool
+	if err := conn.QueryRowContext(l.ctx, lockHeldQuery, int64(uint64(l.key)>>32), int64(uint32(l.key))).Scan(&held); err != nil {
+		return xerrors.Errorf("postgresql: unable to check lock %q: %w", l.name, err)
+	}
+	if !held {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// lockKey hashes the lock name to an advisory lock key
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// -----------------------------------------------------------------------------
+
+// Leader returns an actor, to register in a run.Group, running fn only while
+// holding the named lock. Acquisition is retried every retry interval and fn
+// is called again once the lock is reacquired if it has been lost, otherwise
+// the actor stops with the result of fn. The context given to fn is cancelled
+// when the lock is lost or the actor is interrupted.
+func Leader(ctx context.Context, db *sqlx.DB, name string, retry time.Duration, fn func(ctx context.Context) error) (execute func() error, interrupt func(error)) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	execute = func() error {
+		for {
+			lock, err := Lock(ctx, db, name)
+			switch {
+			case err == nil:
+				log.For(ctx).Info("Leadership acquired", zap.String("lock", name))
+
+				err = fn(lock.Context())
+				lost := lock.Err() != nil
+				log.CheckErrCtx(ctx, "Unable to release advisory lock", lock.Release())
+
+				if !lost || ctx.Err() != nil {
+					return err
+				}
+
+				log.For(ctx).Warn("Leadership lost", zap.String("lock", name))
+			case xerrors.Is(err, ErrLockNotAcquired):
+			default:
+				log.For(ctx).Error("Unable to acquire leadership", zap.String("lock", name), zap.Error(err))
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(retry):
+			}
+		}
+	}
+
+	interrupt = func(error) {
+		cancel()
+	}
+
+	return execute, interrupt
+}
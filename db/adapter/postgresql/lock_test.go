@@ -0,0 +1,246 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/xerrors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAdvisoryLock(t *testing.T) {
+	Convey("Given a database", t, func() {
+		previous := lockLeaseInterval
+		lockLeaseInterval = 10 * time.Millisecond
+		Reset(func() {
+			lockLeaseInterval = previous
+		})
+
+		server := &lockServer{holders: map[int64]int{}}
+		conn := sqlx.NewDb(sql.OpenDB(server), "postgres")
+		Reset(func() {
+			_ = conn.Close()
+		})
+
+		ctx := context.Background()
+
+		Convey("When the lock is free", func() {
+			lock, err := Lock(ctx, conn, "migrations")
+
+			Convey("Then it should be acquired", func() {
+				So(err, ShouldBeNil)
+				So(lock, ShouldNotBeNil)
+				So(server.held(lockKey("migrations")), ShouldBeTrue)
+				So(lock.Context().Err(), ShouldBeNil)
+				So(lock.Release(), ShouldBeNil)
+			})
+		})
+
+		Convey("When the lock is held by another session", func() {
+			lock, err := Lock(ctx, conn, "migrations")
+			So(err, ShouldBeNil)
+			defer lock.Release()
+
+			_, err = Lock(ctx, conn, "migrations")
+
+			Convey("Then it should not be acquired", func() {
+				So(xerrors.Is(err, ErrLockNotAcquired), ShouldBeTrue)
+			})
+
+			Convey("Then other locks should be acquired", func() {
+				other, err := Lock(ctx, conn, "jobs")
+				So(err, ShouldBeNil)
+				So(other.Release(), ShouldBeNil)
+			})
+		})
+
+		Convey("When the lock is released", func() {
+			lock, err := Lock(ctx, conn, "migrations")
+			So(err, ShouldBeNil)
+
+			So(lock.Release(), ShouldBeNil)
+			So(lock.Release(), ShouldBeNil)
+
+			Convey("Then the lock context should be cancelled", func() {
+				So(lock.Context().Err(), ShouldEqual, context.Canceled)
+				So(lock.Err(), ShouldBeNil)
+			})
+
+			Convey("Then it should be acquired again", func() {
+				So(server.held(lockKey("migrations")), ShouldBeFalse)
+
+				again, err := Lock(ctx, conn, "migrations")
+				So(err, ShouldBeNil)
+				So(again.Release(), ShouldBeNil)
+			})
+		})
+
+		Convey("When the lock is no longer held by the session", func() {
+			lock, err := Lock(ctx, conn, "migrations")
+			So(err, ShouldBeNil)
+			defer lock.Release()
+
+			server.steal(lockKey("migrations"))
+
+			Convey("Then the lock context should be cancelled", func() {
+				select {
+				case <-lock.Context().Done():
+				case <-time.After(time.Second):
+				}
+				So(lock.Context().Err(), ShouldNotBeNil)
+				So(lock.Err(), ShouldEqual, ErrLockLost)
+			})
+		})
+	})
+}
+
+// -----------------------------------------------------------------------------
+
+// lockServer is a database/sql driver emulating PostgreSQL session level
+// advisory locks, each connection is a session.
+type lockServer struct {
+	mu       sync.Mutex
+	sessions int
+	holders  map[int64]int
+}
+
+func (s *lockServer) Connect(context.Context) (driver.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions++
+	return &lockSession{server: s, id: s.sessions}, nil
+}
+
+func (s *lockServer) Driver() driver.Driver { return nil }
+
+func (s *lockServer) held(key int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.holders[key]
+	return ok
+}
+
+// steal gives the lock to another session
+func (s *lockServer) steal(key int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.holders[key] = -1
+}
+
+type lockSession struct {
+	server *lockServer
+	id     int
+}
+
+func (c *lockSession) Prepare(query string) (driver.Stmt, error) {
+	return &lockStmt{session: c, query: query}, nil
+}
+
+func (c *lockSession) Close() error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	// Session locks are released with the session
+	for key, holder := range c.server.holders {
+		if holder == c.id {
+			delete(c.server.holders, key)
+		}
+	}
+	return nil
+}
+
+func (c *lockSession) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type lockStmt struct {
+	session *lockSession
+	query   string
+}
+
+func (s *lockStmt) Close() error  { return nil }
+func (s *lockStmt) NumInput() int { return -1 }
+
+func (s *lockStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if _, err := s.Query(args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *lockStmt) Query(args []driver.Value) (driver.Rows, error) {
+	server := s.session.server
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	var result bool
+	switch {
+	case strings.Contains(s.query, "pg_try_advisory_lock"):
+		key := args[0].(int64)
+		holder, ok := server.holders[key]
+		result = !ok || holder == s.session.id
+		if result {
+			server.holders[key] = s.session.id
+		}
+	case strings.Contains(s.query, "pg_advisory_unlock"):
+		key := args[0].(int64)
+		result = server.holders[key] == s.session.id
+		if result {
+			delete(server.holders, key)
+		}
+	case strings.Contains(s.query, "pg_locks"):
+		key := int64(uint64(args[0].(int64))<<32 | uint64(args[1].(int64)))
+		result = server.holders[key] == s.session.id
+	default:
+		return nil, driver.ErrSkip
+	}
+
+	return &boolRows{value: result}, nil
+}
+
+type boolRows struct {
+	value bool
+	done  bool
+}
+
+func (r *boolRows) Columns() []string { return []string{"result"} }
+func (r *boolRows) Close() error      { return nil }
+func (r *boolRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
@@ -0,0 +1,128 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+
+	"github.com/scraly/go.pkg/db"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/xerrors"
+)
+
+// Rows returns a cursor over the elements matching the filter, rows are
+// fetched from the server while the cursor is advanced.
+func (d *Default) Rows(ctx context.Context, filter interface{}, sortParams *db.SortParameters) (db.Rows, error) {
+	// Rank is only available to text searches
+	if err := checkRankSort(sortParams); err != nil {
+		return nil, err
+	}
+
+	// Resolve tenant table and connection
+	table, session, release, err := d.target(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prepare query
+	qb := sq.Select(d.columns...).
+		From(table).
+		PlaceholderFormat(sq.Dollar)
+
+	if filter != nil {
+		qb = qb.Where(filter)
+	}
+
+	// Apply sort parameters
+	if sortParams != nil {
+		qb = qb.OrderBy(ConvertSortParameters(*sortParams, d.sortableColumns)...)
+	}
+
+	// Build sql query
+	q, args, err := qb.ToSql()
+	if err != nil {
+		release()
+		return nil, xerrors.Errorf("postgresql: unable to build query: %w", err)
+	}
+
+	// Do the query
+	rows, err := session.QueryxContext(ctx, q, args...)
+	if err != nil {
+		release()
+		return nil, xerrors.Errorf("postgresql: unable to execute query: %w", TranslateError(err))
+	}
+
+	return &cursor{ctx: ctx, rows: rows, decrypt: d.decrypt, release: release}, nil
+}
+
+// Iterate calls fn for each element matching the filter, the next row is only
+// fetched once fn returns. Return db.ErrStopIteration from fn to stop early.
+func (d *Default) Iterate(ctx context.Context, filter interface{}, sortParams *db.SortParameters, fn db.IteratorFunc) error {
+	rows, err := d.Rows(ctx, filter, sortParams)
+	if err != nil {
+		return err
+	}
+
+	return db.Iterate(ctx, rows, fn)
+}
+
+// -----------------------------------------------------------------------------
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+type cursor struct {
+	ctx     context.Context
+	rows    *sqlx.Rows
+	decrypt func(ctx context.Context, result interface{}) error
+	release func()
+}
+
+func (c *cursor) Next(ctx context.Context) bool {
+	return c.rows.Next()
+}
+
+func (c *cursor) Scan(dest interface{}) error {
+	// Scan structs by column names
+	t := reflect.TypeOf(dest)
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct && !t.Implements(scannerType) {
+		if err := c.rows.StructScan(dest); err != nil {
+			return err
+		}
+		return c.decrypt(c.ctx, dest)
+	}
+
+	return c.rows.Scan(dest)
+}
+
+func (c *cursor) Err() error {
+	return c.rows.Err()
+}
+
+func (c *cursor) Close() error {
+	defer c.release()
+	return c.rows.Close()
+}
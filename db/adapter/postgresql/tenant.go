@@ -0,0 +1,225 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2020
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+
+package postgresql
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/scraly/go.pkg/db"
+	"github.com/scraly/go.pkg/log"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// DefaultMaxTenants is the default number of tenant connection pools kept open
+const DefaultMaxTenants = 100
+
+// TenantConnections holds one connection pool per tenant, each pool has its
+// search_path set to the tenant schema. The least recently used pools are
+// evicted when the number of tenants exceeds the limit, an evicted pool is only
+// closed once all the callers using it have released it.
+type TenantConnections struct {
+	cfg          *Configuration
+	resolver     db.TenantResolver
+	maxOpenConns int
+	maxTenants   int
+	open         func(ctx context.Context, schema string) (*sqlx.DB, error)
+
+	mu      sync.Mutex
+	conns   map[string]*list.Element
+	lru     *list.List
+	pending map[string]*tenantOpen
+}
+
+type tenantConn struct {
+	schema  string
+	conn    *sqlx.DB
+	refs    int
+	evicted bool
+}
+
+// tenantOpen is a connection being opened, concurrent callers for the same
+// tenant wait for it instead of opening their own pool.
+type tenantOpen struct {
+	done chan struct{}
+	err  error
+}
+
+// NewTenantConnections returns a tenant connection cache, ContextTenant is used
+// when resolver is nil.
+func NewTenantConnections(cfg *Configuration, resolver db.TenantResolver, maxOpenConns int) *TenantConnections {
+	if resolver == nil {
+		resolver = db.ContextTenant
+	}
+	if maxOpenConns <= 0 {
+		maxOpenConns = 10
+	}
+
+	t := &TenantConnections{
+		cfg:          cfg,
+		resolver:     resolver,
+		maxOpenConns: maxOpenConns,
+		maxTenants:   DefaultMaxTenants,
+		conns:        map[string]*list.Element{},
+		lru:          list.New(),
+		pending:      map[string]*tenantOpen{},
+	}
+	t.open = t.openTenant
+
+	return t
+}
+
+// WithMaxTenants sets the number of tenant connection pools kept open, 0
+// disables the limit.
+func (t *TenantConnections) WithMaxTenants(maxTenants int) *TenantConnections {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.maxTenants = maxTenants
+	t.evict()
+	return t
+}
+
+// Get returns the connection pool of the tenant attached to the context, the
+// pool is opened on first use.
+//
+// The returned release function must be called once the pool is no longer
+// used, the pool is not closed by an eviction before.
+func (t *TenantConnections) Get(ctx context.Context) (*sqlx.DB, func(), error) {
+	schema, err := t.resolver(ctx)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("postgresql: unable to resolve tenant: %w", err)
+	}
+
+	for {
+		t.mu.Lock()
+		if elem, ok := t.conns[schema]; ok {
+			t.lru.MoveToFront(elem)
+			tc := elem.Value.(*tenantConn)
+			tc.refs++
+			t.mu.Unlock()
+			return tc.conn, t.releaser(tc), nil
+		}
+
+		// Wait for the caller opening the same tenant
+		call, ok := t.pending[schema]
+		if !ok {
+			break
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-call.done:
+			if call.err != nil {
+				return nil, nil, call.err
+			}
+			// Look the pool up again, it may have been evicted meanwhile
+		case <-ctx.Done():
+			return nil, nil, xerrors.Errorf("postgresql: unable to open connection for tenant %q: %w", schema, ctx.Err())
+		}
+	}
+
+	call := &tenantOpen{done: make(chan struct{})}
+	t.pending[schema] = call
+	t.mu.Unlock()
+
+	// Open outside the lock, connection retries may take a while
+	conn, err := t.open(ctx, schema)
+	if err != nil {
+		call.err = xerrors.Errorf("postgresql: unable to open connection for tenant %q: %w", schema, err)
+	}
+
+	var tc *tenantConn
+	t.mu.Lock()
+	delete(t.pending, schema)
+	if call.err == nil {
+		tc = &tenantConn{schema: schema, conn: conn, refs: 1}
+		t.conns[schema] = t.lru.PushFront(tc)
+		t.evict()
+	}
+	t.mu.Unlock()
+	close(call.done)
+
+	if call.err != nil {
+		return nil, nil, call.err
+	}
+	return conn, t.releaser(tc), nil
+}
+
+// Close all tenant connection pools
+func (t *TenantConnections) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for schema, elem := range t.conns {
+		log.SafeClose(elem.Value.(*tenantConn).conn, "Unable to close tenant database connection", zap.String("tenant", schema))
+		delete(t.conns, schema)
+	}
+	t.lru.Init()
+
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+// openTenant opens a connection pool using the tenant schema as search_path.
+func (t *TenantConnections) openTenant(ctx context.Context, schema string) (*sqlx.DB, error) {
+	return open(ctx, t.cfg, map[string]string{
+		"search_path": pq.QuoteIdentifier(schema),
+	}, t.maxOpenConns)
+}
+
+// evict removes the least recently used pools above the limit, the pools which
+// are not in use are closed. The lock must be held.
+func (t *TenantConnections) evict() {
+	for t.maxTenants > 0 && t.lru.Len() > t.maxTenants {
+		tc := t.lru.Remove(t.lru.Back()).(*tenantConn)
+		delete(t.conns, tc.schema)
+		tc.evicted = true
+		if tc.refs == 0 {
+			log.SafeClose(tc.conn, "Unable to close tenant database connection", zap.String("tenant", tc.schema))
+		}
+	}
+}
+
+// releaser returns the function releasing a reference to the pool, an evicted
+// pool is closed with its last reference.
+func (t *TenantConnections) releaser(tc *tenantConn) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			tc.refs--
+			if tc.evicted && tc.refs == 0 {
+				log.SafeClose(tc.conn, "Unable to close tenant database connection", zap.String("tenant", tc.schema))
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/scraly/go.pkg/db"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTenantConnections(t *testing.T) {
+	Convey("Given tenant connections limited to one pool", t, func() {
+		var (
+			mu     sync.Mutex
+			opened = map[string]*sqlx.DB{}
+		)
+
+		tenants := NewTenantConnections(&Configuration{}, nil, 1).WithMaxTenants(1)
+		tenants.open = func(ctx context.Context, schema string) (*sqlx.DB, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			conn := sqlx.NewDb(sql.OpenDB(&lockServer{holders: map[int64]int{}}), "postgres")
+			opened[schema] = conn
+			return conn, nil
+		}
+		Reset(func() {
+			_ = tenants.Close()
+		})
+
+		ping := func(conn *sqlx.DB) error {
+			var ok bool
+			return conn.QueryRowx("SELECT pg_try_advisory_lock($1)", int64(1)).Scan(&ok)
+		}
+
+		Convey("When a pool in use is evicted by another tenant", func() {
+			first, release, err := tenants.Get(db.WithTenant(context.Background(), "first"))
+			So(err, ShouldBeNil)
+
+			done := make(chan error)
+			go func() {
+				_, releaseSecond, err := tenants.Get(db.WithTenant(context.Background(), "second"))
+				if err == nil {
+					releaseSecond()
+				}
+				done <- err
+			}()
+			So(<-done, ShouldBeNil)
+
+			Convey("Then it should stay open until released", func() {
+				So(ping(first), ShouldBeNil)
+
+				release()
+				So(ping(first), ShouldNotBeNil)
+
+				// Released twice is harmless
+				release()
+			})
+
+			Convey("Then the tenant should get a new pool", func() {
+				again, releaseAgain, err := tenants.Get(db.WithTenant(context.Background(), "first"))
+				So(err, ShouldBeNil)
+				defer releaseAgain()
+
+				So(again, ShouldNotEqual, first)
+				So(ping(again), ShouldBeNil)
+				So(ping(first), ShouldBeNil)
+				release()
+			})
+		})
+
+		Convey("When a pool which is not in use is evicted", func() {
+			_, release, err := tenants.Get(db.WithTenant(context.Background(), "first"))
+			So(err, ShouldBeNil)
+			release()
+
+			_, releaseSecond, err := tenants.Get(db.WithTenant(context.Background(), "second"))
+			So(err, ShouldBeNil)
+			defer releaseSecond()
+
+			Convey("Then it should be closed", func() {
+				mu.Lock()
+				defer mu.Unlock()
+				So(ping(opened["first"]), ShouldNotBeNil)
+			})
+		})
+	})
+}
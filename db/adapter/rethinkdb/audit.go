@@ -0,0 +1,97 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package rethinkdb
+
+import (
+	"context"
+
+	"github.com/scraly/go.pkg/db"
+
+	"golang.org/x/xerrors"
+	r "gopkg.in/rethinkdb/rethinkdb-go.v5"
+)
+
+// WithAudit records the writes executed on the table to the given sink
+func (d *Default) WithAudit(sink db.AuditSink) *Default {
+	d.audit = sink
+	return d
+}
+
+// AuditTable returns an audit sink inserting records in the given table
+func AuditTable(session *r.Session, table string) db.AuditSink {
+	return db.AuditSinkFunc(func(ctx context.Context, record *db.AuditRecord) error {
+		_, err := r.Table(table).Insert(map[string]interface{}{
+			"table":      record.Table,
+			"action":     string(record.Action),
+			"entity":     record.Entity,
+			"actor":      record.Actor,
+			"trace_id":   record.TraceID,
+			"before":     record.Before,
+			"after":      record.After,
+			"changes":    record.Changes,
+			"created_at": record.Timestamp,
+		}).RunWrite(session, r.RunOpts{
+			Context: ctx,
+		})
+		if err != nil {
+			return xerrors.Errorf("rethinkdb: unable to insert audit record: %w", err)
+		}
+		return nil
+	})
+}
+
+// -----------------------------------------------------------------------------
+
+// recordChanges sends one audit record per change returned by the write, the
+// write is never rolled back when a required audit fails.
+func (d *Default) recordChanges(ctx context.Context, res r.WriteResponse) error {
+	if d.audit == nil {
+		return nil
+	}
+
+	for _, change := range res.Changes {
+		before, _ := change.OldValue.(map[string]interface{})
+		after, _ := change.NewValue.(map[string]interface{})
+
+		var (
+			action = db.AuditUpdate
+			entity interface{}
+		)
+		switch {
+		case before == nil && after == nil:
+			continue
+		case before == nil:
+			action, entity = db.AuditCreate, after["id"]
+		case after == nil:
+			action, entity = db.AuditDelete, before["id"]
+		default:
+			entity = after["id"]
+		}
+
+		if err := db.Audit(ctx, d.audit, db.NewAuditRecord(ctx, d.table, action, entity, before, after)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -24,53 +24,170 @@ package rethinkdb
 
 import (
 	"context"
+	"time"
 
+	"go.uber.org/zap"
 	"golang.org/x/xerrors"
-
+	try "gopkg.in/matryer/try.v1"
 	r "gopkg.in/rethinkdb/rethinkdb-go.v5"
+
+	"github.com/scraly/go.pkg/log"
+	"github.com/scraly/go.pkg/tlsconfig"
 )
 
 // Configuration repesents database connection configuration
 type Configuration struct {
-	AutoMigrate bool
-	Addresses   []string
-	Database    string
-	Username    string
-	Password    string
-	AuthKey     string
+	AutoMigrate          bool          `toml:"autoMigrate" default:"false" comment:"Create declared indexes on startup"`
+	DropUnmanagedIndexes bool          `toml:"dropUnmanagedIndexes" default:"false" comment:"Drop indexes not declared by the application during migration"`
+	Addresses            []string      `toml:"addresses" default:"localhost:28015" comment:"RethinkDB server addresses"`
+	Database             string        `toml:"database" default:"" comment:"Default database name"`
+	Username             string        `toml:"username" default:"" comment:"Authentication username"`
+	Password             string        `toml:"password" default:"" comment:"Authentication password"`
+	AuthKey              string        `toml:"authKey" default:"" comment:"Authentication key (RethinkDB < 2.3)"`
+	DiscoverHosts        bool          `toml:"discoverHosts" default:"false" comment:"Discover the other nodes of the cluster from the given addresses"`
+	InitialPoolSize      int           `toml:"initialPoolSize" default:"10" comment:"Number of connections opened per node on startup"`
+	MaxPoolSize          int           `toml:"maxPoolSize" default:"10" comment:"Maximum number of connections per node"`
+	MaxRetries           int           `toml:"maxRetries" default:"5" comment:"Maximum number of retries of a failed query"`
+	ConnectTimeout       time.Duration `toml:"connectTimeout" default:"10s" comment:"Maximum duration to establish the connection, retries included"`
+	ReadTimeout          time.Duration `toml:"readTimeout" default:"0s" comment:"Socket read timeout, 0 to disable"`
+	WriteTimeout         time.Duration `toml:"writeTimeout" default:"0s" comment:"Socket write timeout, 0 to disable"`
+	UseTLS               bool          `toml:"useTLS" default:"false" comment:"Enable TLS connection"`
+	TLS                  struct {
+		CertificatePath    string `toml:"certificatePath" default:"" comment:"Client certificate path"`
+		PrivateKeyPath     string `toml:"privateKeyPath" default:"" comment:"Client private key path"`
+		CACertificatePath  string `toml:"caCertificatePath" default:"" comment:"CA certificate path"`
+		InsecureSkipVerify bool   `toml:"insecureSkipVerify" default:"false" comment:"Disable server certificate verification"`
+	} `toml:"TLS" comment:"TLS settings"`
+}
+
+// Validate checks that the configuration is valid.
+func (c *Configuration) Validate() error {
+	if len(c.Addresses) == 0 {
+		return xerrors.New("rethinkdb: at least one server address is required")
+	}
+	if c.InitialPoolSize < 0 || c.MaxPoolSize < 0 {
+		return xerrors.New("rethinkdb: pool sizes must not be negative")
+	}
+	if c.MaxPoolSize > 0 && c.InitialPoolSize > c.MaxPoolSize {
+		return xerrors.New("rethinkdb: initial pool size must not exceed maximum pool size")
+	}
+	return nil
 }
 
-// Connection provides Wire provider for a PostgreSQL database connection
+// Connection provides Wire provider for a RethinkDB database connection
 func Connection(ctx context.Context, cfg *Configuration) (*r.Session, error) {
+	// Validate config first
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	opts, err := cfg.connectOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	log.For(ctx).Info("Trying to connect to RethinkDB servers ...")
+
+	timeout := cfg.ConnectTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+
+	var session *r.Session
+	err = try.Do(func(attempt int) (bool, error) {
+		var err error
+
+		// Initialize a new setup connection
+		session, err = r.Connect(opts)
+		if err != nil {
+			log.For(ctx).Warn("Unable to connect to RethinkDB", zap.Int("attempt", attempt), zap.Error(err))
+
+			retry := time.Now().Before(deadline) && ctx.Err() == nil
+			if retry {
+				time.Sleep(backoff(attempt))
+			}
+			return retry, xerrors.Errorf("rethinkdb: unable to connect to server: %w", TranslateError(err))
+		}
+
+		return false, nil
+	})
+	if err != nil {
+		log.For(ctx).Error("Unable to connect to RethinkDB", zap.Error(err))
+		return nil, err
+	}
+
+	log.For(ctx).Info("Connected to RethinkDB.")
+
+	// Return connection
+	return session, nil
+}
+
+// -----------------------------------------------------------------------------
+
+func (c *Configuration) connectOptions() (r.ConnectOpts, error) {
 	// Prepare options
 	opts := r.ConnectOpts{
-		Addresses:  cfg.Addresses,
-		Database:   cfg.Database,
-		InitialCap: 10,
-		MaxOpen:    10,
-		NumRetries: 5,
+		Addresses:     c.Addresses,
+		Database:      c.Database,
+		InitialCap:    10,
+		MaxOpen:       10,
+		NumRetries:    5,
+		DiscoverHosts: c.DiscoverHosts,
+		ReadTimeout:   c.ReadTimeout,
+		WriteTimeout:  c.WriteTimeout,
 	}
 
-	// Optional parameters
-	if cfg.AuthKey != "" {
-		opts.AuthKey = cfg.AuthKey
+	// Pool settings
+	if c.InitialPoolSize > 0 {
+		opts.InitialCap = c.InitialPoolSize
 	}
-	if cfg.Username != "" {
-		opts.Username = cfg.Username
+	if c.MaxPoolSize > 0 {
+		opts.MaxOpen = c.MaxPoolSize
 	}
-	if cfg.Password != "" {
-		opts.Password = cfg.Password
+	if c.MaxRetries > 0 {
+		opts.NumRetries = c.MaxRetries
 	}
 
-	// Activate Opentracing
-	opts.UseOpentracing = true
+	// Optional parameters
+	if c.AuthKey != "" {
+		opts.AuthKey = c.AuthKey
+	}
+	if c.Username != "" {
+		opts.Username = c.Username
+	}
+	if c.Password != "" {
+		opts.Password = c.Password
+	}
+	if c.ConnectTimeout > 0 {
+		opts.Timeout = c.ConnectTimeout
+	}
 
-	// Initialize a new setup connection
-	conn, err := r.Connect(opts)
-	if err != nil {
-		return nil, xerrors.Errorf("rethinkdb: unable to connect to server: %w", err)
+	// Enable TLS if requested
+	if c.UseTLS {
+		tlsConfig, err := tlsconfig.Client(tlsconfig.Options{
+			CAFile:             c.TLS.CACertificatePath,
+			CertFile:           c.TLS.CertificatePath,
+			KeyFile:            c.TLS.PrivateKeyPath,
+			InsecureSkipVerify: c.TLS.InsecureSkipVerify,
+		})
+		if err != nil {
+			return opts, xerrors.Errorf("rethinkdb: unable to initialize TLS settings: %w", err)
+		}
+		opts.TLSConfig = tlsConfig
 	}
 
-	// Return connection
-	return conn, nil
+	return opts, nil
+}
+
+// backoff returns the exponential delay before the given connection attempt
+func backoff(attempt int) time.Duration {
+	delay := 100 * time.Millisecond
+	for i := 1; i < attempt && delay < 5*time.Second; i++ {
+		delay *= 2
+	}
+	if delay > 5*time.Second {
+		delay = 5 * time.Second
+	}
+	return delay
 }
@@ -36,6 +36,8 @@ type Default struct {
 	table   string
 	db      string
 	session *r.Session
+
+	audit db.AuditSink
 }
 
 // NewCRUDTable sets up a new Default struct
@@ -47,6 +49,16 @@ func NewCRUDTable(session *r.Session, db, table string) *Default {
 	}
 }
 
+// NewMigratedCRUDTable sets up a new Default struct and applies the given
+// index specifications when AutoMigrate is enabled in the configuration.
+func NewMigratedCRUDTable(ctx context.Context, cfg *Configuration, session *r.Session, database, table string, specs ...db.IndexSpec) (*Default, error) {
+	d := NewCRUDTable(session, database, table)
+	if err := d.Migrate(ctx, cfg, specs...); err != nil {
+		return nil, xerrors.Errorf("rethinkdb: unable to migrate table %q: %w", table, err)
+	}
+	return d, nil
+}
+
 // -----------------------------------------------------------------------------
 
 // GetTableName returns table's name
@@ -73,41 +85,35 @@ func (d *Default) GetSession() interface{} {
 
 // Insert inserts a document into the database
 func (d *Default) Insert(ctx context.Context, data interface{}) error {
-	_, err := r.Table(d.table).Insert(data).RunWrite(d.session, r.RunOpts{
-		Context: ctx,
-	})
+	res, err := d.runWrite(ctx, "Insert", r.Table(d.table).Insert(data, r.InsertOpts{ReturnChanges: d.audit != nil}))
 	if err != nil {
 		if err == r.ErrEmptyResult {
 			return db.ErrNoResult
 		}
-		return xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+		return xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 	}
 
-	return nil
+	return d.recordChanges(ctx, res)
 }
 
 // InsertOrUpdate a document occording to ID presence in database
 func (d *Default) InsertOrUpdate(ctx context.Context, id interface{}, data interface{}) error {
-	_, err := r.Table(d.table).Insert(data, r.InsertOpts{Conflict: "update"}).RunWrite(d.session, r.RunOpts{
-		Context: ctx,
-	})
+	res, err := d.runWrite(ctx, "InsertOrUpdate", r.Table(d.table).Insert(data, r.InsertOpts{Conflict: "update", ReturnChanges: d.audit != nil}))
 	if err != nil {
 		if err == r.ErrEmptyResult {
 			return db.ErrNoResult
 		}
-		return xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+		return xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 	}
 
-	return nil
+	return d.recordChanges(ctx, res)
 }
 
 // Find a document match given id
 func (d *Default) Find(ctx context.Context, id interface{}, value interface{}) error {
-	cursor, err := r.Table(d.table).Get(id).Run(d.session, r.RunOpts{
-		Context: ctx,
-	})
+	cursor, err := d.run(ctx, "Find", r.Table(d.table).Get(id))
 	if err != nil {
-		return xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+		return xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 	}
 
 	if err := cursor.One(value); err != nil {
@@ -122,11 +128,9 @@ func (d *Default) Find(ctx context.Context, id interface{}, value interface{}) e
 
 // FindOneBy a couple (k = v) in the database
 func (d *Default) FindOneBy(ctx context.Context, key string, value interface{}, result interface{}) error {
-	cursor, err := r.Table(d.table).GetAllByIndex(key, value).Run(d.session, r.RunOpts{
-		Context: ctx,
-	})
+	cursor, err := d.run(ctx, "FindOneBy", r.Table(d.table).GetAllByIndex(key, value))
 	if err != nil {
-		return xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+		return xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 	}
 
 	if err := cursor.One(result); err != nil {
@@ -141,13 +145,11 @@ func (d *Default) FindOneBy(ctx context.Context, key string, value interface{},
 
 // FindBy all couples (k = v) in the database
 func (d *Default) FindBy(ctx context.Context, key string, value interface{}, results interface{}) error {
-	cursor, err := r.Table(d.table).Filter(func(row r.Term) r.Term {
+	cursor, err := d.run(ctx, "FindBy", r.Table(d.table).Filter(func(row r.Term) r.Term {
 		return row.Field(key).Eq(value)
-	}).Run(d.session, r.RunOpts{
-		Context: ctx,
-	})
+	}))
 	if err != nil {
-		return xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+		return xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 	}
 
 	if err := cursor.All(results); err != nil {
@@ -162,13 +164,11 @@ func (d *Default) FindBy(ctx context.Context, key string, value interface{}, res
 
 // FindByAndCount is used to count object that matchs the (key = value) predicate
 func (d *Default) FindByAndCount(ctx context.Context, key string, value interface{}) (int, error) {
-	cursor, err := r.Table(d.table).Filter(func(row r.Term) r.Term {
+	cursor, err := d.run(ctx, "FindByAndCount", r.Table(d.table).Filter(func(row r.Term) r.Term {
 		return row.Field(key).Eq(value)
-	}).Count().Run(d.session, r.RunOpts{
-		Context: ctx,
-	})
+	}).Count())
 	if err != nil {
-		return 0, xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+		return 0, xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 	}
 
 	var count int
@@ -184,11 +184,9 @@ func (d *Default) FindByAndCount(ctx context.Context, key string, value interfac
 
 // Where is used to fetch documents that match th filter from the database
 func (d *Default) Where(ctx context.Context, filter interface{}, results interface{}) error {
-	cursor, err := r.Table(d.table).Filter(filter).Run(d.session, r.RunOpts{
-		Context: ctx,
-	})
+	cursor, err := d.run(ctx, "Where", r.Table(d.table).Filter(filter))
 	if err != nil {
-		return xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+		return xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 	}
 
 	if err := cursor.All(results); err != nil {
@@ -203,11 +201,9 @@ func (d *Default) Where(ctx context.Context, filter interface{}, results interfa
 
 // WhereCount returns the document count that match the filter
 func (d *Default) WhereCount(ctx context.Context, filter interface{}) (int, error) {
-	cursor, err := r.Table(d.table).Filter(filter).Count().Run(d.session, r.RunOpts{
-		Context: ctx,
-	})
+	cursor, err := d.run(ctx, "WhereCount", r.Table(d.table).Filter(filter).Count())
 	if err != nil {
-		return 0, xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+		return 0, xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 	}
 
 	var count int
@@ -223,11 +219,9 @@ func (d *Default) WhereCount(ctx context.Context, filter interface{}) (int, erro
 
 // WhereAndFetchOne returns one document that match the filter
 func (d *Default) WhereAndFetchOne(ctx context.Context, filter interface{}, result interface{}) error {
-	cursor, err := r.Table(d.table).Filter(filter).Run(d.session, r.RunOpts{
-		Context: ctx,
-	})
+	cursor, err := d.run(ctx, "WhereAndFetchOne", r.Table(d.table).Filter(filter))
 	if err != nil {
-		return xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+		return xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 	}
 
 	if err := cursor.One(result); err != nil {
@@ -242,11 +236,9 @@ func (d *Default) WhereAndFetchOne(ctx context.Context, filter interface{}, resu
 
 // WhereAndFetchLimit returns paginated list of document
 func (d *Default) WhereAndFetchLimit(ctx context.Context, filter interface{}, paginator *db.Pagination, results interface{}) error {
-	cursor, err := r.Table(d.table).Filter(filter).Run(d.session, r.RunOpts{
-		Context: ctx,
-	})
+	cursor, err := d.run(ctx, "WhereAndFetchLimit", r.Table(d.table).Filter(filter))
 	if err != nil {
-		return xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+		return xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 	}
 
 	if err := cursor.All(results); err != nil {
@@ -261,44 +253,38 @@ func (d *Default) WhereAndFetchLimit(ctx context.Context, filter interface{}, pa
 
 // Update a document that match the selector
 func (d *Default) Update(ctx context.Context, selector interface{}, data interface{}) error {
-	_, err := r.Table(d.table).Filter(selector).Update(data).RunWrite(d.session, r.RunOpts{
-		Context: ctx,
-	})
+	res, err := d.runWrite(ctx, "Update", r.Table(d.table).Filter(selector).Update(data, r.UpdateOpts{ReturnChanges: d.audit != nil}))
 	if err != nil {
 		if err == r.ErrEmptyResult {
 			return db.ErrNoResult
 		}
-		return xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+		return xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 	}
 
-	return nil
+	return d.recordChanges(ctx, res)
 }
 
 // UpdateID updates a document using his id
 func (d *Default) UpdateID(ctx context.Context, id interface{}, data interface{}) error {
-	_, err := r.Table(d.table).Get(id).Update(data).RunWrite(d.session, r.RunOpts{
-		Context: ctx,
-	})
+	res, err := d.runWrite(ctx, "UpdateID", r.Table(d.table).Get(id).Update(data, r.UpdateOpts{ReturnChanges: d.audit != nil}))
 	if err != nil {
 		if err == r.ErrEmptyResult {
 			return db.ErrNoResult
 		}
-		return xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+		return xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 	}
 
-	return nil
+	return d.recordChanges(ctx, res)
 }
 
 // DeleteAll documents from the database
 func (d *Default) DeleteAll(ctx context.Context, pred interface{}) error {
-	_, err := r.Table(d.table).Filter(pred).Delete().RunWrite(d.session, r.RunOpts{
-		Context: ctx,
-	})
+	_, err := d.runWrite(ctx, "DeleteAll", r.Table(d.table).Filter(pred).Delete())
 	if err != nil {
 		if err == r.ErrEmptyResult {
 			return db.ErrNoResult
 		}
-		return xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+		return xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 	}
 
 	return nil
@@ -306,17 +292,15 @@ func (d *Default) DeleteAll(ctx context.Context, pred interface{}) error {
 
 // Delete a document from the database
 func (d *Default) Delete(ctx context.Context, id interface{}) error {
-	_, err := r.Table(d.table).Get(id).Delete().RunWrite(d.session, r.RunOpts{
-		Context: ctx,
-	})
+	res, err := d.runWrite(ctx, "Delete", r.Table(d.table).Get(id).Delete(r.DeleteOpts{ReturnChanges: d.audit != nil}))
 	if err != nil {
 		if err == r.ErrEmptyResult {
 			return db.ErrNoResult
 		}
-		return xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+		return xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 	}
 
-	return nil
+	return d.recordChanges(ctx, res)
 }
 
 // List all entities from the database
@@ -337,7 +321,7 @@ func (d *Default) Search(ctx context.Context, results interface{}, filter interf
 	if pagination != nil {
 		total, err := d.WhereCount(ctx, filter)
 		if err != nil {
-			return xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+			return xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 		}
 		pagination.SetTotal(uint(total))
 	}
@@ -353,11 +337,9 @@ func (d *Default) Search(ctx context.Context, results interface{}, filter interf
 	}
 
 	// Run the query
-	cursor, err := term.Run(d.session, r.RunOpts{
-		Context: ctx,
-	})
+	cursor, err := d.run(ctx, "Search", term)
 	if err != nil {
-		return xerrors.Errorf("rethinkdb: unable to execute query: %w", err)
+		return xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
 	}
 
 	// Fetch cursor
@@ -0,0 +1,206 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build integration
+// +build integration
+
+package rethinkdb
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/scraly/go.pkg/db"
+	"github.com/scraly/go.pkg/testing/containers/database"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.opencensus.io/trace"
+	r "gopkg.in/rethinkdb/rethinkdb-go.v5"
+)
+
+type user struct {
+	ID    string `rethinkdb:"id"`
+	Login string `rethinkdb:"login"`
+	Age   int    `rethinkdb:"age"`
+}
+
+var (
+	session      *r.Session
+	databaseName string
+)
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+
+	var err error
+	session, databaseName, err = database.ConnectToRethinkDB(ctx)
+	if err != nil {
+		panic(err)
+	}
+	session.Use(databaseName)
+
+	code := m.Run()
+
+	database.KillAll(ctx)
+	os.Exit(code)
+}
+
+// spanRecorder collects the spans exported during a test
+type spanRecorder struct {
+	sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (e *spanRecorder) ExportSpan(s *trace.SpanData) {
+	e.Lock()
+	defer e.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+func (e *spanRecorder) names() []string {
+	e.Lock()
+	defer e.Unlock()
+	names := make([]string, 0, len(e.spans))
+	for _, s := range e.spans {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func newTable(ctx context.Context, table string) *Default {
+	_, err := r.DB(databaseName).TableCreate(table).RunWrite(session)
+	So(err, ShouldBeNil)
+
+	users := NewCRUDTable(session, databaseName, table)
+
+	login := db.NewIndex("login")
+	login.Name = "login"
+	So(users.EnsureIndexes(ctx, login), ShouldBeNil)
+
+	return users
+}
+
+func TestDefault(t *testing.T) {
+	Convey("Given a RethinkDB table", t, func() {
+		ctx := context.Background()
+
+		users := newTable(ctx, "users")
+		Reset(func() {
+			_, err := r.DB(databaseName).TableDrop("users").RunWrite(session)
+			So(err, ShouldBeNil)
+		})
+
+		for i, login := range []string{"alice", "bob", "carol", "dave", "eve"} {
+			So(users.Insert(ctx, &user{ID: login, Login: login, Age: 20 + i}), ShouldBeNil)
+		}
+
+		Convey("When finding a document by id", func() {
+			var result user
+			err := users.Find(ctx, "bob", &result)
+
+			Convey("Then the document should be decoded", func() {
+				So(err, ShouldBeNil)
+				So(result.Login, ShouldEqual, "bob")
+				So(result.Age, ShouldEqual, 21)
+			})
+		})
+
+		Convey("When finding a document by a secondary index", func() {
+			var result user
+			err := users.FindOneBy(ctx, "login", "carol", &result)
+
+			Convey("Then the document should be decoded", func() {
+				So(err, ShouldBeNil)
+				So(result.ID, ShouldEqual, "carol")
+			})
+		})
+
+		Convey("When finding a missing document", func() {
+			var result user
+			err := users.Find(ctx, "mallory", &result)
+
+			Convey("Then ErrNoResult should be returned", func() {
+				So(err, ShouldEqual, db.ErrNoResult)
+			})
+		})
+
+		Convey("When updating a document", func() {
+			err := users.UpdateID(ctx, "alice", map[string]interface{}{"age": 42})
+			So(err, ShouldBeNil)
+
+			Convey("Then the change should be persisted", func() {
+				var result user
+				So(users.Find(ctx, "alice", &result), ShouldBeNil)
+				So(result.Age, ShouldEqual, 42)
+			})
+		})
+
+		Convey("When deleting a document", func() {
+			err := users.Delete(ctx, "dave")
+			So(err, ShouldBeNil)
+
+			Convey("Then the document should be gone", func() {
+				var result user
+				So(users.Find(ctx, "dave", &result), ShouldEqual, db.ErrNoResult)
+
+				count, err := users.WhereCount(ctx, map[string]interface{}{})
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 4)
+			})
+		})
+
+		Convey("When searching the second page", func() {
+			var results []user
+			pagination := db.NewPaginator(2, 2)
+			err := users.Search(ctx, &results, nil, &db.SortParameters{{FieldName: "age", Direction: db.Ascending}}, pagination)
+
+			Convey("Then the page should be sliced and the total set", func() {
+				So(err, ShouldBeNil)
+				So(pagination.Total(), ShouldEqual, 5)
+				So(results, ShouldHaveLength, 2)
+				So(results[0].Login, ShouldEqual, "carol")
+				So(results[1].Login, ShouldEqual, "dave")
+			})
+		})
+
+		Convey("When running queries with tracing enabled", func() {
+			recorder := &spanRecorder{}
+			trace.RegisterExporter(recorder)
+			Reset(func() {
+				trace.UnregisterExporter(recorder)
+			})
+
+			ctx, span := trace.StartSpan(ctx, "test", trace.WithSampler(trace.AlwaysSample()))
+			var result user
+			So(users.Find(ctx, "eve", &result), ShouldBeNil)
+			So(users.UpdateID(ctx, "eve", map[string]interface{}{"age": 18}), ShouldBeNil)
+			span.End()
+
+			Convey("Then a client span should be exported per query", func() {
+				So(recorder.names(), ShouldContain, "rethinkdb.Find")
+				So(recorder.names(), ShouldContain, "rethinkdb.UpdateID")
+			})
+		})
+	})
+}
@@ -0,0 +1,80 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package rethinkdb
+
+import (
+	"context"
+	"net"
+	"regexp"
+
+	"github.com/scraly/go.pkg/db"
+
+	"golang.org/x/xerrors"
+	r "gopkg.in/rethinkdb/rethinkdb-go.v5"
+)
+
+// primaryKeyField extracts the field name from duplicate primary key messages
+var primaryKeyField = regexp.MustCompile("^Duplicate primary key `([^`]+)`")
+
+// TranslateError classifies RethinkDB driver errors as db errors, unknown
+// errors are returned unchanged.
+func TranslateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// Already classified
+	var dbErr *db.Error
+	if xerrors.As(err, &dbErr) {
+		return err
+	}
+
+	var (
+		timeoutErr      r.RQLTimeoutError
+		connectionErr   r.RQLConnectionError
+		opFailedErr     r.RQLOpFailedError
+		availabilityErr r.RQLAvailabilityError
+		netErr          net.Error
+	)
+
+	switch {
+	case r.IsConflictErr(err):
+		field := ""
+		if m := primaryKeyField.FindStringSubmatch(err.Error()); m != nil {
+			field = m[1]
+		}
+		return db.NewError(db.ErrDuplicateKey, "primary", field, err)
+	case xerrors.As(err, &timeoutErr), xerrors.Is(err, r.ErrQueryTimeout), xerrors.Is(err, context.DeadlineExceeded):
+		return db.NewError(db.ErrTimeout, "", "", err)
+	case xerrors.As(err, &connectionErr), xerrors.As(err, &opFailedErr), xerrors.As(err, &availabilityErr),
+		xerrors.Is(err, r.ErrConnectionClosed), xerrors.Is(err, r.ErrNoConnections), xerrors.Is(err, r.ErrNoConnectionsStarted):
+		return db.NewError(db.ErrConnection, "", "", err)
+	case xerrors.As(err, &netErr):
+		if netErr.Timeout() {
+			return db.NewError(db.ErrTimeout, "", "", err)
+		}
+		return db.NewError(db.ErrConnection, "", "", err)
+	}
+
+	return err
+}
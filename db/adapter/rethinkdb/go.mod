@@ -2,8 +2,13 @@ module github.com/scraly/go.pkg/db/adapter/rethinkdb
 
 go 1.12
 
+replace github.com/opencensus-integrations/gomongowrapper => github.com/Zenithar/gomongowrapper v0.0.2
+
 require (
 	github.com/scraly/go.pkg/db v0.0.8
+	github.com/scraly/go.pkg/log v0.0.13
+	github.com/scraly/go.pkg/testing v0.0.1
+	github.com/scraly/go.pkg/tlsconfig v0.0.4
 	github.com/bitly/go-hostpool v0.0.0-20171023180738-a3a6125de932 // indirect
 	github.com/bmizerany/assert v0.0.0-20160611221934-b7ed37b82869 // indirect
 	github.com/cenkalti/backoff v2.1.1+incompatible // indirect
@@ -13,10 +18,14 @@ require (
 	github.com/opentracing/opentracing-go v1.1.0 // indirect
 	github.com/sirupsen/logrus v1.4.1 // indirect
 	github.com/smartystreets/assertions v0.0.0-20190401211740-f487f9de1cd3 // indirect
+	github.com/smartystreets/goconvey v1.6.4
 	github.com/stretchr/objx v0.2.0 // indirect
+	go.opencensus.io v0.22.2
+	go.uber.org/zap v1.10.0
 	golang.org/x/crypto v0.0.0-20190418165655-df01cb2cc480 // indirect
 	golang.org/x/net v0.0.0-20190420063019-afa5a82059c6 // indirect
 	golang.org/x/sys v0.0.0-20190419153524-e8e3143a4f4a // indirect
 	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543
+	gopkg.in/matryer/try.v1 v1.0.0-20150601225556-312d2599e12e
 	gopkg.in/rethinkdb/rethinkdb-go.v5 v5.0.1
 )
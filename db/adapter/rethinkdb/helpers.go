@@ -27,6 +27,7 @@ import (
 
 	"github.com/scraly/go.pkg/db"
 
+	"golang.org/x/xerrors"
 	r "gopkg.in/rethinkdb/rethinkdb-go.v5"
 )
 
@@ -54,3 +55,27 @@ func ConvertSortParameters(params db.SortParameters) []interface{} {
 
 	return sorts
 }
+
+// ConvertSortIndex converts sort parameters to the secondary index used to
+// sort a table without loading it in memory. The index is named after the
+// sorted fields joined with an underscore, as created by EnsureIndexes for
+// unnamed specifications, and all fields must be sorted in the same direction.
+func ConvertSortIndex(params db.SortParameters) (interface{}, error) {
+	if len(params) == 0 {
+		return r.Asc("id"), nil
+	}
+
+	names := make([]string, 0, len(params))
+	for _, param := range params {
+		if (param.Direction == db.Descending) != (params[0].Direction == db.Descending) {
+			return nil, xerrors.New("rethinkdb: sorting by fields in different directions requires an in-memory sort")
+		}
+		names = append(names, strings.ToLower(param.FieldName))
+	}
+
+	index := strings.Join(names, "_")
+	if params[0].Direction == db.Descending {
+		return r.Desc(index), nil
+	}
+	return r.Asc(index), nil
+}
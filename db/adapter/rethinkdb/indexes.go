@@ -0,0 +1,254 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package rethinkdb
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+	r "gopkg.in/rethinkdb/rethinkdb-go.v5"
+
+	"github.com/scraly/go.pkg/db"
+	"github.com/scraly/go.pkg/log"
+)
+
+// indexStatus is an index as returned by indexStatus
+type indexStatus struct {
+	Index string `rethinkdb:"index"`
+	Multi bool   `rethinkdb:"multi"`
+	Geo   bool   `rethinkdb:"geo"`
+	Query string `rethinkdb:"query"`
+}
+
+// fieldReference matches the field accesses of an index function, i.e.
+// var1("email") or r.row('email'), in the query returned by indexStatus.
+var fieldReference = regexp.MustCompile(`\(\s*(?:"((?:[^"\\]|\\.)*)"|'((?:[^'\\]|\\.)*)')\s*\)`)
+
+// Migrate ensures the given indexes when AutoMigrate is enabled, and drops
+// unmanaged ones when DropUnmanagedIndexes is also enabled.
+func (d *Default) Migrate(ctx context.Context, cfg *Configuration, specs ...db.IndexSpec) error {
+	if cfg == nil || !cfg.AutoMigrate {
+		return nil
+	}
+
+	if err := d.EnsureIndexes(ctx, specs...); err != nil {
+		return err
+	}
+
+	if cfg.DropUnmanagedIndexes {
+		return d.DropUnmanagedIndexes(ctx, specs...)
+	}
+
+	return nil
+}
+
+// EnsureIndexes creates missing secondary indexes and rebuilds the ones whose
+// definition (fields, multi or geo) differs from the given specifications.
+//
+// Unique, TTL and partial indexes are not supported by the server and are
+// rejected. Secondary indexes never contain documents without the indexed
+// fields, so they are always sparse.
+func (d *Default) EnsureIndexes(ctx context.Context, specs ...db.IndexSpec) error {
+	existing, err := d.listIndexes(ctx)
+	if err != nil {
+		return err
+	}
+
+	created := false
+	for _, spec := range specs {
+		if err := validateIndex(spec); err != nil {
+			return err
+		}
+
+		name := indexName(spec)
+		if current, ok := existing[name]; ok {
+			if sameIndex(current, spec) {
+				continue
+			}
+
+			log.For(ctx).Info("Dropping outdated index",
+				zap.String("table", d.table),
+				zap.String("index", name),
+			)
+			if _, err := d.runWrite(ctx, "EnsureIndexes", r.Table(d.table).IndexDrop(name)); err != nil {
+				return xerrors.Errorf("rethinkdb: unable to drop index %q: %w", name, err)
+			}
+		}
+
+		var term r.Term
+		switch {
+		case len(spec.Fields) == 1 && spec.Fields[0].Name == name:
+			term = r.Table(d.table).IndexCreate(name)
+		case len(spec.Fields) == 1:
+			field := spec.Fields[0].Name
+			term = r.Table(d.table).IndexCreateFunc(name, func(row r.Term) interface{} {
+				return row.Field(field)
+			})
+		default:
+			fields := spec.Fields
+			term = r.Table(d.table).IndexCreateFunc(name, func(row r.Term) interface{} {
+				values := make([]interface{}, 0, len(fields))
+				for _, field := range fields {
+					values = append(values, row.Field(field.Name))
+				}
+				return values
+			})
+		}
+
+		log.For(ctx).Info("Creating index",
+			zap.String("table", d.table),
+			zap.String("index", name),
+		)
+		if _, err := d.runWrite(ctx, "EnsureIndexes", term); err != nil {
+			return xerrors.Errorf("rethinkdb: unable to create index %q: %w", name, err)
+		}
+		created = true
+	}
+
+	// Wait for all indexes to be ready
+	if created {
+		if _, err := d.run(ctx, "EnsureIndexes", r.Table(d.table).IndexWait()); err != nil {
+			return xerrors.Errorf("rethinkdb: unable to wait for indexes: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// DropUnmanagedIndexes removes all secondary indexes that don't match one of
+// the given specifications.
+func (d *Default) DropUnmanagedIndexes(ctx context.Context, specs ...db.IndexSpec) error {
+	existing, err := d.listIndexes(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Remove managed ones
+	for _, spec := range specs {
+		delete(existing, indexName(spec))
+	}
+
+	for name := range existing {
+		if _, err := d.runWrite(ctx, "DropUnmanagedIndexes", r.Table(d.table).IndexDrop(name)); err != nil {
+			return xerrors.Errorf("rethinkdb: unable to drop index %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+func (d *Default) listIndexes(ctx context.Context) (map[string]indexStatus, error) {
+	cursor, err := d.run(ctx, "IndexStatus", r.Table(d.table).IndexStatus())
+	if err != nil {
+		return nil, xerrors.Errorf("rethinkdb: unable to list indexes: %w", err)
+	}
+
+	var statuses []indexStatus
+	if err := cursor.All(&statuses); err != nil {
+		return nil, xerrors.Errorf("rethinkdb: unable to retrieve query result: %w", err)
+	}
+
+	indexes := make(map[string]indexStatus, len(statuses))
+	for _, status := range statuses {
+		indexes[status.Index] = status
+	}
+
+	return indexes, nil
+}
+
+// sameIndex returns true if the existing index is built with the fields of the
+// specification, in the same order. Managed indexes are never multi nor geo.
+func sameIndex(current indexStatus, spec db.IndexSpec) bool {
+	if current.Multi || current.Geo {
+		return false
+	}
+
+	fields := indexFields(current.Query)
+	if len(fields) != len(spec.Fields) {
+		return false
+	}
+	for i, field := range spec.Fields {
+		if fields[i] != field.Name {
+			return false
+		}
+	}
+
+	return true
+}
+
+// indexFields extracts the accessed field names from the index function
+// returned by indexStatus, i.e. `indexCreate('name', function(var1) { return
+// [var1("a"), var1("b")]; })` returns a and b.
+func indexFields(query string) []string {
+	if i := strings.Index(query, "function"); i >= 0 {
+		query = query[i:]
+	}
+
+	var fields []string
+	for _, match := range fieldReference.FindAllStringSubmatch(query, -1) {
+		field := match[1]
+		if field == "" {
+			field = match[2]
+		}
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// indexName returns the explicit index name, or the field names joined with an
+// underscore so that single field indexes can be used by FindOneBy.
+func indexName(spec db.IndexSpec) string {
+	if spec.Name != "" {
+		return spec.Name
+	}
+
+	names := make([]string, 0, len(spec.Fields))
+	for _, field := range spec.Fields {
+		names = append(names, field.Name)
+	}
+
+	return strings.Join(names, "_")
+}
+
+func validateIndex(spec db.IndexSpec) error {
+	if err := spec.Validate(); err != nil {
+		return xerrors.Errorf("rethinkdb: %w", err)
+	}
+
+	switch {
+	case spec.Unique:
+		return xerrors.Errorf("rethinkdb: index %q: unique indexes are not supported", indexName(spec))
+	case spec.TTL > 0:
+		return xerrors.Errorf("rethinkdb: index %q: TTL indexes are not supported", indexName(spec))
+	case spec.PartialFilter != nil:
+		return xerrors.Errorf("rethinkdb: index %q: partial indexes are not supported", indexName(spec))
+	}
+
+	return nil
+}
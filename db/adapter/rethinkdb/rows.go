@@ -0,0 +1,104 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package rethinkdb
+
+import (
+	"context"
+
+	"github.com/scraly/go.pkg/db"
+
+	"golang.org/x/xerrors"
+	r "gopkg.in/rethinkdb/rethinkdb-go.v5"
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/encoding"
+)
+
+// Rows returns a cursor over the documents matching the filter, documents are
+// fetched by batches while the cursor is advanced.
+//
+// Documents are sorted using a secondary index (see ConvertSortIndex) so that
+// the result set is never sorted in memory, the query fails if the index
+// doesn't exist.
+func (d *Default) Rows(ctx context.Context, filter interface{}, sortParams *db.SortParameters) (db.Rows, error) {
+	term := r.Table(d.table)
+
+	// Sort, the index must be applied on the table itself
+	if sortParams != nil {
+		index, err := ConvertSortIndex(*sortParams)
+		if err != nil {
+			return nil, err
+		}
+		term = term.OrderBy(r.OrderByOpts{Index: index})
+	}
+
+	// Filter
+	if filter != nil {
+		term = term.Filter(filter)
+	}
+
+	// Run the query
+	res, err := d.run(ctx, "Rows", term)
+	if err != nil {
+		return nil, xerrors.Errorf("rethinkdb: unable to execute query: %w", TranslateError(err))
+	}
+
+	return &cursor{cursor: res}, nil
+}
+
+// Iterate calls fn for each document matching the filter, the next document
+// is only decoded once fn returns. Return db.ErrStopIteration from fn to stop
+// early.
+func (d *Default) Iterate(ctx context.Context, filter interface{}, sortParams *db.SortParameters, fn db.IteratorFunc) error {
+	rows, err := d.Rows(ctx, filter, sortParams)
+	if err != nil {
+		return err
+	}
+
+	return db.Iterate(ctx, rows, fn)
+}
+
+// -----------------------------------------------------------------------------
+
+type cursor struct {
+	cursor  *r.Cursor
+	current interface{}
+}
+
+func (c *cursor) Next(ctx context.Context) bool {
+	c.current = nil
+	return c.cursor.Next(&c.current)
+}
+
+func (c *cursor) Scan(dest interface{}) error {
+	if err := encoding.Decode(dest, c.current); err != nil {
+		return xerrors.Errorf("rethinkdb: unable to decode document: %w", err)
+	}
+	return nil
+}
+
+func (c *cursor) Err() error {
+	return c.cursor.Err()
+}
+
+func (c *cursor) Close() error {
+	return c.cursor.Close()
+}
@@ -0,0 +1,76 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package rethinkdb
+
+import (
+	"context"
+
+	"go.opencensus.io/trace"
+	r "gopkg.in/rethinkdb/rethinkdb-go.v5"
+)
+
+// run executes the query in a span named after the operation
+func (d *Default) run(ctx context.Context, operation string, term r.Term) (*r.Cursor, error) {
+	ctx, span := d.startSpan(ctx, operation, term)
+	defer span.End()
+
+	cursor, err := term.Run(d.session, r.RunOpts{
+		Context: ctx,
+	})
+	setSpanStatus(span, err)
+
+	return cursor, err
+}
+
+// runWrite executes the write query in a span named after the operation
+func (d *Default) runWrite(ctx context.Context, operation string, term r.Term) (r.WriteResponse, error) {
+	ctx, span := d.startSpan(ctx, operation, term)
+	defer span.End()
+
+	res, err := term.RunWrite(d.session, r.RunOpts{
+		Context: ctx,
+	})
+	setSpanStatus(span, err)
+
+	return res, err
+}
+
+func (d *Default) startSpan(ctx context.Context, operation string, term r.Term) (context.Context, *trace.Span) {
+	ctx, span := trace.StartSpan(ctx, "rethinkdb."+operation, trace.WithSpanKind(trace.SpanKindClient))
+	span.AddAttributes(
+		trace.StringAttribute("rethinkdb.db", d.db),
+		trace.StringAttribute("rethinkdb.table", d.table),
+		trace.StringAttribute("rethinkdb.query", term.String()),
+	)
+	return ctx, span
+}
+
+func setSpanStatus(span *trace.Span, err error) {
+	switch err {
+	case nil:
+	case r.ErrEmptyResult:
+		span.SetStatus(trace.Status{Code: trace.StatusCodeNotFound, Message: err.Error()})
+	default:
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+	}
+}
@@ -0,0 +1,129 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package sqlite
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/scraly/go.pkg/log"
+
+	"github.com/jmoiron/sqlx"
+	// Load sqlite driver
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/opencensus-integrations/ocsql"
+	"golang.org/x/xerrors"
+)
+
+var (
+	driverOnce sync.Once
+	driverName string
+	driverErr  error
+)
+
+// Configuration represents database connection configuration
+type Configuration struct {
+	AutoMigrate      bool
+	ConnectionString string
+}
+
+// Connection provides Wire provider for a SQLite database connection, an empty
+// connection string opens a private in-memory database.
+func Connection(ctx context.Context, cfg *Configuration) (*sqlx.DB, error) {
+	// Check arguments
+	if cfg == nil {
+		return nil, xerrors.New("sqlite: configuration must not be nil")
+	}
+
+	dsn := cfg.ConnectionString
+	if dsn == "" {
+		dsn = ":memory:"
+	}
+
+	// Instrument with opentracing
+	name, err := registerDriver()
+	if err != nil {
+		return nil, err
+	}
+
+	// Open database
+	conn, err := sqlx.Open(name, dsn)
+	if err != nil {
+		return nil, xerrors.Errorf("sqlite: unable to open driver: %w", err)
+	}
+
+	// Each connection of an in-memory database has its own database, keep
+	// only one to share it.
+	if isMemory(dsn) {
+		conn.SetMaxOpenConns(1)
+		conn.SetConnMaxLifetime(0)
+	}
+
+	// Check connection
+	if err := conn.PingContext(ctx); err != nil {
+		log.SafeClose(conn, "Unable to close database connection")
+		return nil, xerrors.Errorf("sqlite: unable to ping database: %w", err)
+	}
+
+	log.For(ctx).Info("SQLite connected !")
+
+	go func() {
+		<-ctx.Done()
+		log.SafeClose(conn, "Unable to close database connection")
+	}()
+
+	// Return connection
+	return conn, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// registerDriver wraps the sqlite driver with ocsql only once.
+func registerDriver() (string, error) {
+	driverOnce.Do(func() {
+		driverName, driverErr = ocsql.Register(
+			"sqlite3",
+			ocsql.WithOptions(ocsql.TraceOptions{
+				AllowRoot:    false,
+				Ping:         false,
+				RowsNext:     false,
+				RowsClose:    false,
+				RowsAffected: false,
+				LastInsertID: false,
+				Query:        true,
+				QueryParams:  true,
+			}),
+		)
+		if driverErr != nil {
+			driverErr = xerrors.Errorf("sqlite: failed to register ocsql driver: %w", driverErr)
+		}
+	})
+
+	return driverName, driverErr
+}
+
+// isMemory returns true when the given DSN targets an in-memory database
+func isMemory(dsn string) bool {
+	return dsn == ":memory:" || strings.HasPrefix(dsn, "file::memory:") || strings.Contains(dsn, "mode=memory")
+}
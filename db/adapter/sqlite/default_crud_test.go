@@ -0,0 +1,121 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package sqlite
+
+import (
+	"context"
+	"testing"
+
+	"github.com/scraly/go.pkg/db"
+
+	sq "github.com/Masterminds/squirrel"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type user struct {
+	ID    int64  `db:"id"`
+	Login string `db:"login"`
+	Age   int    `db:"age"`
+}
+
+func TestDefault(t *testing.T) {
+	Convey("Given an in-memory SQLite table", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		conn, err := Connection(ctx, &Configuration{})
+		So(err, ShouldBeNil)
+
+		_, err = conn.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, login TEXT NOT NULL, age INTEGER NOT NULL)`)
+		So(err, ShouldBeNil)
+
+		users := NewCRUDTable(conn, "", "users", []string{"id", "login", "age"}, []string{"login", "age"})
+
+		for i, login := range []string{"alice", "bob", "carol", "dave"} {
+			So(users.Create(ctx, &user{ID: int64(i + 1), Login: login, Age: 20 + i}), ShouldBeNil)
+		}
+
+		Convey("When counting with a filter", func() {
+			count, err := users.WhereCount(ctx, sq.Gt{"age": 21})
+
+			Convey("Then matching rows should be counted", func() {
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When fetching one row", func() {
+			var result user
+			err := users.WhereAndFetchOne(ctx, sq.Eq{"login": "bob"}, &result)
+
+			Convey("Then the row should be decoded", func() {
+				So(err, ShouldBeNil)
+				So(result.ID, ShouldEqual, 2)
+				So(result.Age, ShouldEqual, 21)
+			})
+		})
+
+		Convey("When fetching a missing row", func() {
+			var result user
+			err := users.WhereAndFetchOne(ctx, sq.Eq{"login": "eve"}, &result)
+
+			Convey("Then no result should be returned", func() {
+				So(err, ShouldEqual, db.ErrNoResult)
+			})
+		})
+
+		Convey("When updating and removing rows", func() {
+			So(users.Update(ctx, map[string]interface{}{"age": 42}, sq.Eq{"login": "alice"}), ShouldBeNil)
+			So(users.RemoveOne(ctx, sq.Eq{"login": "dave"}), ShouldBeNil)
+
+			Convey("Then changes should be visible", func() {
+				var result user
+				So(users.WhereAndFetchOne(ctx, sq.Eq{"login": "alice"}, &result), ShouldBeNil)
+				So(result.Age, ShouldEqual, 42)
+
+				count, err := users.WhereCount(ctx, nil)
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 3)
+
+				So(users.Update(ctx, map[string]interface{}{"age": 1}, sq.Eq{"login": "eve"}), ShouldEqual, db.ErrNoModification)
+				So(users.RemoveOne(ctx, sq.Eq{"login": "eve"}), ShouldEqual, db.ErrNoModification)
+			})
+		})
+
+		Convey("When searching with pagination and sort", func() {
+			var results []user
+			pagination := db.NewPaginator(2, 3)
+			sortParams := db.SortConverter([]string{"-age"})
+
+			total, err := users.Search(ctx, nil, pagination, &sortParams, &results)
+
+			Convey("Then the requested page should be returned", func() {
+				So(err, ShouldBeNil)
+				So(total, ShouldEqual, 4)
+				So(pagination.Total(), ShouldEqual, 4)
+				So(results, ShouldHaveLength, 1)
+				So(results[0].Login, ShouldEqual, "alice")
+			})
+		})
+	})
+}
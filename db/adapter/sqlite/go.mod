@@ -0,0 +1,14 @@
+module github.com/scraly/go.pkg/db/adapter/sqlite
+
+go 1.12
+
+require (
+	github.com/scraly/go.pkg/db v0.0.8
+	github.com/scraly/go.pkg/log v0.0.13
+	github.com/Masterminds/squirrel v1.1.0
+	github.com/jmoiron/sqlx v1.2.0
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/opencensus-integrations/ocsql v0.1.4
+	github.com/smartystreets/goconvey v1.6.4
+	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543
+)
@@ -0,0 +1,66 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package sqlite
+
+import (
+	"fmt"
+	"unicode"
+
+	"github.com/scraly/go.pkg/db"
+)
+
+// ToSnakeCase convert the given string to snake case following the Golang format:
+// acronyms are converted to lower-case and preceded by an underscore.
+func ToSnakeCase(in string) string {
+	runes := []rune(in)
+
+	var out []rune
+	for i := 0; i < len(runes); i++ {
+		if i > 0 && (unicode.IsUpper(runes[i]) || unicode.IsNumber(runes[i])) && ((i+1 < len(runes) && unicode.IsLower(runes[i+1])) || unicode.IsLower(runes[i-1])) {
+			out = append(out, '_')
+		}
+		out = append(out, unicode.ToLower(runes[i]))
+	}
+
+	return string(out)
+}
+
+// ConvertSortParameters to sql query string
+func ConvertSortParameters(params db.SortParameters, sortableColumns map[string]bool) []string {
+	sorts := make([]string, 0, len(params))
+
+	for _, param := range params {
+		realColumn := ToSnakeCase(param.FieldName)
+		if _, ok := sortableColumns[realColumn]; ok {
+			switch param.Direction {
+			case db.Ascending:
+				sorts = append(sorts, fmt.Sprintf("%s asc", realColumn))
+			case db.Descending:
+				sorts = append(sorts, fmt.Sprintf("%s desc", realColumn))
+			default:
+			}
+		}
+	}
+
+	return sorts
+}
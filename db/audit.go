@@ -0,0 +1,222 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"github.com/scraly/go.pkg/log"
+)
+
+// MaxAuditedRows is the maximum number of rows modified by an audited write,
+// the current state of each row is loaded before the write.
+const MaxAuditedRows = 1000
+
+// ErrTooManyAuditedRows is raised when an audited write matches more than
+// MaxAuditedRows rows.
+var ErrTooManyAuditedRows = xerrors.New("db: too many rows matched by an audited write")
+
+// AuditAction is the kind of write recorded by the audit trail
+type AuditAction string
+
+const (
+	// AuditCreate is recorded when an entity is created
+	AuditCreate AuditAction = "create"
+	// AuditUpdate is recorded when an entity is updated
+	AuditUpdate AuditAction = "update"
+	// AuditDelete is recorded when an entity is deleted
+	AuditDelete AuditAction = "delete"
+)
+
+// AuditChange is the old and new value of a modified field
+type AuditChange struct {
+	Old interface{} `json:"old,omitempty"`
+	New interface{} `json:"new,omitempty"`
+}
+
+// AuditRecord describes a write executed on a table
+type AuditRecord struct {
+	Table     string                 `json:"table"`
+	Action    AuditAction            `json:"action"`
+	Entity    interface{}            `json:"entity,omitempty"`
+	Actor     string                 `json:"actor,omitempty"`
+	TraceID   string                 `json:"trace_id,omitempty"`
+	Before    map[string]interface{} `json:"before,omitempty"`
+	After     map[string]interface{} `json:"after,omitempty"`
+	Changes   map[string]AuditChange `json:"changes,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// NewAuditRecord returns an audit record for the given write, the actor and
+// the trace identifier are extracted from the context.
+func NewAuditRecord(ctx context.Context, table string, action AuditAction, entity interface{}, before, after map[string]interface{}) *AuditRecord {
+	record := &AuditRecord{
+		Table:     table,
+		Action:    action,
+		Entity:    entity,
+		Before:    before,
+		After:     after,
+		Changes:   Diff(before, after),
+		Timestamp: time.Now().UTC(),
+	}
+
+	if actor, ok := ActorFromContext(ctx); ok {
+		record.Actor = actor
+	}
+	if span := trace.FromContext(ctx); span != nil {
+		record.TraceID = span.SpanContext().TraceID.String()
+	}
+
+	return record
+}
+
+// AuditTable returns the audited table name
+func (r *AuditRecord) AuditTable() string {
+	return r.Table
+}
+
+// AuditAction returns the audited action
+func (r *AuditRecord) AuditAction() string {
+	return string(r.Action)
+}
+
+// Diff returns the fields whose value differs between before and after. For
+// updates, fields missing from after are considered unchanged.
+func Diff(before, after map[string]interface{}) map[string]AuditChange {
+	changes := map[string]AuditChange{}
+
+	switch {
+	case before == nil:
+		for field, value := range after {
+			changes[field] = AuditChange{New: value}
+		}
+	case after == nil:
+		for field, value := range before {
+			changes[field] = AuditChange{Old: value}
+		}
+	default:
+		for field, value := range after {
+			if old, ok := before[field]; !ok || !reflect.DeepEqual(old, value) {
+				changes[field] = AuditChange{Old: before[field], New: value}
+			}
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	return changes
+}
+
+// -----------------------------------------------------------------------------
+
+type actorKey struct{}
+
+// WithActor returns a context holding the identity of the user executing the
+// writes.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor held by the context
+func ActorFromContext(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	return actor, ok && actor != ""
+}
+
+// -----------------------------------------------------------------------------
+
+// AuditSink stores audit records
+type AuditSink interface {
+	Record(ctx context.Context, record *AuditRecord) error
+}
+
+// AuditSinkFunc adapts a function to the AuditSink interface
+type AuditSinkFunc func(ctx context.Context, record *AuditRecord) error
+
+// Record calls f(ctx, record)
+func (f AuditSinkFunc) Record(ctx context.Context, record *AuditRecord) error {
+	return f(ctx, record)
+}
+
+// LogAuditSink writes audit records to the context logger
+func LogAuditSink() AuditSink {
+	return AuditSinkFunc(func(ctx context.Context, record *AuditRecord) error {
+		payload, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		log.For(ctx).Info("Audit record",
+			zap.String("table", record.Table),
+			zap.String("action", string(record.Action)),
+			zap.String("actor", record.Actor),
+			zap.ByteString("record", payload),
+		)
+		return nil
+	})
+}
+
+// requiredAuditSink is a sink whose failures fail the audited write
+type requiredAuditSink struct {
+	AuditSink
+}
+
+// RequireAudit returns a sink whose failures fail the audited writes instead of
+// being logged. Transactional adapters roll the write back, the others return
+// the error once the write is done.
+func RequireAudit(sink AuditSink) AuditSink {
+	return requiredAuditSink{AuditSink: sink}
+}
+
+// Audit sends the record to the sink. Failures are logged and ignored, unless
+// the sink is wrapped by RequireAudit.
+func Audit(ctx context.Context, sink AuditSink, record *AuditRecord) error {
+	if sink == nil {
+		return nil
+	}
+
+	err := sink.Record(ctx, record)
+	if err == nil {
+		return nil
+	}
+
+	if _, required := sink.(requiredAuditSink); required {
+		return xerrors.Errorf("db: unable to record audit trail: %w", err)
+	}
+
+	log.For(ctx).Error("Unable to record audit trail",
+		zap.String("table", record.Table),
+		zap.String("action", string(record.Action)),
+		zap.Error(err),
+	)
+	return nil
+}
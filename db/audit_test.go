@@ -0,0 +1,125 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.opencensus.io/trace"
+	"golang.org/x/xerrors"
+)
+
+func TestAuditRecord(t *testing.T) {
+	Convey("Given a context with an actor and a span", t, func() {
+		ctx := WithActor(context.Background(), "alice")
+		ctx, span := trace.StartSpan(ctx, "test", trace.WithSampler(trace.AlwaysSample()))
+		defer span.End()
+
+		Convey("When building an update record", func() {
+			record := NewAuditRecord(ctx, "users", AuditUpdate, 1,
+				map[string]interface{}{"name": "bob", "age": 20},
+				map[string]interface{}{"name": "bob", "age": 21},
+			)
+
+			Convey("Then the record should be complete", func() {
+				So(record.Table, ShouldEqual, "users")
+				So(record.Action, ShouldEqual, AuditUpdate)
+				So(record.Actor, ShouldEqual, "alice")
+				So(record.TraceID, ShouldEqual, span.SpanContext().TraceID.String())
+				So(record.Changes, ShouldResemble, map[string]AuditChange{
+					"age": {Old: 20, New: 21},
+				})
+			})
+		})
+
+		Convey("When building a create record", func() {
+			record := NewAuditRecord(ctx, "users", AuditCreate, nil, nil, map[string]interface{}{"name": "bob"})
+
+			Convey("Then all fields should be new", func() {
+				So(record.Changes, ShouldResemble, map[string]AuditChange{
+					"name": {New: "bob"},
+				})
+			})
+		})
+
+		Convey("When building a delete record", func() {
+			record := NewAuditRecord(ctx, "users", AuditDelete, 1, map[string]interface{}{"name": "bob"}, nil)
+
+			Convey("Then all fields should be removed", func() {
+				So(record.Changes, ShouldResemble, map[string]AuditChange{
+					"name": {Old: "bob"},
+				})
+			})
+		})
+	})
+
+	Convey("Given a context without actor", t, func() {
+		ctx := context.Background()
+
+		Convey("When building a record without changes", func() {
+			record := NewAuditRecord(ctx, "users", AuditUpdate, 1, map[string]interface{}{"name": "bob"}, map[string]interface{}{"name": "bob"})
+
+			Convey("Then the actor, trace and changes should be empty", func() {
+				So(record.Actor, ShouldBeEmpty)
+				So(record.TraceID, ShouldBeEmpty)
+				So(record.Changes, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestAudit(t *testing.T) {
+	Convey("Given a failing audit sink", t, func() {
+		ctx := context.Background()
+		record := NewAuditRecord(ctx, "users", AuditCreate, 1, nil, map[string]interface{}{"name": "bob"})
+
+		failure := xerrors.New("unavailable")
+		sink := AuditSinkFunc(func(context.Context, *AuditRecord) error {
+			return failure
+		})
+
+		Convey("When the audit is optional", func() {
+			err := Audit(ctx, sink, record)
+
+			Convey("Then the failure should be ignored", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When the audit is required", func() {
+			err := Audit(ctx, RequireAudit(sink), record)
+
+			Convey("Then the failure should be returned", func() {
+				So(xerrors.Is(err, failure), ShouldBeTrue)
+			})
+		})
+
+		Convey("When no sink is given", func() {
+			Convey("Then nothing should be recorded", func() {
+				So(Audit(ctx, nil, record), ShouldBeNil)
+			})
+		})
+	})
+}
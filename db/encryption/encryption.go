@@ -0,0 +1,579 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package encryption provides field level encryption of entities using AES-GCM
+// data keys wrapped by master keys (envelope encryption).
+//
+// Fields are marked with the encrypt struct tag, only string and []byte fields
+// are supported:
+//
+//	type User struct {
+//		ID    string `db:"id" encrypt:"key"`
+//		Email string `db:"email" encrypt:"deterministic"`
+//		Phone string `db:"phone" encrypt:"true"`
+//	}
+//
+// The field name is bound to the ciphertext as additional data, so that a
+// ciphertext can't be moved to another field. Randomized fields are also bound
+// to the row key, the field tagged with encrypt:"key", when it is set.
+//
+// Deterministic fields always produce the same ciphertext for the same value,
+// field and data key, so they can be queried by equality using Candidates.
+package encryption
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+var (
+	// ErrInvalidCiphertext is raised when a ciphertext can't be decoded
+	ErrInvalidCiphertext = xerrors.New("encryption: invalid ciphertext")
+	// ErrUnknownKey is raised when a key identifier is not known
+	ErrUnknownKey = xerrors.New("unknown key")
+	// ErrNoActiveKey is raised when encrypting without active data key
+	ErrNoActiveKey = xerrors.New("encryption: no active data key")
+)
+
+// Mode defines how a value is encrypted
+type Mode int
+
+const (
+	// Randomized encryption uses a random nonce, the same value never produces
+	// the same ciphertext.
+	Randomized Mode = iota
+	// Deterministic encryption derives the nonce from the value, the same value
+	// encrypted with the same data key always produces the same ciphertext.
+	Deterministic
+	// RowKey marks the field holding the row key, it is never encrypted but
+	// bound to the randomized fields of the row.
+	RowKey
+)
+
+const (
+	// TagName is the struct tag marking encrypted fields
+	TagName = "encrypt"
+
+	prefix    = "enc:v1:"
+	separator = ":"
+
+	// Ciphertext labels
+	labelRandomized    = "r"
+	labelRowKey        = "k"
+	labelDeterministic = "d"
+)
+
+// Encryptor encrypts and decrypts values using the data keys of a keyring
+type Encryptor struct {
+	keyring *Keyring
+	nameTag string
+}
+
+// New returns an encryptor using the given keyring, fields are named after
+// their db struct tag.
+func New(keyring *Keyring) *Encryptor {
+	return &Encryptor{
+		keyring: keyring,
+		nameTag: "db",
+	}
+}
+
+// WithNameTag returns an encryptor sharing the same keyring and naming fields
+// after the given struct tag (i.e. "bson"), the name is bound to ciphertexts.
+func (e *Encryptor) WithNameTag(nameTag string) *Encryptor {
+	return &Encryptor{
+		keyring: e.keyring,
+		nameTag: nameTag,
+	}
+}
+
+// IsEncrypted returns true if the value looks like a ciphertext produced by an
+// Encryptor.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// AdditionalData returns the additional data binding a ciphertext to a field
+// and, when rowKey is not a zero value, to a row.
+func AdditionalData(field string, rowKey interface{}) []byte {
+	if isZero(rowKey) {
+		return []byte(field)
+	}
+	return []byte(fmt.Sprintf("%s\x00%v", field, rowKey))
+}
+
+// Encrypt the plaintext with the active data key, the same additional data
+// must be given to decrypt it. The ciphertext is formatted as
+// "enc:v1:<mode>:<key id>:<base64 nonce and sealed value>".
+func (e *Encryptor) Encrypt(ctx context.Context, plaintext []byte, mode Mode, additionalData []byte) (string, error) {
+	label := labelRandomized
+	if mode == Deterministic {
+		label = labelDeterministic
+	}
+
+	return e.encryptActive(ctx, plaintext, label, additionalData)
+}
+
+// Decrypt a ciphertext produced by Encrypt
+func (e *Encryptor) Decrypt(ctx context.Context, ciphertext string, additionalData []byte) ([]byte, error) {
+	_, keyID, sealed, err := parse(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, _, err := e.keys(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, xerrors.Errorf("encryption: unable to decrypt value: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// Reencrypt decrypts the ciphertext and encrypts it again with the active
+// data key using the same mode, it is used to migrate values after a key
+// rotation.
+func (e *Encryptor) Reencrypt(ctx context.Context, ciphertext string, additionalData []byte) (string, error) {
+	label, _, _, err := parse(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := e.Decrypt(ctx, ciphertext, additionalData)
+	if err != nil {
+		return "", err
+	}
+
+	return e.encryptActive(ctx, plaintext, label, additionalData)
+}
+
+// Candidates returns the deterministic ciphertexts of the field value for
+// every data key of the keyring, to be used in an IN predicate so that values
+// encrypted before a key rotation still match.
+func (e *Encryptor) Candidates(ctx context.Context, field, plaintext string) ([]string, error) {
+	keys := e.keyring.Keys()
+
+	candidates := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ciphertext, err := e.encrypt(ctx, key.ID, []byte(plaintext), labelDeterministic, AdditionalData(field, nil))
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, ciphertext)
+	}
+
+	return candidates, nil
+}
+
+func (e *Encryptor) encryptActive(ctx context.Context, plaintext []byte, label string, additionalData []byte) (string, error) {
+	keyID := e.keyring.ActiveKeyID()
+	if keyID == "" {
+		return "", ErrNoActiveKey
+	}
+
+	return e.encrypt(ctx, keyID, plaintext, label, additionalData)
+}
+
+func (e *Encryptor) encrypt(ctx context.Context, keyID string, plaintext []byte, label string, additionalData []byte) (string, error) {
+	aead, nonceKey, err := e.keys(ctx, keyID)
+	if err != nil {
+		return "", err
+	}
+
+	var nonce []byte
+	switch label {
+	case labelDeterministic:
+		nonce = syntheticNonce(nonceKey, additionalData, plaintext, aead)
+	default:
+		nonce = make([]byte, aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return "", xerrors.Errorf("encryption: unable to generate nonce: %w", err)
+		}
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, additionalData)
+
+	return prefix + label + separator + keyID + separator + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// keys returns the cipher and the deterministic nonce key derived from the data
+// key, the data key itself is never used directly.
+func (e *Encryptor) keys(ctx context.Context, keyID string) (cipher.AEAD, []byte, error) {
+	key, err := e.keyring.key(ctx, keyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := newAEAD(deriveKey(key, "enc:v1 value encryption"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return aead, deriveKey(key, "enc:v1 deterministic nonce"), nil
+}
+
+// deriveKey derives a purpose specific key from the data key
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// syntheticNonce derives the nonce from the additional data and the plaintext.
+func syntheticNonce(nonceKey, additionalData, plaintext []byte, aead cipher.AEAD) []byte {
+	length := make([]byte, 8)
+	binary.BigEndian.PutUint64(length, uint64(len(additionalData)))
+
+	mac := hmac.New(sha256.New, nonceKey)
+	_, _ = mac.Write(length)
+	_, _ = mac.Write(additionalData)
+	_, _ = mac.Write(plaintext)
+
+	return mac.Sum(nil)[:aead.NonceSize()]
+}
+
+// parse splits a ciphertext into its label, key identifier and sealed value
+func parse(ciphertext string) (label, keyID string, sealed []byte, err error) {
+	if !IsEncrypted(ciphertext) {
+		return "", "", nil, ErrInvalidCiphertext
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(ciphertext, prefix), separator, 3)
+	if len(parts) != 3 {
+		return "", "", nil, ErrInvalidCiphertext
+	}
+
+	switch parts[0] {
+	case labelRandomized, labelRowKey, labelDeterministic:
+	default:
+		return "", "", nil, ErrInvalidCiphertext
+	}
+
+	sealed, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", "", nil, ErrInvalidCiphertext
+	}
+
+	return parts[0], parts[1], sealed, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// Fields returns the encryption mode of the encrypted fields of the given
+// model, and the RowKey field, indexed by the name given by the nameTag struct
+// tag (i.e. "db" or "bson").
+func Fields(model interface{}, nameTag string) map[string]Mode {
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+
+	fields := map[string]Mode{}
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		mode, ok := fieldMode(field)
+		if !ok {
+			continue
+		}
+
+		if name := fieldName(field, nameTag); name != "-" {
+			fields[name] = mode
+		}
+	}
+
+	return fields
+}
+
+// SealMap returns a copy of values where the given fields are encrypted, the
+// randomized fields are bound to the RowKey field value when it is part of the
+// values.
+func (e *Encryptor) SealMap(ctx context.Context, values map[string]interface{}, fields map[string]Mode) (map[string]interface{}, error) {
+	var rowKey interface{}
+	for name, mode := range fields {
+		if mode == RowKey {
+			rowKey = values[name]
+		}
+	}
+
+	sealed := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		mode, ok := fields[name]
+		if !ok || mode == RowKey {
+			sealed[name] = value
+			continue
+		}
+
+		var plaintext []byte
+		switch v := value.(type) {
+		case string:
+			plaintext = []byte(v)
+		case []byte:
+			plaintext = v
+		default:
+			return nil, xerrors.Errorf("encryption: unsupported type %T for field %q", value, name)
+		}
+
+		ciphertext, err := e.sealValue(ctx, name, rowKey, plaintext, mode)
+		if err != nil {
+			return nil, err
+		}
+		sealed[name] = ciphertext
+	}
+
+	return sealed, nil
+}
+
+// Seal returns a copy of the given struct, or pointer to struct, where the
+// encrypted fields hold their ciphertext. The given value is not modified.
+//
+// Values are always encrypted, even if they already look like a ciphertext, so
+// Seal must only be given plaintext entities.
+func (e *Encryptor) Seal(ctx context.Context, v interface{}) (interface{}, error) {
+	rv := reflect.ValueOf(v)
+
+	isPtr := rv.Kind() == reflect.Ptr
+	if isPtr {
+		if rv.IsNil() {
+			return v, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return v, nil
+	}
+
+	sealed := reflect.New(rv.Type())
+	sealed.Elem().Set(rv)
+
+	rowKey := e.rowKey(sealed.Elem())
+	if err := e.walk(sealed.Elem(), "", func(field reflect.Value, name string, mode Mode) error {
+		plaintext := fieldBytes(field)
+		if plaintext == nil {
+			return nil
+		}
+
+		ciphertext, err := e.sealValue(ctx, name, rowKey, plaintext, mode)
+		if err != nil {
+			return err
+		}
+		setFieldBytes(field, []byte(ciphertext))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if isPtr {
+		return sealed.Interface(), nil
+	}
+	return sealed.Elem().Interface(), nil
+}
+
+// Open decrypts in place the encrypted fields of the given pointer to a struct
+// or to a slice of structs. Plaintext values are left untouched.
+func (e *Encryptor) Open(ctx context.Context, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return xerrors.New("encryption: a pointer is expected")
+	}
+
+	return e.open(ctx, rv.Elem())
+}
+
+func (e *Encryptor) open(ctx context.Context, rv reflect.Value) error {
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return e.open(ctx, rv.Elem())
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := e.open(ctx, rv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		rowKey := e.rowKey(rv)
+		return e.walk(rv, "", func(field reflect.Value, name string, _ Mode) error {
+			ciphertext := string(fieldBytes(field))
+			if !IsEncrypted(ciphertext) {
+				return nil
+			}
+
+			additionalData := AdditionalData(name, nil)
+			if strings.HasPrefix(ciphertext, prefix+labelRowKey+separator) {
+				if isZero(rowKey) {
+					return xerrors.New("encryption: the row key is required to decrypt the value")
+				}
+				additionalData = AdditionalData(name, rowKey)
+			}
+
+			plaintext, err := e.Decrypt(ctx, ciphertext, additionalData)
+			if err != nil {
+				return err
+			}
+			setFieldBytes(field, plaintext)
+			return nil
+		})
+	default:
+		return nil
+	}
+}
+
+// sealValue encrypts the value of the named field, randomized values are bound
+// to the row key when it is set.
+func (e *Encryptor) sealValue(ctx context.Context, name string, rowKey interface{}, plaintext []byte, mode Mode) (string, error) {
+	switch {
+	case mode == Deterministic:
+		return e.encryptActive(ctx, plaintext, labelDeterministic, AdditionalData(name, nil))
+	case isZero(rowKey):
+		return e.encryptActive(ctx, plaintext, labelRandomized, AdditionalData(name, nil))
+	default:
+		return e.encryptActive(ctx, plaintext, labelRowKey, AdditionalData(name, rowKey))
+	}
+}
+
+// rowKey returns the value of the RowKey field of the struct
+func (e *Encryptor) rowKey(rv reflect.Value) interface{} {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if mode, ok := fieldMode(t.Field(i)); ok && mode == RowKey && rv.Field(i).CanInterface() {
+			return rv.Field(i).Interface()
+		}
+	}
+	return nil
+}
+
+// walk calls fn for each encrypted field of the struct with its name, nested
+// structs are walked recursively and their fields are prefixed by the name of
+// the parent field.
+func (e *Encryptor) walk(rv reflect.Value, parent string, fn func(field reflect.Value, name string, mode Mode) error) error {
+	t := rv.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := rv.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+
+		name := fieldName(t.Field(i), e.nameTag)
+		if parent != "" {
+			name = parent + "." + name
+		}
+
+		mode, ok := fieldMode(t.Field(i))
+		if !ok {
+			if field.Kind() == reflect.Struct {
+				if err := e.walk(field, name, fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if mode == RowKey {
+			continue
+		}
+
+		if field.Kind() != reflect.String && !(field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Uint8) {
+			return xerrors.Errorf("encryption: unsupported type %s for field %q", field.Type(), t.Field(i).Name)
+		}
+
+		if err := fn(field, name, mode); err != nil {
+			return xerrors.Errorf("encryption: field %q: %w", t.Field(i).Name, err)
+		}
+	}
+
+	return nil
+}
+
+func fieldMode(field reflect.StructField) (Mode, bool) {
+	switch field.Tag.Get(TagName) {
+	case "true", "randomized":
+		return Randomized, true
+	case "deterministic":
+		return Deterministic, true
+	case "key":
+		return RowKey, true
+	default:
+		return Randomized, false
+	}
+}
+
+// fieldName returns the name of the field given by the nameTag struct tag, or
+// the lower cased field name.
+func fieldName(field reflect.StructField, nameTag string) string {
+	name := strings.Split(field.Tag.Get(nameTag), ",")[0]
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name
+}
+
+func isZero(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	rv := reflect.ValueOf(value)
+	return !rv.IsValid() || reflect.DeepEqual(rv.Interface(), reflect.Zero(rv.Type()).Interface())
+}
+
+func fieldBytes(field reflect.Value) []byte {
+	if field.Kind() == reflect.String {
+		if field.Len() == 0 {
+			return nil
+		}
+		return []byte(field.String())
+	}
+	return field.Bytes()
+}
+
+func setFieldBytes(field reflect.Value, value []byte) {
+	if field.Kind() == reflect.String {
+		field.SetString(string(value))
+		return
+	}
+	field.SetBytes(value)
+}
@@ -0,0 +1,237 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type profile struct {
+	Bio string `db:"bio" encrypt:"true"`
+}
+
+type user struct {
+	ID      string `db:"id" encrypt:"key"`
+	Email   string `db:"email" encrypt:"deterministic"`
+	Phone   string `db:"phone" encrypt:"true"`
+	Secret  []byte `db:"secret" encrypt:"true"`
+	Profile profile
+}
+
+func TestEncryptor(t *testing.T) {
+	ctx := context.Background()
+
+	Convey("Given an encryptor using the KMS stub", t, func() {
+		stub, err := newKMSStub(map[string][]byte{
+			"master": bytes.Repeat([]byte{1}, 32),
+		})
+		So(err, ShouldBeNil)
+
+		keyring, err := NewKeyring(NewKMSKeyProvider(stub), nil, "")
+		So(err, ShouldBeNil)
+		_, err = keyring.Rotate(ctx, "master")
+		So(err, ShouldBeNil)
+
+		enc := New(keyring)
+		entity := &user{
+			ID:      "1",
+			Email:   "alice@example.com",
+			Phone:   "+33123456789",
+			Secret:  []byte("secret"),
+			Profile: profile{Bio: "bio"},
+		}
+
+		Convey("When sealing an entity", func() {
+			sealed, err := enc.Seal(ctx, entity)
+			So(err, ShouldBeNil)
+			sealedUser := sealed.(*user)
+
+			Convey("Then encrypted fields should hold ciphertexts", func() {
+				So(sealedUser.ID, ShouldEqual, "1")
+				So(IsEncrypted(sealedUser.Email), ShouldBeTrue)
+				So(IsEncrypted(sealedUser.Phone), ShouldBeTrue)
+				So(IsEncrypted(string(sealedUser.Secret)), ShouldBeTrue)
+				So(IsEncrypted(sealedUser.Profile.Bio), ShouldBeTrue)
+			})
+
+			Convey("Then the original entity should not be modified", func() {
+				So(entity.Email, ShouldEqual, "alice@example.com")
+				So(string(entity.Secret), ShouldEqual, "secret")
+			})
+
+			Convey("Then opening should restore the plaintexts", func() {
+				results := []user{*sealedUser}
+				So(enc.Open(ctx, &results), ShouldBeNil)
+				So(results[0], ShouldResemble, *entity)
+			})
+
+			Convey("Then deterministic fields should be queryable", func() {
+				again, err := enc.Seal(ctx, entity)
+				So(err, ShouldBeNil)
+				So(again.(*user).Email, ShouldEqual, sealedUser.Email)
+				So(again.(*user).Phone, ShouldNotEqual, sealedUser.Phone)
+
+				candidates, err := enc.Candidates(ctx, "email", "alice@example.com")
+				So(err, ShouldBeNil)
+				So(candidates, ShouldContain, sealedUser.Email)
+			})
+
+			Convey("Then ciphertexts should be bound to their field", func() {
+				moved := *sealedUser
+				moved.Phone = string(sealedUser.Secret)
+				So(enc.Open(ctx, &moved), ShouldNotBeNil)
+
+				candidates, err := enc.Candidates(ctx, "phone", "alice@example.com")
+				So(err, ShouldBeNil)
+				So(candidates, ShouldNotContain, sealedUser.Email)
+			})
+
+			Convey("Then randomized ciphertexts should be bound to their row", func() {
+				moved := *sealedUser
+				moved.ID = "2"
+				So(enc.Open(ctx, &moved), ShouldNotBeNil)
+
+				_, err := enc.Decrypt(ctx, sealedUser.Phone, AdditionalData("phone", nil))
+				So(err, ShouldNotBeNil)
+
+				plaintext, err := enc.Decrypt(ctx, sealedUser.Phone, AdditionalData("phone", "1"))
+				So(err, ShouldBeNil)
+				So(string(plaintext), ShouldEqual, "+33123456789")
+			})
+
+			Convey("When rotating the data key", func() {
+				previous := keyring.ActiveKeyID()
+				_, err := keyring.Rotate(ctx, "master")
+				So(err, ShouldBeNil)
+
+				Convey("Then previous values should still be decrypted", func() {
+					plaintext, err := enc.Decrypt(ctx, sealedUser.Phone, AdditionalData("phone", "1"))
+					So(err, ShouldBeNil)
+					So(string(plaintext), ShouldEqual, "+33123456789")
+				})
+
+				Convey("Then values should be reencrypted with the new key", func() {
+					ciphertext, err := enc.Reencrypt(ctx, sealedUser.Email, AdditionalData("email", nil))
+					So(err, ShouldBeNil)
+					So(ciphertext, ShouldNotContainSubstring, previous)
+					So(ciphertext, ShouldContainSubstring, keyring.ActiveKeyID())
+
+					candidates, err := enc.Candidates(ctx, "email", "alice@example.com")
+					So(err, ShouldBeNil)
+					So(candidates, ShouldHaveLength, 2)
+					So(candidates, ShouldContain, ciphertext)
+					So(candidates, ShouldContain, sealedUser.Email)
+				})
+			})
+
+			Convey("When the keyring is reloaded from persisted keys", func() {
+				reloaded, err := NewKeyring(NewKMSKeyProvider(stub), keyring.Keys(), keyring.ActiveKeyID())
+				So(err, ShouldBeNil)
+
+				Convey("Then values should be decrypted", func() {
+					plaintext, err := New(reloaded).Decrypt(ctx, sealedUser.Phone, AdditionalData("phone", "1"))
+					So(err, ShouldBeNil)
+					So(string(plaintext), ShouldEqual, "+33123456789")
+				})
+			})
+		})
+
+		Convey("When sealing values looking like ciphertexts", func() {
+			crafted := &user{
+				ID:    "1",
+				Email: "enc:v1:d:unknown:AAAA",
+				Phone: "enc:v1:r:unknown:AAAA",
+			}
+			sealed, err := enc.Seal(ctx, crafted)
+			So(err, ShouldBeNil)
+			sealedUser := sealed.(*user)
+
+			Convey("Then they should be encrypted", func() {
+				So(sealedUser.Email, ShouldNotEqual, crafted.Email)
+				So(sealedUser.Phone, ShouldNotEqual, crafted.Phone)
+			})
+
+			Convey("Then opening should restore them", func() {
+				So(enc.Open(ctx, sealedUser), ShouldBeNil)
+				So(sealedUser, ShouldResemble, crafted)
+			})
+		})
+
+		Convey("When sealing values of a map", func() {
+			fields := Fields(&user{}, "db")
+			sealed, err := enc.SealMap(ctx, map[string]interface{}{
+				"id":    "1",
+				"phone": "+33123456789",
+				"name":  "alice",
+			}, fields)
+			So(err, ShouldBeNil)
+
+			Convey("Then they should be opened from the entity", func() {
+				So(sealed["id"], ShouldEqual, "1")
+				So(sealed["name"], ShouldEqual, "alice")
+
+				entity := user{ID: "1", Phone: sealed["phone"].(string)}
+				So(enc.Open(ctx, &entity), ShouldBeNil)
+				So(entity.Phone, ShouldEqual, "+33123456789")
+			})
+		})
+
+		Convey("When listing encrypted fields", func() {
+			fields := Fields(&user{}, "db")
+
+			Convey("Then tagged fields should be returned by column name", func() {
+				So(fields, ShouldResemble, map[string]Mode{
+					"id":     RowKey,
+					"email":  Deterministic,
+					"phone":  Randomized,
+					"secret": Randomized,
+				})
+			})
+		})
+	})
+
+	Convey("Given a local key provider", t, func() {
+		provider, err := NewLocalKeyProvider(map[string][]byte{
+			"local": bytes.Repeat([]byte{2}, 32),
+		})
+		So(err, ShouldBeNil)
+
+		Convey("When wrapping a data key", func() {
+			wrapped, err := provider.WrapKey(ctx, "local", []byte("data key"))
+			So(err, ShouldBeNil)
+
+			Convey("Then it should only be unwrapped with the same master key", func() {
+				key, err := provider.UnwrapKey(ctx, "local", wrapped)
+				So(err, ShouldBeNil)
+				So(string(key), ShouldEqual, "data key")
+
+				_, err = provider.UnwrapKey(ctx, "unknown", wrapped)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
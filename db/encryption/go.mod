@@ -0,0 +1,9 @@
+module github.com/scraly/go.pkg/db/encryption
+
+go 1.12
+
+require (
+	github.com/aws/aws-sdk-go v1.29.28
+	github.com/smartystreets/goconvey v1.6.4
+	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543
+)
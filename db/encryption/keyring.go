@@ -0,0 +1,160 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// DataKey is a wrapped data encryption key, the list of data keys must be
+// persisted to decrypt the values encrypted with them.
+type DataKey struct {
+	ID          string    `json:"id"`
+	MasterKeyID string    `json:"master_key_id"`
+	Wrapped     []byte    `json:"wrapped"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Keyring holds the data keys, new values are encrypted with the active key
+// and values encrypted with previous keys can still be decrypted.
+type Keyring struct {
+	provider KeyProvider
+
+	mu     sync.RWMutex
+	keys   map[string]DataKey
+	active string
+	cache  map[string][]byte
+}
+
+// NewKeyring returns a keyring holding the given data keys, active is the
+// identifier of the key used to encrypt new values.
+func NewKeyring(provider KeyProvider, keys []DataKey, active string) (*Keyring, error) {
+	k := &Keyring{
+		provider: provider,
+		keys:     make(map[string]DataKey, len(keys)),
+		cache:    map[string][]byte{},
+	}
+
+	for _, key := range keys {
+		if key.ID == "" || strings.Contains(key.ID, separator) {
+			return nil, xerrors.Errorf("encryption: invalid data key identifier %q", key.ID)
+		}
+		k.keys[key.ID] = key
+	}
+
+	if active != "" {
+		if _, ok := k.keys[active]; !ok {
+			return nil, xerrors.Errorf("encryption: active data key %q: %w", active, ErrUnknownKey)
+		}
+		k.active = active
+	}
+
+	return k, nil
+}
+
+// Rotate generates a new data key wrapped with the given master key and makes
+// it active. The returned key must be persisted along with the previous ones.
+func (k *Keyring) Rotate(ctx context.Context, masterKeyID string) (DataKey, error) {
+	plaintext := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, plaintext); err != nil {
+		return DataKey{}, xerrors.Errorf("encryption: unable to generate data key: %w", err)
+	}
+
+	wrapped, err := k.provider.WrapKey(ctx, masterKeyID, plaintext)
+	if err != nil {
+		return DataKey{}, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return DataKey{}, xerrors.Errorf("encryption: unable to generate data key identifier: %w", err)
+	}
+
+	key := DataKey{
+		ID:          hex.EncodeToString(id),
+		MasterKeyID: masterKeyID,
+		Wrapped:     wrapped,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	k.mu.Lock()
+	k.keys[key.ID] = key
+	k.cache[key.ID] = plaintext
+	k.active = key.ID
+	k.mu.Unlock()
+
+	return key, nil
+}
+
+// ActiveKeyID returns the identifier of the key used to encrypt new values
+func (k *Keyring) ActiveKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// Keys returns all the data keys of the keyring
+func (k *Keyring) Keys() []DataKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := make([]DataKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// key returns the plaintext data key, unwrapped keys are cached
+func (k *Keyring) key(ctx context.Context, id string) ([]byte, error) {
+	k.mu.RLock()
+	plaintext, ok := k.cache[id]
+	key, known := k.keys[id]
+	k.mu.RUnlock()
+
+	if ok {
+		return plaintext, nil
+	}
+	if !known {
+		return nil, xerrors.Errorf("encryption: data key %q: %w", id, ErrUnknownKey)
+	}
+
+	plaintext, err := k.provider.UnwrapKey(ctx, key.MasterKeyID, key.Wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	k.cache[id] = plaintext
+	k.mu.Unlock()
+
+	return plaintext, nil
+}
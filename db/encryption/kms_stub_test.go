@@ -0,0 +1,93 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package encryption
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"golang.org/x/xerrors"
+)
+
+// kmsStub is a local implementation of the KMS Encrypt and Decrypt operations
+// backed by in-memory master keys, to be used in tests instead of AWS KMS.
+// Other operations are not implemented and panic.
+type kmsStub struct {
+	kmsiface.KMSAPI
+
+	provider *LocalKeyProvider
+}
+
+// newKMSStub returns a KMS stub using the given 32 bytes master keys indexed
+// by key id.
+func newKMSStub(keys map[string][]byte) (*kmsStub, error) {
+	provider, err := NewLocalKeyProvider(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsStub{
+		provider: provider,
+	}, nil
+}
+
+// EncryptWithContext encrypts the plaintext with the requested master key
+func (s *kmsStub) EncryptWithContext(ctx aws.Context, input *kms.EncryptInput, _ ...request.Option) (*kms.EncryptOutput, error) {
+	keyID := aws.StringValue(input.KeyId)
+
+	wrapped, err := s.provider.WrapKey(ctx, keyID, input.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like KMS, the key id is part of the ciphertext blob
+	blob := append([]byte{byte(len(keyID))}, keyID...)
+	return &kms.EncryptOutput{
+		CiphertextBlob: append(blob, wrapped...),
+		KeyId:          aws.String(keyID),
+	}, nil
+}
+
+// DecryptWithContext decrypts the ciphertext blob
+func (s *kmsStub) DecryptWithContext(ctx aws.Context, input *kms.DecryptInput, _ ...request.Option) (*kms.DecryptOutput, error) {
+	blob := input.CiphertextBlob
+	if len(blob) == 0 || len(blob) < int(blob[0])+1 {
+		return nil, ErrInvalidCiphertext
+	}
+	keyID := string(blob[1 : int(blob[0])+1])
+
+	if input.KeyId != nil && aws.StringValue(input.KeyId) != keyID {
+		return nil, xerrors.Errorf("encryption: ciphertext was not encrypted with key %q", aws.StringValue(input.KeyId))
+	}
+
+	plaintext, err := s.provider.UnwrapKey(ctx, keyID, blob[int(blob[0])+1:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &kms.DecryptOutput{
+		KeyId:     aws.String(keyID),
+		Plaintext: plaintext,
+	}, nil
+}
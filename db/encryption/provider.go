@@ -0,0 +1,195 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"golang.org/x/xerrors"
+)
+
+// KeyProvider wraps data keys with master keys
+type KeyProvider interface {
+	// WrapKey encrypts the data key with the given master key
+	WrapKey(ctx context.Context, masterKeyID string, key []byte) ([]byte, error)
+	// UnwrapKey decrypts a data key wrapped with the given master key
+	UnwrapKey(ctx context.Context, masterKeyID string, wrapped []byte) ([]byte, error)
+}
+
+// -----------------------------------------------------------------------------
+
+// LocalKeyProvider wraps data keys with AES-256 master keys held in memory
+type LocalKeyProvider struct {
+	keys map[string][]byte
+}
+
+// NewLocalKeyProvider returns a key provider using the given 32 bytes master
+// keys indexed by identifier.
+func NewLocalKeyProvider(keys map[string][]byte) (*LocalKeyProvider, error) {
+	for id, key := range keys {
+		if len(key) != 32 {
+			return nil, xerrors.Errorf("encryption: master key %q must be 32 bytes long", id)
+		}
+	}
+
+	return &LocalKeyProvider{
+		keys: keys,
+	}, nil
+}
+
+// LoadKeyfile returns a key provider using the master keys of the given JSON
+// file, keys are base64 encoded and indexed by identifier.
+//
+//	{"2020-01": "base64 encoded 32 bytes key"}
+func LoadKeyfile(path string) (*LocalKeyProvider, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("encryption: unable to read keyfile: %w", err)
+	}
+
+	var encoded map[string]string
+	if err := json.Unmarshal(content, &encoded); err != nil {
+		return nil, xerrors.Errorf("encryption: unable to decode keyfile: %w", err)
+	}
+
+	keys := make(map[string][]byte, len(encoded))
+	for id, value := range encoded {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, xerrors.Errorf("encryption: unable to decode master key %q: %w", id, err)
+		}
+		keys[id] = key
+	}
+
+	return NewLocalKeyProvider(keys)
+}
+
+// WrapKey encrypts the data key with the given master key
+func (p *LocalKeyProvider) WrapKey(ctx context.Context, masterKeyID string, key []byte) ([]byte, error) {
+	aead, err := p.aead(masterKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, xerrors.Errorf("encryption: unable to generate nonce: %w", err)
+	}
+
+	return aead.Seal(nonce, nonce, key, []byte(masterKeyID)), nil
+}
+
+// UnwrapKey decrypts a data key wrapped with the given master key
+func (p *LocalKeyProvider) UnwrapKey(ctx context.Context, masterKeyID string, wrapped []byte) ([]byte, error) {
+	aead, err := p.aead(masterKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+
+	key, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(masterKeyID))
+	if err != nil {
+		return nil, xerrors.Errorf("encryption: unable to unwrap data key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (p *LocalKeyProvider) aead(masterKeyID string) (cipher.AEAD, error) {
+	key, ok := p.keys[masterKeyID]
+	if !ok {
+		return nil, xerrors.Errorf("encryption: master key %q: %w", masterKeyID, ErrUnknownKey)
+	}
+
+	return newAEAD(key)
+}
+
+// -----------------------------------------------------------------------------
+
+// KMSKeyProvider wraps data keys with AWS KMS customer master keys
+type KMSKeyProvider struct {
+	client kmsiface.KMSAPI
+}
+
+// NewKMSKeyProvider returns a key provider using the given KMS client, master
+// key identifiers are KMS key ids, ARNs or aliases.
+func NewKMSKeyProvider(client kmsiface.KMSAPI) *KMSKeyProvider {
+	return &KMSKeyProvider{
+		client: client,
+	}
+}
+
+// WrapKey encrypts the data key with the given master key
+func (p *KMSKeyProvider) WrapKey(ctx context.Context, masterKeyID string, key []byte) ([]byte, error) {
+	out, err := p.client.EncryptWithContext(ctx, &kms.EncryptInput{
+		KeyId:     aws.String(masterKeyID),
+		Plaintext: key,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("encryption: unable to wrap data key: %w", err)
+	}
+
+	return out.CiphertextBlob, nil
+}
+
+// UnwrapKey decrypts a data key wrapped with the given master key
+func (p *KMSKeyProvider) UnwrapKey(ctx context.Context, masterKeyID string, wrapped []byte) ([]byte, error) {
+	out, err := p.client.DecryptWithContext(ctx, &kms.DecryptInput{
+		KeyId:          aws.String(masterKeyID),
+		CiphertextBlob: wrapped,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("encryption: unable to unwrap data key: %w", err)
+	}
+
+	return out.Plaintext, nil
+}
+
+// -----------------------------------------------------------------------------
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, xerrors.Errorf("encryption: unable to initialize cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, xerrors.Errorf("encryption: unable to initialize cipher: %w", err)
+	}
+
+	return aead, nil
+}
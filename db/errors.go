@@ -22,7 +22,12 @@
 
 package db
 
-import "golang.org/x/xerrors"
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/xerrors"
+)
 
 var (
 	// ErrNoResult is raised when data query returns no result
@@ -32,3 +37,113 @@ var (
 	// ErrNoModification is raised when updating an entity without any changes
 	ErrNoModification = xerrors.New("No changes made")
 )
+
+var (
+	// ErrDuplicateKey is raised when a write violates a unique constraint
+	ErrDuplicateKey = xerrors.New("duplicate key")
+	// ErrForeignKey is raised when a write violates a foreign key constraint
+	ErrForeignKey = xerrors.New("foreign key violation")
+	// ErrCheckViolation is raised when a write violates a check constraint or a
+	// validation rule
+	ErrCheckViolation = xerrors.New("check constraint violation")
+	// ErrSerialization is raised when a transaction can't be serialized and
+	// should be retried
+	ErrSerialization = xerrors.New("serialization failure")
+	// ErrTimeout is raised when a query exceeds its deadline
+	ErrTimeout = xerrors.New("query timeout")
+	// ErrConnection is raised when the database can't be reached
+	ErrConnection = xerrors.New("connection failure")
+)
+
+// Error is a classified database error, it matches its kind with xerrors.Is
+// and keeps the driver error as cause.
+type Error struct {
+	// Kind is one of the db error sentinels
+	Kind error
+	// Constraint is the name of the offending constraint or index
+	Constraint string
+	// Field is the name of the offending column or field
+	Field string
+	// Err is the driver error
+	Err error
+}
+
+// NewError returns a classified error for the given driver error
+func NewError(kind error, constraint, field string, err error) *Error {
+	return &Error{
+		Kind:       kind,
+		Constraint: constraint,
+		Field:      field,
+		Err:        err,
+	}
+}
+
+// Error returns the error message
+func (e *Error) Error() string {
+	msg := e.Kind.Error()
+	if e.Constraint != "" {
+		msg += " (constraint: " + e.Constraint + ")"
+	}
+	if e.Field != "" {
+		msg += " (field: " + e.Field + ")"
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the driver error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error is of the target kind
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+// StatusCode returns the HTTP status code matching the error kind
+func (e *Error) StatusCode() int {
+	return HTTPStatus(e.Kind)
+}
+
+// Constraint returns the offending constraint of a classified error
+func Constraint(err error) string {
+	var dbErr *Error
+	if xerrors.As(err, &dbErr) {
+		return dbErr.Constraint
+	}
+	return ""
+}
+
+// Field returns the offending field of a classified error
+func Field(err error) string {
+	var dbErr *Error
+	if xerrors.As(err, &dbErr) {
+		return dbErr.Field
+	}
+	return ""
+}
+
+// HTTPStatus returns the HTTP status code to respond for the given error
+func HTTPStatus(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case xerrors.Is(err, ErrInvalidPagination):
+		return http.StatusBadRequest
+	case xerrors.Is(err, ErrNoResult), xerrors.Is(err, ErrNoModification):
+		return http.StatusNotFound
+	case xerrors.Is(err, ErrDuplicateKey), xerrors.Is(err, ErrSerialization):
+		return http.StatusConflict
+	case xerrors.Is(err, ErrForeignKey), xerrors.Is(err, ErrCheckViolation):
+		return http.StatusUnprocessableEntity
+	case xerrors.Is(err, ErrTimeout), xerrors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case xerrors.Is(err, ErrConnection):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,66 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/xerrors"
+)
+
+func TestError(t *testing.T) {
+	Convey("Given a wrapped duplicate key error", t, func() {
+		cause := xerrors.New("pq: duplicate key value violates unique constraint")
+		err := xerrors.Errorf("postgresql: unable to execute query: %w", NewError(ErrDuplicateKey, "users_email_key", "email", cause))
+
+		Convey("When inspecting the error", func() {
+
+			Convey("Then the kind, cause and details should be exposed", func() {
+				So(xerrors.Is(err, ErrDuplicateKey), ShouldBeTrue)
+				So(xerrors.Is(err, ErrForeignKey), ShouldBeFalse)
+				So(xerrors.Is(err, cause), ShouldBeTrue)
+				So(Constraint(err), ShouldEqual, "users_email_key")
+				So(Field(err), ShouldEqual, "email")
+				So(HTTPStatus(err), ShouldEqual, http.StatusConflict)
+			})
+		})
+	})
+
+	Convey("Given unclassified errors", t, func() {
+		Convey("When mapping them to HTTP status", func() {
+
+			Convey("Then sentinels should be mapped", func() {
+				So(HTTPStatus(nil), ShouldEqual, http.StatusOK)
+				So(HTTPStatus(ErrNoResult), ShouldEqual, http.StatusNotFound)
+				So(HTTPStatus(ErrCheckViolation), ShouldEqual, http.StatusUnprocessableEntity)
+				So(HTTPStatus(xerrors.Errorf("wrap: %w", context.DeadlineExceeded)), ShouldEqual, http.StatusGatewayTimeout)
+				So(HTTPStatus(NewError(ErrConnection, "", "", nil)), ShouldEqual, http.StatusServiceUnavailable)
+				So(HTTPStatus(xerrors.New("boom")), ShouldEqual, http.StatusInternalServerError)
+				So(Constraint(xerrors.New("boom")), ShouldBeEmpty)
+			})
+		})
+	})
+}
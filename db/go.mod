@@ -3,6 +3,9 @@ module github.com/scraly/go.pkg/db
 go 1.12
 
 require (
+	github.com/scraly/go.pkg/log v0.0.13
 	github.com/smartystreets/goconvey v1.6.4
+	go.opencensus.io v0.22.2
+	go.uber.org/zap v1.10.0
 	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543
 )
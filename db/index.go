@@ -0,0 +1,113 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// IndexField describes a field that is part of an index key
+type IndexField struct {
+	Name      string
+	Direction SortDirection
+}
+
+// IndexSpec is a backend neutral index definition
+type IndexSpec struct {
+	// Name of the index, generated from fields when empty
+	Name string
+	// Fields composing the index key, in order
+	Fields []IndexField
+	// Unique rejects documents with a duplicate key
+	Unique bool
+	// Sparse skips documents that don't contain the indexed fields
+	Sparse bool
+	// TTL expires documents after the given duration (single date field only)
+	TTL time.Duration
+	// PartialFilter only indexes documents matching the given filter
+	PartialFilter interface{}
+}
+
+// NewIndex returns an index specification for the given fields.
+//
+// Fields use the same syntax as SortConverter: a '-' prefix makes the field
+// descending, '+' or no prefix makes it ascending.
+func NewIndex(fields ...string) IndexSpec {
+	params := SortConverter(fields)
+
+	spec := IndexSpec{
+		Fields: make([]IndexField, 0, len(params)),
+	}
+	for _, param := range params {
+		spec.Fields = append(spec.Fields, IndexField{
+			Name:      param.FieldName,
+			Direction: param.Direction,
+		})
+	}
+
+	return spec
+}
+
+// IndexName returns the index name, or generates one from the index fields
+func (s IndexSpec) IndexName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+
+	parts := make([]string, 0, len(s.Fields))
+	for _, field := range s.Fields {
+		direction := Ascending
+		if field.Direction == Descending {
+			direction = Descending
+		}
+		parts = append(parts, fmt.Sprintf("%s_%s", field.Name, direction))
+	}
+
+	return strings.Join(parts, "_")
+}
+
+// Validate the index specification
+func (s IndexSpec) Validate() error {
+	if len(s.Fields) == 0 {
+		return xerrors.Errorf("db: index %q must have at least one field", s.Name)
+	}
+
+	for _, field := range s.Fields {
+		if strings.TrimSpace(field.Name) == "" {
+			return xerrors.Errorf("db: index %q has an empty field name", s.Name)
+		}
+	}
+
+	if s.TTL < 0 {
+		return xerrors.Errorf("db: index %q has a negative TTL", s.IndexName())
+	}
+	if s.TTL > 0 && len(s.Fields) > 1 {
+		return xerrors.Errorf("db: index %q must have exactly one field to use a TTL", s.IndexName())
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package db
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewIndex(t *testing.T) {
+	Convey("Given an index built from field names", t, func() {
+		spec := NewIndex("email", "-createdAt", "+name")
+
+		Convey("Then fields should be parsed with their direction", func() {
+			So(spec.Fields, ShouldResemble, []IndexField{
+				{Name: "email", Direction: Ascending},
+				{Name: "createdAt", Direction: Descending},
+				{Name: "name", Direction: Ascending},
+			})
+		})
+
+		Convey("Then a name should be generated", func() {
+			So(spec.IndexName(), ShouldEqual, "email_asc_createdAt_desc_name_asc")
+		})
+
+		Convey("When a name is given", func() {
+			spec.Name = "by_email"
+
+			Convey("Then it should be used", func() {
+				So(spec.IndexName(), ShouldEqual, "by_email")
+			})
+		})
+	})
+}
+
+func TestIndexValidation(t *testing.T) {
+	Convey("Given index specifications", t, func() {
+
+		Convey("When the index has no field", func() {
+			err := IndexSpec{Name: "empty"}.Validate()
+
+			Convey("Then it should be rejected", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the index has an empty field", func() {
+			err := IndexSpec{Fields: []IndexField{{Name: " "}}}.Validate()
+
+			Convey("Then it should be rejected", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a TTL index has several fields", func() {
+			spec := NewIndex("createdAt", "updatedAt")
+			spec.TTL = time.Hour
+
+			Convey("Then it should be rejected", func() {
+				So(spec.Validate(), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a TTL index has a single field", func() {
+			spec := NewIndex("createdAt")
+			spec.TTL = time.Hour
+
+			Convey("Then it should be valid", func() {
+				So(spec.Validate(), ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,87 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package db
+
+import (
+	"context"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrStopIteration is returned by an IteratorFunc to stop the iteration
+// without error.
+var ErrStopIteration = xerrors.New("stop iteration")
+
+// Row is the current element of a result set
+type Row interface {
+	// Scan decodes the current element into dest
+	Scan(dest interface{}) error
+}
+
+// Rows is a cursor over a result set, elements are fetched from the database
+// while the cursor is advanced.
+type Rows interface {
+	Row
+
+	// Next advances the cursor, it returns false when the result set is
+	// exhausted or on error.
+	Next(ctx context.Context) bool
+	// Err returns the error encountered while advancing the cursor
+	Err() error
+	// Close releases the cursor
+	Close() error
+}
+
+// IteratorFunc is called for each element of a result set
+type IteratorFunc func(row Row) error
+
+// Iterate calls fn for each element of the given cursor. The next element is
+// only fetched once fn returns, the iteration stops on the first error
+// returned by fn, ErrStopIteration stops it without error. The cursor is
+// always closed.
+func Iterate(ctx context.Context, rows Rows, fn IteratorFunc) (err error) {
+	defer func() {
+		if cerr := rows.Close(); cerr != nil && err == nil {
+			err = xerrors.Errorf("db: unable to close cursor: %w", cerr)
+		}
+	}()
+
+	for rows.Next(ctx) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(rows); err != nil {
+			if xerrors.Is(err, ErrStopIteration) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return xerrors.Errorf("db: unable to iterate over cursor: %w", err)
+	}
+
+	return ctx.Err()
+}
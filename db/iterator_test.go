@@ -0,0 +1,118 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/xerrors"
+)
+
+type sliceRows struct {
+	values  []int
+	current int
+	fetched int
+	closed  bool
+}
+
+func (r *sliceRows) Next(ctx context.Context) bool {
+	if r.fetched >= len(r.values) {
+		return false
+	}
+	r.current = r.values[r.fetched]
+	r.fetched++
+	return true
+}
+
+func (r *sliceRows) Scan(dest interface{}) error {
+	*dest.(*int) = r.current
+	return nil
+}
+
+func (r *sliceRows) Err() error   { return nil }
+func (r *sliceRows) Close() error { r.closed = true; return nil }
+
+func TestIterate(t *testing.T) {
+	Convey("Given a cursor of 5 elements", t, func() {
+		rows := &sliceRows{values: []int{1, 2, 3, 4, 5}}
+
+		Convey("When iterating over all elements", func() {
+			sum := 0
+			err := Iterate(context.Background(), rows, func(row Row) error {
+				var value int
+				if err := row.Scan(&value); err != nil {
+					return err
+				}
+				sum += value
+				return nil
+			})
+
+			Convey("Then all elements should be visited", func() {
+				So(err, ShouldBeNil)
+				So(sum, ShouldEqual, 15)
+				So(rows.closed, ShouldBeTrue)
+			})
+		})
+
+		Convey("When stopping the iteration", func() {
+			err := Iterate(context.Background(), rows, func(row Row) error {
+				return ErrStopIteration
+			})
+
+			Convey("Then no more element should be fetched", func() {
+				So(err, ShouldBeNil)
+				So(rows.fetched, ShouldEqual, 1)
+				So(rows.closed, ShouldBeTrue)
+			})
+		})
+
+		Convey("When the callback fails", func() {
+			errFailed := xerrors.New("failed")
+			err := Iterate(context.Background(), rows, func(row Row) error {
+				return errFailed
+			})
+
+			Convey("Then the error should be returned", func() {
+				So(xerrors.Is(err, errFailed), ShouldBeTrue)
+				So(rows.fetched, ShouldEqual, 1)
+				So(rows.closed, ShouldBeTrue)
+			})
+		})
+
+		Convey("When the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			err := Iterate(ctx, rows, func(row Row) error {
+				cancel()
+				return nil
+			})
+
+			Convey("Then the iteration should stop", func() {
+				So(err, ShouldEqual, context.Canceled)
+				So(rows.fetched, ShouldEqual, 2)
+				So(rows.closed, ShouldBeTrue)
+			})
+		})
+	})
+}
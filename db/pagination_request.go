@@ -0,0 +1,165 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+var (
+	// ErrInvalidPagination is raised when pagination query parameters are invalid
+	ErrInvalidPagination = xerrors.New("invalid pagination parameters")
+)
+
+// PaginationRequest holds pagination and sort parameters requested by a client
+type PaginationRequest struct {
+	Page    uint
+	PerPage uint
+	Sorts   SortParameters
+}
+
+// ParsePaginationRequest parses the page, per_page and sort query parameters.
+// Missing values use defaults and page sizes are capped to maxPerPage, a zero
+// maxPerPage uses DefaultMaxPerPage. Sorts are comma separated field names,
+// prefixed by '-' for descending order.
+func ParsePaginationRequest(query url.Values, maxPerPage uint) (*PaginationRequest, error) {
+	if maxPerPage == 0 {
+		maxPerPage = DefaultMaxPerPage
+	}
+
+	req := &PaginationRequest{
+		Page:    1,
+		PerPage: minuint(DefaultPerPage, maxPerPage),
+	}
+
+	// Page number
+	if raw := query.Get("page"); raw != "" {
+		page, err := parseUint(raw)
+		if err != nil {
+			return nil, xerrors.Errorf("db: page: %w", err)
+		}
+		req.Page = maxuint(page, 1)
+	}
+
+	// Page size
+	if raw := query.Get("per_page"); raw != "" {
+		perPage, err := parseUint(raw)
+		if err != nil {
+			return nil, xerrors.Errorf("db: per_page: %w", err)
+		}
+		if perPage > 0 {
+			req.PerPage = minuint(perPage, maxPerPage)
+		}
+	}
+
+	// Sort parameters
+	var sorts []string
+	for _, raw := range query["sort"] {
+		sorts = append(sorts, strings.Split(raw, ",")...)
+	}
+	req.Sorts = SortConverter(sorts)
+
+	// Return request
+	return req, nil
+}
+
+// Paginator returns a pagination holder for the request
+func (r *PaginationRequest) Paginator() *Pagination {
+	return NewPaginator(r.Page, r.PerPage)
+}
+
+// -----------------------------------------------------------------------------
+
+// Page is a serialisable page of results
+type Page struct {
+	Items      interface{} `json:"items"`
+	Page       uint        `json:"page"`
+	PerPage    uint        `json:"per_page"`
+	Total      uint        `json:"total"`
+	TotalPages uint        `json:"total_pages"`
+
+	pagination *Pagination
+}
+
+// NewPage returns a page envelope for the given items
+func NewPage(pagination *Pagination, items interface{}) *Page {
+	return &Page{
+		Items:      items,
+		Page:       pagination.page(),
+		PerPage:    pagination.perPage(),
+		Total:      pagination.Total(),
+		TotalPages: pagination.NumPages(),
+		pagination: pagination,
+	}
+}
+
+// LinkHeader returns the RFC 5988 Link header value of the page
+func (p *Page) LinkHeader(u *url.URL) string {
+	return p.pagination.LinkHeader(u)
+}
+
+// LinkHeader returns the RFC 5988 Link header value with first, prev, next
+// and last relations. Other query parameters of the given URL are preserved.
+func (p *Pagination) LinkHeader(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	links := []string{
+		p.link(u, 1, "first"),
+	}
+	if p.HasPrev() {
+		links = append(links, p.link(u, minuint(p.PrevPage(), p.NumPages()), "prev"))
+	}
+	if p.HasNext() {
+		links = append(links, p.link(u, p.NextPage(), "next"))
+	}
+	links = append(links, p.link(u, p.NumPages(), "last"))
+
+	return strings.Join(links, ", ")
+}
+
+// link formats a Link header entry for the given page
+func (p *Pagination) link(u *url.URL, page uint, rel string) string {
+	target := *u
+	query := target.Query()
+	query.Set("page", strconv.FormatUint(uint64(page), 10))
+	query.Set("per_page", strconv.FormatUint(uint64(p.perPage()), 10))
+	target.RawQuery = query.Encode()
+
+	return fmt.Sprintf("<%s>; rel=%q", target.String(), rel)
+}
+
+// parseUint parses a positive number
+func parseUint(raw string) (uint, error) {
+	v, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 32)
+	if err != nil {
+		return 0, xerrors.Errorf("%q: %w", raw, ErrInvalidPagination)
+	}
+	return uint(v), nil
+}
@@ -0,0 +1,114 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package db
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/xerrors"
+)
+
+func TestParsePaginationRequest(t *testing.T) {
+	Convey("Given pagination query parameters", t, func() {
+
+		Convey("When parameters are missing", func() {
+			req, err := ParsePaginationRequest(url.Values{}, 0)
+
+			Convey("Then defaults should be used", func() {
+				So(err, ShouldBeNil)
+				So(req.Page, ShouldEqual, 1)
+				So(req.PerPage, ShouldEqual, DefaultPerPage)
+				So(req.Sorts, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When parameters are valid", func() {
+			query, _ := url.ParseQuery("page=3&per_page=500&sort=-created_at,name&sort=+id")
+			req, err := ParsePaginationRequest(query, 50)
+
+			Convey("Then page size should be capped and sorts parsed", func() {
+				So(err, ShouldBeNil)
+				So(req.Page, ShouldEqual, 3)
+				So(req.PerPage, ShouldEqual, 50)
+				So(req.Sorts, ShouldResemble, SortParameters{
+					{"created_at", Descending},
+					{"name", Ascending},
+					{"id", Ascending},
+				})
+				So(req.Paginator().Page, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When page is zero", func() {
+			query, _ := url.ParseQuery("page=0&per_page=0")
+			req, err := ParsePaginationRequest(query, 0)
+
+			Convey("Then the first page should be used", func() {
+				So(err, ShouldBeNil)
+				So(req.Page, ShouldEqual, 1)
+				So(req.PerPage, ShouldEqual, DefaultPerPage)
+			})
+		})
+
+		Convey("When parameters are invalid", func() {
+			for _, raw := range []string{"page=-1", "page=abc", "per_page=1e3", "page=99999999999"} {
+				query, _ := url.ParseQuery(raw)
+				_, err := ParsePaginationRequest(query, 0)
+
+				So(xerrors.Is(err, ErrInvalidPagination), ShouldBeTrue)
+			}
+		})
+	})
+}
+
+func TestPage(t *testing.T) {
+	Convey("Given the second page of 52 elements", t, func() {
+		pagination := NewPaginator(2, 20)
+		pagination.SetTotal(52)
+		page := NewPage(pagination, []string{"a", "b"})
+
+		Convey("When serialising the envelope", func() {
+			out, err := json.Marshal(page)
+
+			Convey("Then pagination metadata should be included", func() {
+				So(err, ShouldBeNil)
+				So(string(out), ShouldEqual, `{"items":["a","b"],"page":2,"per_page":20,"total":52,"total_pages":3}`)
+			})
+		})
+
+		Convey("When generating the Link header", func() {
+			u, _ := url.Parse("/api/v1/users?q=alice&page=2")
+			header := page.LinkHeader(u)
+
+			Convey("Then all relations should be present", func() {
+				So(header, ShouldEqual, `</api/v1/users?page=1&per_page=20&q=alice>; rel="first", `+
+					`</api/v1/users?page=1&per_page=20&q=alice>; rel="prev", `+
+					`</api/v1/users?page=3&per_page=20&q=alice>; rel="next", `+
+					`</api/v1/users?page=3&per_page=20&q=alice>; rel="last"`)
+			})
+		})
+	})
+}
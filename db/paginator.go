@@ -22,13 +22,11 @@
 
 package db
 
-import (
-	"math"
-)
-
 const (
 	// DefaultPerPage defines the default value for pagination
 	DefaultPerPage uint = 20
+	// DefaultMaxPerPage defines the default upper bound of page size
+	DefaultMaxPerPage uint = 100
 )
 
 // Pagination is a pagination calcul handler for database request.
@@ -45,7 +43,8 @@ func (p *Pagination) SetTotal(total uint) {
 
 // NumPages returns the total number of pages
 func (p *Pagination) NumPages() uint {
-	return maxuint(1, uint(math.Ceil(float64(p.total)/float64(p.PerPage))))
+	perPage := p.perPage()
+	return maxuint(1, (p.total+perPage-1)/perPage)
 }
 
 // Total returns the total number of items
@@ -55,32 +54,34 @@ func (p *Pagination) Total() uint {
 
 // Offset returns the offset of first element
 func (p *Pagination) Offset() uint {
-	offset := (p.Page - 1) * p.PerPage
-	// a couple reasonable boundaries
-	offset = minuint(offset, p.total)
-	offset = maxuint(offset, 0)
-	return offset
+	perPage := p.perPage()
+	// a couple reasonable boundaries, checked before multiplying to avoid
+	// overflows with untrusted page numbers
+	if p.page()-1 > p.total/perPage {
+		return p.total
+	}
+	return minuint((p.page()-1)*perPage, p.total)
 }
 
 // PrevPage returns the page number for the page before this
 // bottoms out at the first page
 func (p *Pagination) PrevPage() uint {
-	return maxuint(p.Page-1, 1)
+	return maxuint(p.page()-1, 1)
 }
 
 // HasPrev returns the status if current page has a previous one
 func (p *Pagination) HasPrev() bool {
-	return p.Page > 1
+	return p.page() > 1
 }
 
 // NextPage returns the page number for the next page. won't go past the end
 func (p *Pagination) NextPage() uint {
-	return minuint(p.Page+1, p.NumPages())
+	return minuint(p.page()+1, p.NumPages())
 }
 
 // HasNext returns the status if current page has a next one
 func (p *Pagination) HasNext() bool {
-	return p.Page+1 <= p.NumPages()
+	return p.page()+1 <= p.NumPages()
 }
 
 // HasOtherPages returns the status of having previous or next pages
@@ -90,7 +91,7 @@ func (p *Pagination) HasOtherPages() bool {
 
 // CurrentPageCount returns the element count of the current page
 func (p *Pagination) CurrentPageCount() uint {
-	return minuint((p.total - p.Offset()), p.PerPage)
+	return minuint(p.total-p.Offset(), p.perPage())
 }
 
 // NewPaginator returns a pagination holder
@@ -113,10 +114,29 @@ func NewPaginator(page, perPage uint) *Pagination {
 
 // -----------------------------------------------------------------------------
 
+// page returns the current page, pages start at 1
+func (p *Pagination) page() uint {
+	return maxuint(p.Page, 1)
+}
+
+// perPage returns the page size, an unset value uses the default one
+func (p *Pagination) perPage() uint {
+	if p.PerPage == 0 {
+		return DefaultPerPage
+	}
+	return p.PerPage
+}
+
 func minuint(a, b uint) uint {
-	return uint(math.Min(float64(a), float64(b)))
+	if a < b {
+		return a
+	}
+	return b
 }
 
 func maxuint(a, b uint) uint {
-	return uint(math.Max(float64(a), float64(b)))
+	if a > b {
+		return a
+	}
+	return b
 }
@@ -153,3 +153,32 @@ func TestAnotherPaginator(t *testing.T) {
 		})
 	})
 }
+
+func TestZeroValuePaginator(t *testing.T) {
+	Convey("Given a paginator built without constructor", t, func() {
+		paginator := &Pagination{}
+
+		Convey("When there are 52 elements", func() {
+			paginator.SetTotal(52)
+
+			Convey("Then it should behave as the first page", func() {
+				So(paginator.Offset(), ShouldEqual, 0)
+				So(paginator.NumPages(), ShouldEqual, 3)
+				So(paginator.HasPrev(), ShouldBeFalse)
+				So(paginator.PrevPage(), ShouldEqual, 1)
+				So(paginator.NextPage(), ShouldEqual, 2)
+				So(paginator.CurrentPageCount(), ShouldEqual, DefaultPerPage)
+			})
+		})
+
+		Convey("When requesting a huge page number", func() {
+			paginator.SetTotal(52)
+			paginator.Page = ^uint(0)
+
+			Convey("Then the offset should not overflow", func() {
+				So(paginator.Offset(), ShouldEqual, 52)
+				So(paginator.CurrentPageCount(), ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -11,6 +11,7 @@ package sqly
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 
@@ -29,6 +30,9 @@ func Mutate(ctx context.Context, db sqlx.ExecerContext, sqlizer sq.Sqlizer) erro
 		return fmt.Errorf("sqly: unable to build query: %w", err)
 	}
 
+	ctx, done := guard(ctx, query, args)
+	defer done()
+
 	res, err := db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("sqly: unable to execute query: %w", err)
@@ -55,6 +59,9 @@ func ExecCount(ctx context.Context, db sqlx.QueryerContext, sqlizer sq.Sqlizer)
 		return 0, fmt.Errorf("sqly: unable to build query: %w", err)
 	}
 
+	ctx, done := guard(ctx, query, args)
+	defer done()
+
 	var count int
 	err = db.QueryRowxContext(ctx, query, args...).Scan(&count)
 	if err != nil {
@@ -74,6 +81,8 @@ func ExecCount(ctx context.Context, db sqlx.QueryerContext, sqlizer sq.Sqlizer)
 // If pagination is not nil, only the requested page is returned along with the total number of
 // results. Otherwise, countBuilder is not used and all results are returned.
 //
+// Loading more rows than the configured MaxRows fails with ErrTooManyRows.
+//
 // The dest parameter must be a pointer to a slice.
 func Search(ctx context.Context, db sqlx.QueryerContext, countBuilder sq.SelectBuilder, selectBuilder sq.SelectBuilder, from string, where interface{}, pagination *pkgdb.Pagination, dest interface{}) (int, error) {
 	// Check the destination type
@@ -94,9 +103,9 @@ func Search(ctx context.Context, db sqlx.QueryerContext, countBuilder sq.SelectB
 			return 0, fmt.Errorf("sqly: unable to build query: %w", err)
 		}
 
-		err = sqlx.SelectContext(ctx, db, dest, query, args...)
+		err = selectGuarded(ctx, db, dest, query, args...)
 		if err != nil {
-			return 0, fmt.Errorf("sqly: unable to execute query: %w", err)
+			return 0, err
 		}
 
 		return reflect.ValueOf(dest).Elem().Len(), nil
@@ -123,10 +132,26 @@ func Search(ctx context.Context, db sqlx.QueryerContext, countBuilder sq.SelectB
 		return 0, fmt.Errorf("sqly: unable to build query: %w", err)
 	}
 
-	err = sqlx.SelectContext(ctx, db, dest, query, args...)
+	err = selectGuarded(ctx, db, dest, query, args...)
 	if err != nil {
-		return 0, fmt.Errorf("sqly: unable to execute query: %w", err)
+		return 0, err
 	}
 
 	return count, nil
 }
+
+func selectGuarded(ctx context.Context, db sqlx.QueryerContext, dest interface{}, query string, args ...interface{}) error {
+	maxRows := optionsFrom(ctx).MaxRows
+
+	ctx, done := guard(ctx, query, args)
+	defer done()
+
+	if err := selectLimited(ctx, db, maxRows, dest, query, args...); err != nil {
+		if errors.Is(err, ErrTooManyRows) {
+			return err
+		}
+		return fmt.Errorf("sqly: unable to execute query: %w", err)
+	}
+
+	return nil
+}
@@ -4,7 +4,10 @@ go 1.13
 
 require (
 	github.com/scraly/go.pkg/db v0.0.8
+	github.com/scraly/go.pkg/log v0.0.13
 	github.com/Masterminds/squirrel v1.2.0
 	github.com/jmoiron/sqlx v1.2.0
+	github.com/smartystreets/goconvey v1.6.4
+	go.uber.org/zap v1.10.0
 	google.golang.org/appengine v1.6.5 // indirect
 )
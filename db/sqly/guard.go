@@ -0,0 +1,193 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2019
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqly
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"github.com/scraly/go.pkg/log"
+)
+
+// ErrTooManyRows is returned when a query returns more rows than the configured maximum.
+var ErrTooManyRows = errors.New("sqly: too many rows in result set")
+
+// DefaultMaxRows is the maximum number of rows loaded by a query when the
+// defaults have not been replaced.
+const DefaultMaxRows = 10000
+
+// Options defines the safeguards applied to the queries executed by sqly.
+type Options struct {
+	// Timeout is the maximum statement duration, 0 disables it.
+	Timeout time.Duration
+	// SlowQueryThreshold is the duration above which a statement is logged, 0 disables it.
+	SlowQueryThreshold time.Duration
+	// MaxRows is the maximum number of rows loaded by a query, 0 disables it.
+	// Queries loading more rows fail with ErrTooManyRows instead of loading
+	// an unbounded result set in memory.
+	MaxRows int
+}
+
+var (
+	defaultsMu sync.RWMutex
+	defaults   = Options{
+		Timeout:            30 * time.Second,
+		SlowQueryThreshold: time.Second,
+		MaxRows:            DefaultMaxRows,
+	}
+)
+
+// SetDefaults replaces the options used when no options are attached to the context.
+func SetDefaults(opts Options) {
+	defaultsMu.Lock()
+	defaults = opts
+	defaultsMu.Unlock()
+}
+
+// Defaults returns the options used when no options are attached to the context.
+func Defaults() Options {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	return defaults
+}
+
+type optionsKey struct{}
+
+// WithOptions returns a context overriding the default options for the queries executed with it.
+func WithOptions(ctx context.Context, opts Options) context.Context {
+	return context.WithValue(ctx, optionsKey{}, opts)
+}
+
+// WithTimeout returns a context overriding the statement timeout.
+func WithTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	opts := optionsFrom(ctx)
+	opts.Timeout = timeout
+	return WithOptions(ctx, opts)
+}
+
+// WithMaxRows returns a context overriding the maximum number of rows loaded by a query.
+func WithMaxRows(ctx context.Context, maxRows int) context.Context {
+	opts := optionsFrom(ctx)
+	opts.MaxRows = maxRows
+	return WithOptions(ctx, opts)
+}
+
+func optionsFrom(ctx context.Context) Options {
+	if opts, ok := ctx.Value(optionsKey{}).(Options); ok {
+		return opts
+	}
+	return Defaults()
+}
+
+// -----------------------------------------------------------------------------
+
+// guard applies the statement timeout to the context, the returned function
+// must be called once the statement is complete to release the context and
+// log slow queries.
+func guard(ctx context.Context, query string, args []interface{}) (context.Context, func()) {
+	opts := optionsFrom(ctx)
+
+	cancel := func() {}
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+
+	start := time.Now()
+	return ctx, func() {
+		cancel()
+
+		elapsed := time.Since(start)
+		if opts.SlowQueryThreshold > 0 && elapsed >= opts.SlowQueryThreshold {
+			log.For(ctx).Warn("Slow query",
+				zap.String("sql", Redact(query)),
+				zap.Int("args", len(args)),
+				zap.Duration("duration", elapsed),
+			)
+		}
+	}
+}
+
+var literals = regexp.MustCompile(`'(?:[^']|'')*'|\$\d+|\b\d+(?:\.\d+)?\b`)
+
+// Redact replaces literal values of the given SQL query with placeholders so
+// that it can be logged safely. Bound parameters are never part of the query.
+func Redact(query string) string {
+	return literals.ReplaceAllStringFunc(query, func(literal string) string {
+		if literal[0] == '$' {
+			// Keep positional placeholders
+			return literal
+		}
+		return "?"
+	})
+}
+
+// selectLimited loads the rows returned by the query into dest, a pointer to a
+// slice, and fails with ErrTooManyRows as soon as more than maxRows rows are read.
+func selectLimited(ctx context.Context, db sqlx.QueryerContext, maxRows int, dest interface{}, query string, args ...interface{}) error {
+	if maxRows <= 0 {
+		return sqlx.SelectContext(ctx, db, dest, query, args...)
+	}
+
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer log.SafeClose(rows, "Unable to close rows")
+
+	slice := reflect.ValueOf(dest).Elem()
+	elemType := slice.Type().Elem()
+
+	isPtr := elemType.Kind() == reflect.Ptr
+	baseType := elemType
+	if isPtr {
+		baseType = elemType.Elem()
+	}
+	scannable := baseType.Kind() != reflect.Struct || reflect.PtrTo(baseType).Implements(scannerType)
+
+	values := reflect.MakeSlice(slice.Type(), 0, 0)
+	for rows.Next() {
+		if values.Len() >= maxRows {
+			return fmt.Errorf("%w: more than %d rows", ErrTooManyRows, maxRows)
+		}
+
+		item := reflect.New(baseType)
+		if scannable {
+			err = rows.Scan(item.Interface())
+		} else {
+			err = rows.StructScan(item.Interface())
+		}
+		if err != nil {
+			return err
+		}
+
+		if isPtr {
+			values = reflect.Append(values, item)
+		} else {
+			values = reflect.Append(values, item.Elem())
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	slice.Set(values)
+	return nil
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
@@ -0,0 +1,248 @@
+/*
+ * Copyright (C) Continental Automotive GmbH 2019
+ * Alle Rechte vorbehalten. All Rights Reserved.
+ * The reproduction, transmission or use of this document or its contents is not
+ * permitted without express written authority. Offenders will be liable for
+ * damages. All rights, including rights created by patent grant or registration of
+ * a utility model or design, are reserved.
+ */
+
+package sqly
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRedact(t *testing.T) {
+	Convey("Given SQL queries", t, func() {
+		testCases := []struct {
+			query    string
+			expected string
+		}{
+			{"SELECT * FROM users", "SELECT * FROM users"},
+			{"SELECT * FROM users WHERE email = 'john@example.com'", "SELECT * FROM users WHERE email = ?"},
+			{"SELECT * FROM users WHERE name = 'O''Brien'", "SELECT * FROM users WHERE name = ?"},
+			{"SELECT * FROM users WHERE age > 42 AND score < 3.5", "SELECT * FROM users WHERE age > ? AND score < ?"},
+			{"SELECT * FROM users WHERE id = $1 LIMIT 10", "SELECT * FROM users WHERE id = $1 LIMIT ?"},
+			{"SELECT * FROM table2 WHERE col1 = ?", "SELECT * FROM table2 WHERE col1 = ?"},
+		}
+
+		for _, tc := range testCases {
+			Convey("Then "+tc.query+" should be redacted", func() {
+				So(Redact(tc.query), ShouldEqual, tc.expected)
+			})
+		}
+	})
+}
+
+func TestDefaults(t *testing.T) {
+	Convey("Given the package defaults", t, func() {
+		opts := Defaults()
+
+		Convey("Then all safeguards should be enabled", func() {
+			So(opts.Timeout, ShouldEqual, 30*time.Second)
+			So(opts.SlowQueryThreshold, ShouldEqual, time.Second)
+			So(opts.MaxRows, ShouldEqual, DefaultMaxRows)
+		})
+	})
+}
+
+func TestOptions(t *testing.T) {
+	Convey("Given default options", t, func() {
+		previous := Defaults()
+		Reset(func() {
+			SetDefaults(previous)
+		})
+
+		SetDefaults(Options{
+			Timeout:            time.Minute,
+			SlowQueryThreshold: 2 * time.Second,
+		})
+
+		Convey("When no options are attached to the context", func() {
+			opts := optionsFrom(context.Background())
+
+			Convey("Then defaults should be used", func() {
+				So(opts.Timeout, ShouldEqual, time.Minute)
+				So(opts.SlowQueryThreshold, ShouldEqual, 2*time.Second)
+				So(opts.MaxRows, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the timeout is overridden", func() {
+			opts := optionsFrom(WithTimeout(context.Background(), time.Second))
+
+			Convey("Then only the timeout should be replaced", func() {
+				So(opts.Timeout, ShouldEqual, time.Second)
+				So(opts.SlowQueryThreshold, ShouldEqual, 2*time.Second)
+			})
+		})
+
+		Convey("When options are attached to the context", func() {
+			ctx := WithOptions(context.Background(), Options{
+				SlowQueryThreshold: 100 * time.Millisecond,
+			})
+
+			Convey("Then they should replace all defaults", func() {
+				opts := optionsFrom(ctx)
+				So(opts.Timeout, ShouldEqual, 0)
+				So(opts.SlowQueryThreshold, ShouldEqual, 100*time.Millisecond)
+			})
+
+			Convey("Then overrides should keep the context options", func() {
+				opts := optionsFrom(WithMaxRows(WithTimeout(ctx, time.Second), 5))
+				So(opts.Timeout, ShouldEqual, time.Second)
+				So(opts.SlowQueryThreshold, ShouldEqual, 100*time.Millisecond)
+				So(opts.MaxRows, ShouldEqual, 5)
+			})
+
+			Convey("Then defaults changes should not be visible", func() {
+				SetDefaults(Options{SlowQueryThreshold: time.Hour})
+				So(optionsFrom(ctx).SlowQueryThreshold, ShouldEqual, 100*time.Millisecond)
+			})
+		})
+
+		Convey("When the statement is guarded", func() {
+			Convey("Then the timeout should be applied", func() {
+				ctx, done := guard(WithTimeout(context.Background(), time.Second), "SELECT 1", nil)
+				defer done()
+
+				deadline, ok := ctx.Deadline()
+				So(ok, ShouldBeTrue)
+				So(time.Until(deadline), ShouldBeLessThanOrEqualTo, time.Second)
+			})
+
+			Convey("Then a zero timeout should not set a deadline", func() {
+				ctx, done := guard(WithTimeout(context.Background(), 0), "SELECT 1", nil)
+				defer done()
+
+				_, ok := ctx.Deadline()
+				So(ok, ShouldBeFalse)
+			})
+
+			Convey("Then the context should be released once done", func() {
+				ctx, done := guard(context.Background(), "SELECT 1", nil)
+				done()
+
+				So(ctx.Err(), ShouldEqual, context.Canceled)
+			})
+		})
+	})
+}
+
+func TestSelectLimited(t *testing.T) {
+	Convey("Given a database returning 3 rows", t, func() {
+		conn := sqlx.NewDb(sql.OpenDB(rowsConnector{count: 3}), "rows")
+		defer conn.Close()
+
+		ctx := context.Background()
+
+		Convey("When rows are loaded without limit", func() {
+			var ids []int
+			err := selectLimited(ctx, conn, 0, &ids, "SELECT id")
+
+			Convey("Then all rows should be returned", func() {
+				So(err, ShouldBeNil)
+				So(ids, ShouldResemble, []int{1, 2, 3})
+			})
+		})
+
+		Convey("When the limit is not reached", func() {
+			var ids []int
+			err := selectLimited(ctx, conn, 3, &ids, "SELECT id")
+
+			Convey("Then all rows should be returned", func() {
+				So(err, ShouldBeNil)
+				So(ids, ShouldResemble, []int{1, 2, 3})
+			})
+		})
+
+		Convey("When the limit is exceeded", func() {
+			var ids []int
+			err := selectLimited(ctx, conn, 2, &ids, "SELECT id")
+
+			Convey("Then ErrTooManyRows should be raised", func() {
+				So(errors.Is(err, ErrTooManyRows), ShouldBeTrue)
+				So(ids, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When rows are loaded into structs", func() {
+			type row struct {
+				ID int `db:"id"`
+			}
+			var rows []*row
+			err := selectLimited(ctx, conn, 10, &rows, "SELECT id")
+
+			Convey("Then each row should be scanned", func() {
+				So(err, ShouldBeNil)
+				So(rows, ShouldHaveLength, 3)
+				So(rows[2].ID, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When rows are loaded through Search", func() {
+			var ids []int
+			_, err := Search(WithMaxRows(ctx, 1), conn, sq.Select("COUNT(*)"), sq.Select("id"), "items", nil, nil, &ids)
+
+			Convey("Then the context limit should be applied", func() {
+				So(errors.Is(err, ErrTooManyRows), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+// -----------------------------------------------------------------------------
+
+// rowsConnector is a database/sql driver returning count rows with a single id
+// column for every query.
+type rowsConnector struct {
+	count int
+}
+
+func (c rowsConnector) Connect(context.Context) (driver.Conn, error) { return rowsConn(c), nil }
+func (c rowsConnector) Driver() driver.Driver                        { return nil }
+
+type rowsConn rowsConnector
+
+func (c rowsConn) Prepare(string) (driver.Stmt, error) { return rowsStmt(c), nil }
+func (c rowsConn) Close() error                        { return nil }
+func (c rowsConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+type rowsStmt rowsConn
+
+func (s rowsStmt) Close() error  { return nil }
+func (s rowsStmt) NumInput() int { return -1 }
+func (s rowsStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s rowsStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &rows{count: s.count}, nil
+}
+
+type rows struct {
+	count, current int
+}
+
+func (r *rows) Columns() []string { return []string{"id"} }
+func (r *rows) Close() error      { return nil }
+func (r *rows) Next(dest []driver.Value) error {
+	if r.current >= r.count {
+		return io.EOF
+	}
+	r.current++
+	dest[0] = []byte(strconv.Itoa(r.current))
+	return nil
+}
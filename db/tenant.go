@@ -0,0 +1,91 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"regexp"
+
+	"golang.org/x/xerrors"
+)
+
+var (
+	// ErrNoTenant is raised when a tenant scoped query is executed without tenant
+	ErrNoTenant = xerrors.New("no tenant in context")
+	// ErrInvalidTenant is raised when the tenant identifier can't be used as a schema or database name
+	ErrInvalidTenant = xerrors.New("invalid tenant identifier")
+)
+
+// tenantPattern restricts tenant identifiers to characters that are safe in
+// schema and database names of all supported backends.
+var tenantPattern = regexp.MustCompile(`^[a-zA-Z0-9_]{1,48}$`)
+
+type tenantKey struct{}
+
+// WithTenant returns a context holding the given tenant identifier
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant identifier held by the context
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantKey{}).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+// -----------------------------------------------------------------------------
+
+// TenantResolver returns the namespace (schema or database name) of the tenant
+// attached to the context.
+type TenantResolver func(ctx context.Context) (string, error)
+
+// ContextTenant is the default TenantResolver, it uses the tenant identifier set
+// with WithTenant as namespace.
+func ContextTenant(ctx context.Context) (string, error) {
+	tenantID, ok := TenantFromContext(ctx)
+	if !ok {
+		return "", ErrNoTenant
+	}
+	if !tenantPattern.MatchString(tenantID) {
+		return "", xerrors.Errorf("db: %q: %w", tenantID, ErrInvalidTenant)
+	}
+
+	return tenantID, nil
+}
+
+// PrefixedTenant returns a TenantResolver which prefixes the namespace returned
+// by the given resolver, ContextTenant is used when resolver is nil.
+func PrefixedTenant(prefix string, resolver TenantResolver) TenantResolver {
+	if resolver == nil {
+		resolver = ContextTenant
+	}
+
+	return func(ctx context.Context) (string, error) {
+		namespace, err := resolver(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		return prefix + namespace, nil
+	}
+}
@@ -0,0 +1,70 @@
+// MIT License
+//
+// Copyright (c) 2019 Thibault NORMAND
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/xerrors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestContextTenant(t *testing.T) {
+	Convey("Given a context", t, func() {
+		ctx := context.Background()
+
+		Convey("When no tenant is set", func() {
+			_, err := ContextTenant(ctx)
+
+			Convey("Then resolution should be refused", func() {
+				So(xerrors.Is(err, ErrNoTenant), ShouldBeTrue)
+			})
+		})
+
+		Convey("When an unsafe tenant is set", func() {
+			_, err := ContextTenant(WithTenant(ctx, "acme; DROP TABLE users"))
+
+			Convey("Then resolution should be refused", func() {
+				So(xerrors.Is(err, ErrInvalidTenant), ShouldBeTrue)
+			})
+		})
+
+		Convey("When a valid tenant is set", func() {
+			ctx = WithTenant(ctx, "acme_42")
+
+			Convey("Then the tenant should be resolved", func() {
+				namespace, err := ContextTenant(ctx)
+				So(err, ShouldBeNil)
+				So(namespace, ShouldEqual, "acme_42")
+			})
+
+			Convey("Then the prefixed resolver should add the prefix", func() {
+				namespace, err := PrefixedTenant("tenant_", nil)(ctx)
+				So(err, ShouldBeNil)
+				So(namespace, ShouldEqual, "tenant_acme_42")
+			})
+		})
+	})
+}
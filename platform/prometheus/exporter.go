@@ -32,8 +32,8 @@ func newExporter(config Config) (*prometheus.Exporter, error) {
 	return exporter, err
 }
 
-// RegisterExporter adds prometheus exporter
-func RegisterExporter(ctx context.Context, conf Config, r *http.ServeMux) (func() error, error) {
+// RegisterExporter adds prometheus exporter, along with the given views
+func RegisterExporter(ctx context.Context, conf Config, r *http.ServeMux, views ...*view.View) (func() error, error) {
 	// Start prometheus
 	if err := conf.Validate(); err != nil {
 		return nil, err
@@ -47,6 +47,11 @@ func RegisterExporter(ctx context.Context, conf Config, r *http.ServeMux) (func(
 	// Add exporter
 	view.RegisterExporter(exporter)
 
+	// Add application views
+	if err := view.Register(views...); err != nil {
+		return nil, xerrors.Errorf("platform: unable to register views: %w", err)
+	}
+
 	// Add metrics handler
 	r.Handle("/metrics", exporter)
 
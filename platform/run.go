@@ -20,6 +20,7 @@ import (
 	"github.com/cloudflare/tableflip"
 	"github.com/dchest/uniuri"
 	"github.com/oklog/run"
+	"go.opencensus.io/stats/view"
 	"go.opencensus.io/trace"
 	"go.uber.org/zap"
 	"golang.org/x/xerrors"
@@ -42,6 +43,8 @@ type Application struct {
 	Revision        string
 	Instrumentation InstrumentationConfig
 	Builder         func(upg *tableflip.Upgrader, group *run.Group)
+	// Views are the OpenCensus views exported by Prometheus, such as sqs.DefaultViews
+	Views []*view.View
 }
 
 // Run the dispatcher
@@ -73,7 +76,7 @@ func Run(ctx context.Context, app *Application) error {
 		defer cancelFunc()
 	}
 	if app.Instrumentation.Prometheus.Enabled {
-		if _, err := prometheus.RegisterExporter(ctx, app.Instrumentation.Prometheus.Config, instrumentationRouter); err != nil {
+		if _, err := prometheus.RegisterExporter(ctx, app.Instrumentation.Prometheus.Config, instrumentationRouter, app.Views...); err != nil {
 			log.For(ctx).Fatal("Unable to register prometheus instrumentation", zap.Error(err))
 		}
 	}
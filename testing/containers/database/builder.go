@@ -2,9 +2,11 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"strings"
 
 	// Load postgresql drivers
 	_ "github.com/jackc/pgx"
@@ -12,12 +14,14 @@ import (
 	_ "github.com/jackc/pgx/stdlib"
 	_ "github.com/lib/pq"
 
+	"github.com/dchest/uniuri"
 	"github.com/jmoiron/sqlx"
 	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"github.com/scraly/go.pkg/db/adapter/postgresql"
 	"golang.org/x/xerrors"
 	dockertest "gopkg.in/ory-am/dockertest.v3"
+	r "gopkg.in/rethinkdb/rethinkdb-go.v5"
 )
 
 var (
@@ -167,3 +171,69 @@ func ConnectToMongoDB(ctx context.Context) (*mongowrapper.WrappedClient, error)
 	// Return connection
 	return db, nil
 }
+
+// ConnectToRethinkDB returns a RethinkDB session and the name of a freshly
+// created database, from a container or a running instance
+func ConnectToRethinkDB(_ context.Context) (*r.Session, string, error) {
+	databaseName := fmt.Sprintf("test_%s", uniuri.NewLen(8))
+
+	// Check environment variable first
+	if address := os.Getenv("TEST_DATABASE_RETHINKDB"); address != "" {
+		log.Println("Found rethinkdb test database config, skipping dockertest...")
+
+		session, err := r.Connect(r.ConnectOpts{
+			Addresses: strings.Split(address, ","),
+		})
+		if err != nil {
+			return nil, "", xerrors.Errorf("testing: unable to connect to rethinkdb: %w", err)
+		}
+
+		if _, err := r.DBCreate(databaseName).RunWrite(session); err != nil {
+			return nil, "", xerrors.Errorf("testing: unable to create rethinkdb database: %w", err)
+		}
+
+		// Return connection
+		return session, databaseName, nil
+	}
+
+	// Initialize a docker container
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		return nil, "", xerrors.Errorf("testing: unable to initialize docker connection: %w", err)
+	}
+
+	// Build rethinkdb container
+	container := newRethinkDBContainer(pool)
+
+	var session *r.Session
+
+	// Wait for connection
+	if err = pool.Retry(func() error {
+		var err error
+
+		session, err = r.Connect(r.ConnectOpts{
+			Addresses: []string{container.Address},
+		})
+		if err != nil {
+			return xerrors.Errorf("testing: unable to connect to rethinkdb: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		log.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	// Create test database
+	if _, err := r.DBCreate(container.DatabaseName).RunWrite(session); err != nil {
+		return nil, "", xerrors.Errorf("testing: unable to create rethinkdb database: %w", err)
+	}
+
+	// Everything is ready
+	log.Printf("RethinkDB (%v): up", container.Name)
+
+	// Add container to resources
+	resources = append(resources, container)
+
+	// Return connection
+	return session, container.DatabaseName, nil
+}
@@ -12,44 +12,42 @@ import (
 
 var (
 	// RethinkDBVersion defines version to use
-	RethinkDBVersion = "latest"
+	RethinkDBVersion = "2.4"
 )
 
 // rethinkDBContainer represents database container handler
 type rethinkDBContainer struct {
-	Name             string
-	ConnectionString string
-	Password         string
-	DatabaseName     string
-	DatabaseUser     string
-	pool             *dockertest.Pool
-	resource         *dockertest.Resource
+	Name         string
+	Address      string
+	DatabaseName string
+	pool         *dockertest.Pool
+	resource     *dockertest.Resource
 }
 
 // newRethinkDBContainer initialize a RethinkDB server in a docker container
 func newRethinkDBContainer(pool *dockertest.Pool) *rethinkDBContainer {
 
 	var (
-		databaseName = fmt.Sprintf("test-%s", uniuri.NewLen(8))
-		databaseUser = fmt.Sprintf("user-%s", uniuri.NewLen(8))
-		password     = uniuri.NewLen(32)
+		databaseName = fmt.Sprintf("test_%s", uniuri.NewLen(8))
 	)
 
-	// Initialize a PostgreSQL server
-	resource, err := pool.Run("rethinkdb", RethinkDBVersion, []string{""})
+	// Initialize a RethinkDB server
+	resource, err := pool.Run("rethinkdb", RethinkDBVersion, nil)
 	if err != nil {
 		log.Fatalf("Could not start resource: %s", err)
 	}
 
+	// Prepare server address
+	address := fmt.Sprintf("localhost:%s", resource.GetPort("28015/tcp"))
+
 	// Retrieve container name
 	containerName := containers.GetName(resource)
 
 	// Return container information
 	return &rethinkDBContainer{
 		Name:         containerName,
-		Password:     password,
+		Address:      address,
 		DatabaseName: databaseName,
-		DatabaseUser: databaseUser,
 		pool:         pool,
 		resource:     resource,
 	}
@@ -59,6 +57,6 @@ func newRethinkDBContainer(pool *dockertest.Pool) *rethinkDBContainer {
 
 // Close the container
 func (container *rethinkDBContainer) Close() error {
-	log.Printf("Postgres (%v): shutting down", container.Name)
+	log.Printf("RethinkDB (%v): shutting down", container.Name)
 	return container.pool.Purge(container.resource)
 }
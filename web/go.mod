@@ -8,4 +8,5 @@ require (
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.1 // indirect
 	github.com/scraly/go.pkg/log v0.0.12
+	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543
 )
@@ -2,9 +2,11 @@ package respond
 
 import (
 	"net/http"
+	"net/url"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/scraly/go.pkg/log"
+	"golang.org/x/xerrors"
 )
 
 // -----------------------------------------------------------------------------
@@ -31,8 +33,40 @@ func With(w http.ResponseWriter, r *http.Request, code int, data interface{}) {
 	log.CheckErrCtx(r.Context(), "Unable to write response", err)
 }
 
-// WithError serialize an error
+// Linker is implemented by paginated responses, such as db.Page, to expose
+// RFC 5988 Link header values relative to the request URL.
+type Linker interface {
+	LinkHeader(u *url.URL) string
+}
+
+// WithPage serialize a paginated response and sets its Link header
+func WithPage(w http.ResponseWriter, r *http.Request, code int, page Linker) {
+	if links := page.LinkHeader(r.URL); links != "" {
+		w.Header().Set("Link", links)
+	}
+
+	With(w, r, code, page)
+}
+
+// StatusCoder is implemented by errors carrying their own HTTP status code,
+// such as classified db errors.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// WithError serialize an error, a zero code is resolved from the error when it
+// implements StatusCoder.
 func WithError(w http.ResponseWriter, r *http.Request, code int, err interface{}) {
+	if code <= 0 {
+		code = http.StatusInternalServerError
+		if e, ok := err.(error); ok {
+			var sc StatusCoder
+			if xerrors.As(e, &sc) {
+				code = sc.StatusCode()
+			}
+		}
+	}
+
 	switch errObj := err.(type) {
 	case string:
 		With(w, r, code, &Status{